@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"io"
 	"os"
 	"path/filepath"
@@ -9,6 +10,9 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/vennictus/gosearch/internal/config"
+	"github.com/vennictus/gosearch/internal/fsys"
+	"github.com/vennictus/gosearch/internal/ignore"
 	"github.com/vennictus/gosearch/internal/search"
 )
 
@@ -136,3 +140,281 @@ type ioDiscard struct{}
 func (ioDiscard) Write(data []byte) (int, error) {
 	return len(data), nil
 }
+
+func BenchmarkTinySearch(b *testing.B) {
+	dir := b.TempDir()
+	for i := 0; i < 5; i++ {
+		filePath := filepath.Join(dir, "tiny_"+strconv.Itoa(i)+".txt")
+		if err := os.WriteFile(filePath, []byte("alpha\nneedle tiny line\nomega\n"), 0o644); err != nil {
+			b.Fatalf("failed to write benchmark fixture: %v", err)
+		}
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		exitCode := run([]string{"-workers", "16", "needle", dir}, ioDiscard{}, ioDiscard{})
+		if exitCode != 0 {
+			b.Fatalf("expected exit code 0, got %d", exitCode)
+		}
+	}
+}
+
+func BenchmarkWalkFlatDirectory(b *testing.B) {
+	if testing.Short() {
+		b.Skip("creates 200k files")
+	}
+	dir := b.TempDir()
+	for i := 0; i < 200000; i++ {
+		file, err := os.Create(filepath.Join(dir, "entry_"+strconv.Itoa(i)+".dat"))
+		if err != nil {
+			b.Fatalf("failed to create benchmark entry: %v", err)
+		}
+		_ = file.Close()
+	}
+	cfg, err := config.Parse([]string{"needle", dir})
+	if err != nil {
+		b.Fatalf("config.Parse returned error: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		jobs := make(chan search.FileJob, 1024)
+		drained := make(chan int)
+		go func() {
+			count := 0
+			for range jobs {
+				count++
+			}
+			drained <- count
+		}()
+		metrics := &search.Metrics{}
+		if err := search.WalkFiles(context.Background(), cfg, jobs, io.Discard, metrics, search.WalkHooks{}); err != nil {
+			b.Fatalf("WalkFiles returned error: %v", err)
+		}
+		close(jobs)
+		if count := <-drained; count != 200000 {
+			b.Fatalf("expected 200000 files, got %d", count)
+		}
+	}
+}
+
+// BenchmarkIgnoreRules matches a 50k-file tree against 5k ignore rules, the
+// shape of a large monorepo: once evaluating every rule on every entry with
+// MatchingRule, once through the per-directory RuleSet the walker uses, and
+// once as a whole walk.
+func BenchmarkIgnoreRules(b *testing.B) {
+	if testing.Short() {
+		b.Skip("creates 50k files")
+	}
+	root := b.TempDir()
+	var rules strings.Builder
+	for i := 0; i < 5000; i++ {
+		switch i % 10 {
+		case 0:
+			rules.WriteString("*.gen" + strconv.Itoa(i) + "\n")
+		case 1:
+			rules.WriteString("pkg_" + strconv.Itoa(i%100) + "/sub_" + strconv.Itoa(i%7) + "/out_" + strconv.Itoa(i) + "\n")
+		case 2:
+			rules.WriteString("!keep_" + strconv.Itoa(i) + ".txt\n")
+		default:
+			rules.WriteString("build_" + strconv.Itoa(i) + "\n")
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, ".gitignore"), []byte(rules.String()), 0o644); err != nil {
+		b.Fatalf("failed to write benchmark ignore file: %v", err)
+	}
+	dirs := []string{root}
+	for pkg := 0; pkg < 100; pkg++ {
+		for sub := 0; sub < 5; sub++ {
+			dir := filepath.Join(root, "pkg_"+strconv.Itoa(pkg), "sub_"+strconv.Itoa(sub))
+			if sub == 0 {
+				dirs = append(dirs, filepath.Dir(dir))
+			}
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				b.Fatalf("failed to create benchmark directory: %v", err)
+			}
+			dirs = append(dirs, dir)
+			for file := 0; file < 100; file++ {
+				if err := os.WriteFile(filepath.Join(dir, "file_"+strconv.Itoa(file)+".txt"), nil, 0o644); err != nil {
+					b.Fatalf("failed to write benchmark entry: %v", err)
+				}
+			}
+		}
+	}
+	entries := make(map[string][]os.DirEntry, len(dirs))
+	for _, dir := range dirs {
+		listed, err := os.ReadDir(dir)
+		if err != nil {
+			b.Fatalf("failed to list benchmark directory: %v", err)
+		}
+		entries[dir] = listed
+	}
+	loaded, _, err := ignore.LoadRules(fsys.OS{}, nil, root, nil)
+	if err != nil {
+		b.Fatalf("LoadRules returned error: %v", err)
+	}
+	defaultIgnoreDirs := map[string]struct{}{}
+
+	b.Run("naive", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for dir, listed := range entries {
+				for _, entry := range listed {
+					ignore.MatchingRule(defaultIgnoreDirs, loaded, filepath.Join(dir, entry.Name()), entry.IsDir())
+				}
+			}
+		}
+	})
+
+	b.Run("ruleset", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			// The walker shares the root's index with directories that
+			// add no rules.
+			rootSet := ignore.NewRuleSet(loaded, root, nil)
+			for dir, listed := range entries {
+				set := ignore.NewRuleSet(loaded, dir, rootSet)
+				for _, entry := range listed {
+					set.Match(defaultIgnoreDirs, entry.Name(), entry.IsDir())
+				}
+			}
+		}
+	})
+
+	b.Run("walk", func(b *testing.B) {
+		cfg, err := config.Parse([]string{"needle", root})
+		if err != nil {
+			b.Fatalf("config.Parse returned error: %v", err)
+		}
+		for i := 0; i < b.N; i++ {
+			jobs := make(chan search.FileJob, 1024)
+			drained := make(chan int)
+			go func() {
+				count := 0
+				for range jobs {
+					count++
+				}
+				drained <- count
+			}()
+			if err := search.WalkFiles(context.Background(), cfg, jobs, io.Discard, &search.Metrics{}, search.WalkHooks{}); err != nil {
+				b.Fatalf("WalkFiles returned error: %v", err)
+			}
+			close(jobs)
+			if count := <-drained; count != 50001 {
+				b.Fatalf("expected 50001 files, got %d", count)
+			}
+		}
+	})
+}
+
+// BenchmarkTune compares the static worker defaults with -tune on two
+// workload shapes: many small files with a cheap literal, where reading
+// dominates, and a few large files with an expensive regex, where matching
+// does.
+func BenchmarkTune(b *testing.B) {
+	ioHeavy := b.TempDir()
+	for i := 0; i < 2000; i++ {
+		dir := filepath.Join(ioHeavy, "d"+strconv.Itoa(i%40))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			b.Fatalf("failed to create benchmark directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "f_"+strconv.Itoa(i)+".txt"), []byte("alpha\nneedle small file\nomega\n"), 0o644); err != nil {
+			b.Fatalf("failed to write benchmark fixture: %v", err)
+		}
+	}
+	cpuHeavy := b.TempDir()
+	for i := 0; i < 40; i++ {
+		var builder strings.Builder
+		for line := 0; line < 5000; line++ {
+			builder.WriteString("key_" + strconv.Itoa(line) + " = value with some padding text " + strconv.Itoa(i) + "\n")
+		}
+		if err := os.WriteFile(filepath.Join(cpuHeavy, "big_"+strconv.Itoa(i)+".txt"), []byte(builder.String()), 0o644); err != nil {
+			b.Fatalf("failed to write benchmark fixture: %v", err)
+		}
+	}
+
+	workloads := []struct {
+		name string
+		args []string
+	}{
+		{"io_heavy", []string{"needle", ioHeavy}},
+		{"cpu_heavy", []string{"-regex", `(\w+_\d+)\s*=\s*.*(padding|text)\s+\d+$`, cpuHeavy}},
+	}
+	for _, workload := range workloads {
+		for _, mode := range []string{"static", "tuned"} {
+			args := append([]string{"-workers", "4"}, workload.args...)
+			if mode == "tuned" {
+				args = append([]string{"-tune"}, args...)
+			}
+			b.Run(workload.name+"/"+mode, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if exitCode := run(args, ioDiscard{}, ioDiscard{}); exitCode != 0 {
+						b.Fatalf("expected exit code 0, got %d", exitCode)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkMultiLiteral(b *testing.B) {
+	lines := make([]string, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		lines = append(lines, "func handler_"+strconv.Itoa(i)+"(w http.ResponseWriter, r *http.Request) { // TODO check errors")
+	}
+	for _, count := range []int{1, 10, 500} {
+		patterns := make([]string, 0, count)
+		for i := 0; i < count; i++ {
+			patterns = append(patterns, "ident_"+strconv.Itoa(i*7919))
+		}
+		patterns[count-1] = "TODO"
+
+		matchers := make([]search.MatchStrategy, 0, count)
+		for _, pattern := range patterns {
+			matchers = append(matchers, search.NewMatcher(pattern, false, false))
+		}
+		strategies := map[string]search.MatchStrategy{
+			"matchers":     search.NewMultiStrategy(matchers),
+			"aho-corasick": search.NewAhoCorasick(patterns, false, false, false),
+		}
+		for _, name := range []string{"matchers", "aho-corasick"} {
+			strategy := strategies[name]
+			b.Run(strconv.Itoa(count)+"/"+name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					for _, line := range lines {
+						if len(strategy.FindRanges(line)) != 1 {
+							b.Fatal("expected one match per line")
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkLiteralNeedles(b *testing.B) {
+	content, err := os.ReadFile(createBenchmarkFile(b))
+	if err != nil {
+		b.Fatalf("failed to read benchmark file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	needles := map[string]string{
+		"3-char":  "nee",
+		"40-char": "this line has needle token and then more",
+	}
+	for _, name := range []string{"3-char", "40-char"} {
+		for _, ignoreCase := range []bool{false, true} {
+			matcher := search.NewMatcher(needles[name], ignoreCase, false)
+			label := name
+			if ignoreCase {
+				label += "/ignore-case"
+			}
+			b.Run(label, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					for _, line := range lines {
+						matcher.FindRanges(line)
+					}
+				}
+			})
+		}
+	}
+}
@@ -4,16 +4,56 @@ _gosearch_completion() {
   COMPREPLY=()
   cur="${COMP_WORDS[COMP_CWORD]}"
   prev="${COMP_WORDS[COMP_CWORD-1]}"
-  local opts="-i -n -w -workers -max-size -extensions -exclude-dir -count -quiet -color -abs -format -regex -follow-symlinks -max-depth -dynamic-workers -io-workers -cpu-workers -max-workers -backpressure -metrics -debug -trace -monitor-goroutines -monitor-interval-ms -cpuprofile -memprofile -config -completion -version"
+  local opts="-i -smart-case -n -w -overlapping -v -L -b -1 -m -max-results -null -A -B -C -group-separator -no-group-separator -workers -max-size -on-bad-encoding -encoding -extensions -exclude-dir -files-from -files-from-dedup -files-from-prefix -count -count-matches -quiet -quiet-results -fail-over -baseline -baseline-write -fail-under -errors-exit -color -hyperlink -hyperlink-format -abs -max-per-dir -sort -sort-spill -no-sort -with-metadata -redact -replace -format -template -file-events -file-stats -max-columns -max-columns-omit -max-columns-json -escape -json-invalid-utf8 -offset-unit -combined-output -output -split-output -auto-spill -regex -engine -pcre-timeout-ms -e -match-all -not -hex-pattern -stdin-pattern -match-filter -min-entropy -also-filenames -show-duplicates -follow-symlinks -respect-gitattributes -strict-ignore -z -max-decompressed-size -max-depth -walk-order -dynamic-workers -io-workers -cpu-workers -max-workers -decompress-workers -backpressure -tune -metrics -stats -progress -plain-numbers -why-empty -debug -trace -monitor-goroutines -monitor-interval-ms -cpuprofile -memprofile -stats-file -compare-last -mem-limit -repro -repro-content -repro-replay -config -completion -json-schema -version"
   case "$prev" in
     -format)
-      COMPREPLY=( $(compgen -W "plain json" -- "$cur") )
+      COMPREPLY=( $(compgen -W "plain json json-array json-events json-v1 grep sarif template" -- "$cur") )
       return 0
       ;;
     -completion)
       COMPREPLY=( $(compgen -W "bash zsh fish" -- "$cur") )
       return 0
       ;;
+    -encoding)
+      COMPREPLY=( $(compgen -W "latin1" -- "$cur") )
+      return 0
+      ;;
+    -on-bad-encoding)
+      COMPREPLY=( $(compgen -W "raw warn skip" -- "$cur") )
+      return 0
+      ;;
+    -walk-order)
+      COMPREPLY=( $(compgen -W "depth breadth interleave" -- "$cur") )
+      return 0
+      ;;
+    -files-from-dedup)
+      COMPREPLY=( $(compgen -W "first all" -- "$cur") )
+      return 0
+      ;;
+    -sort)
+      COMPREPLY=( $(compgen -W "path path-desc mtime size" -- "$cur") )
+      return 0
+      ;;
+    -escape)
+      COMPREPLY=( $(compgen -W "auto escape strip off" -- "$cur") )
+      return 0
+      ;;
+    -hyperlink)
+      COMPREPLY=( $(compgen -W "auto always never" -- "$cur") )
+      return 0
+      ;;
+    -json-invalid-utf8)
+      COMPREPLY=( $(compgen -W "replace base64 skip" -- "$cur") )
+      return 0
+      ;;
+    -engine)
+      COMPREPLY=( $(compgen -W "re2 pcre" -- "$cur") )
+      return 0
+      ;;
+    -offset-unit)
+      COMPREPLY=( $(compgen -W "bytes runes utf16" -- "$cur") )
+      return 0
+      ;;
   esac
   if [[ "$cur" == -* ]]; then
     COMPREPLY=( $(compgen -W "$opts" -- "$cur") )
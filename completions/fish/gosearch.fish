@@ -1,30 +1,106 @@
 complete -c gosearch -l i -d 'case-insensitive matching'
 complete -c gosearch -l n -d 'show line numbers'
 complete -c gosearch -l w -d 'whole-word matching'
+complete -c gosearch -l overlapping -d 'report a match at every starting position'
+complete -c gosearch -l v -d 'invert match'
+complete -c gosearch -l L -d 'list searched files that have no matching line'
+complete -c gosearch -l b -d 'print the byte offset of each line within its file'
+complete -c gosearch -l 1 -d 'print the first match and stop'
+complete -c gosearch -l m -r -d 'stop reading a file after its first N matching lines'
+complete -c gosearch -l max-results -r -d 'print the first N matches found and stop searching'
+complete -c gosearch -l null -d 'end output records with NUL'
+complete -c gosearch -l A -r -d 'context lines after matches'
+complete -c gosearch -l B -r -d 'context lines before matches'
+complete -c gosearch -l C -r -d 'context lines around matches'
+complete -c gosearch -l group-separator -r -d 'line between context blocks'
+complete -c gosearch -l no-group-separator -d 'no line between context blocks'
 complete -c gosearch -l workers -r -d 'worker pool size'
 complete -c gosearch -l max-size -r -d 'max file size'
+complete -c gosearch -l on-bad-encoding -r -a 'raw warn skip' -d 'handling of non-UTF-8 files'
+complete -c gosearch -l encoding -r -a 'latin1' -d 'transcode misencoded files from charset'
 complete -c gosearch -l extensions -r -d 'extensions list'
 complete -c gosearch -l exclude-dir -r -d 'exclude directories'
+complete -c gosearch -l files-from -r -d 'search the files named in a list, as label=path'
+complete -c gosearch -l files-from-dedup -r -a 'first all' -d 'attribute shared files to the first list or all'
+complete -c gosearch -l files-from-prefix -d 'prefix match lines with the list label'
 complete -c gosearch -l count -d 'count only'
+complete -c gosearch -l count-matches -d 'print only the total number of matches'
 complete -c gosearch -l quiet -d 'quiet mode'
+complete -c gosearch -l quiet-results -d 'suppress per-match output but keep summaries'
+complete -c gosearch -l fail-over -r -d 'fail if more matches'
+complete -c gosearch -l baseline -r -d 'compare against baseline file'
+complete -c gosearch -l baseline-write -d 'write the baseline file'
+complete -c gosearch -l fail-under -r -d 'fail if fewer matches'
+complete -c gosearch -l errors-exit -r -d 'file error categories that exit 2'
 complete -c gosearch -l color -d 'color output'
+complete -c gosearch -l hyperlink -r -a 'auto always never' -d 'make paths OSC 8 hyperlinks'
+complete -c gosearch -l hyperlink-format -r -d 'URL template for -hyperlink links'
 complete -c gosearch -l abs -d 'absolute paths'
-complete -c gosearch -l format -r -a 'plain json' -d 'output format'
+complete -c gosearch -l max-per-dir -r -d 'cap printed matches per directory'
+complete -c gosearch -l sort -r -a 'path path-desc mtime size' -d 'print results in order once the search ends'
+complete -c gosearch -l sort-spill -r -d 'results -sort holds in memory before spilling to temp files'
+complete -c gosearch -l no-sort -d 'print results as produced instead of in walk order'
+complete -c gosearch -l with-metadata -d 'annotate results with file metadata'
+complete -c gosearch -l redact -d 'mask matched text in output'
+complete -c gosearch -l replace -r -d 'preview matches replaced by text'
+complete -c gosearch -l format -r -a 'plain json json-array json-events json-v1 grep sarif template' -d 'output format'
+complete -c gosearch -l template -r -d 'text/template for each match'
+complete -c gosearch -l file-events -d 'per-file JSON events'
+complete -c gosearch -l file-stats -d 'report per-file lines, matches, bytes read, and scan time'
+complete -c gosearch -l max-columns -r -d 'truncate lines longer than N bytes'
+complete -c gosearch -l max-columns-omit -d 'omit long lines instead of truncating'
+complete -c gosearch -l max-columns-json -d 'truncate JSON text too'
+complete -c gosearch -l escape -r -a 'auto escape strip off' -d 'control characters in plain output'
+complete -c gosearch -l json-invalid-utf8 -r -a 'replace base64 skip' -d 'JSON lines that are not valid UTF-8'
+complete -c gosearch -l offset-unit -r -a 'bytes runes utf16' -d 'what ranges in JSON output count'
+complete -c gosearch -l combined-output -d 'interleave diagnostics with matches'
+complete -c gosearch -l output -r -d 'write results to a file instead of stdout'
+complete -c gosearch -l split-output -r -d 'write the matches of each pattern to a file in a directory'
+complete -c gosearch -l auto-spill -r -d 'after N results on a terminal, write the full results to a temp file'
 complete -c gosearch -l regex -d 'regex mode'
+complete -c gosearch -l engine -r -a 're2 pcre' -d 'regex engine for -regex'
+complete -c gosearch -l pcre-timeout-ms -r -d 'per-line match timeout for -engine pcre in milliseconds'
+complete -c gosearch -l e -r -d 'match lines containing this pattern (repeatable)'
+complete -c gosearch -l match-all -d 'with several -e, match only lines containing every pattern'
+complete -c gosearch -l not -r -d 'skip lines that also contain this pattern'
+complete -c gosearch -l hex-pattern -r -d 'search raw bytes for a hex sequence'
+complete -c gosearch -l stdin-pattern -d 'read the pattern from the first line of standard input'
+complete -c gosearch -l match-filter -r -d 'post-filter matched text'
+complete -c gosearch -l min-entropy -r -d 'minimum match entropy in bits per char'
+complete -c gosearch -l also-filenames -d 'report filename matches first'
+complete -c gosearch -l show-duplicates -d 'list matched lines that occur in more than one file'
 complete -c gosearch -l follow-symlinks -d 'follow symlinks'
+complete -c gosearch -l respect-gitattributes -d 'skip generated and export-ignore files'
+complete -c gosearch -l strict-ignore -d 'skip the root too when it is excluded'
+complete -c gosearch -l z -d 'search inside gzip, zstd, and xz files'
+complete -c gosearch -l max-decompressed-size -r -d 'max inflated size of a -z file'
 complete -c gosearch -l max-depth -r -d 'max traversal depth'
+complete -c gosearch -l walk-order -r -a 'depth breadth interleave' -d 'directory traversal order'
 complete -c gosearch -l dynamic-workers -d 'dynamic cpu workers'
 complete -c gosearch -l io-workers -r -d 'io worker count'
 complete -c gosearch -l cpu-workers -r -d 'cpu worker count'
 complete -c gosearch -l max-workers -r -d 'max cpu worker count'
+complete -c gosearch -l decompress-workers -r -d 'decompress worker count'
 complete -c gosearch -l backpressure -r -d 'channel buffer size'
+complete -c gosearch -l tune -d 'calibrate worker counts on a sample'
 complete -c gosearch -l metrics -d 'print metrics'
+complete -c gosearch -l stats -d 'print a summary of the run'
+complete -c gosearch -l progress -a 'counts full estimate' -d 'show a progress line on stderr'
+complete -c gosearch -l plain-numbers -d 'print counts and sizes as bare integers'
+complete -c gosearch -l why-empty -d 'explain why nothing matched'
 complete -c gosearch -l debug -d 'debug logs'
 complete -c gosearch -l trace -d 'verbose trace'
 complete -c gosearch -l monitor-goroutines -d 'monitor goroutines'
 complete -c gosearch -l monitor-interval-ms -r -d 'monitor interval ms'
 complete -c gosearch -l cpuprofile -r -d 'cpu profile output'
 complete -c gosearch -l memprofile -r -d 'memory profile output'
+complete -c gosearch -l stats-file -r -d 'append run stats to file'
+complete -c gosearch -l compare-last -d 'print how matches, files searched, and time changed since the last like run'
+complete -c gosearch -l mem-limit -r -d 'warn when peak memory nears this size'
+complete -c gosearch -l repro -r -d 'write walk decisions to a bundle'
+complete -c gosearch -l repro-content -d 'include file starts in the bundle'
+complete -c gosearch -l repro-replay -r -d 'replay a repro bundle'
 complete -c gosearch -l config -r -d 'config file'
 complete -c gosearch -l completion -r -a 'bash zsh fish' -d 'print completion script'
+complete -c gosearch -l json-schema -d 'print the JSON output schema and exit'
 complete -c gosearch -l version -d 'print version'
@@ -1,3 +1,10 @@
 module github.com/vennictus/gosearch
 
 go 1.21
+
+require (
+	github.com/klauspost/compress v1.17.11
+	github.com/ulikunitz/xz v0.5.12
+)
+
+require github.com/dlclark/regexp2 v1.11.5
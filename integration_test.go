@@ -2,13 +2,19 @@ package main
 
 import (
 	"bytes"
+	"fmt"
+	"math/rand"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"sort"
 	"strings"
 	"testing"
 	"testing/quick"
 
 	"github.com/vennictus/gosearch/internal/ignore"
+	"github.com/vennictus/gosearch/internal/search"
 )
 
 func TestDeterministicHarness(t *testing.T) {
@@ -47,6 +53,165 @@ func TestIgnoreNegationProperty(t *testing.T) {
 	}
 }
 
+// TestRuleSetMatchesNaiveEvaluatorProperty checks that the walker's indexed
+// rule matching decides every entry exactly as MatchingRule does, rule for
+// rule, over random rule lists that mix names, globs, paths, negations,
+// directory-only rules, and rules from files that do not apply.
+func TestRuleSetMatchesNaiveEvaluatorProperty(t *testing.T) {
+	patterns := []string{"a", "b", "c", "x.txt", "*.txt", "*t", "*", "?", "[ab]", "a*", "**", "a/b", "a/*", "*/x.txt", "**/c", "a/b/c", "a/b*", "[ab]/c", "a[/]b", "/a", "[", `\x`, "*\xa9.txt"}
+	bases := []string{"root", filepath.Join("root", "a"), filepath.Join("root", "a", "b"), "other"}
+	names := []string{"a", "b", "c", "x.txt", "y.txt", "A", "node_modules", "é.txt"}
+	defaultIgnoreDirs := map[string]struct{}{"node_modules": {}}
+
+	property := func(seed int64) bool {
+		random := rand.New(rand.NewSource(seed))
+		var rules []ignore.Rule
+		for range make([]struct{}, random.Intn(12)) {
+			pattern := patterns[random.Intn(len(patterns))]
+			rules = append(rules, ignore.Rule{
+				BaseDir: bases[random.Intn(len(bases))],
+				Pattern: pattern,
+				Negate:  random.Intn(3) == 0,
+				DirOnly: random.Intn(4) == 0,
+				HasPath: strings.Contains(pattern, "/"),
+			})
+		}
+
+		var parent *ignore.RuleSet
+		for _, dir := range []string{"root", filepath.Join("root", "a"), filepath.Join("root", "a", "b"), filepath.Join("root", "a", "b", "c")} {
+			set := ignore.NewRuleSet(rules, dir, parent)
+			parent = set
+			for _, name := range names {
+				for _, isDir := range []bool{false, true} {
+					wantIgnored, wantRule := ignore.MatchingRule(defaultIgnoreDirs, rules, filepath.Join(dir, name), isDir)
+					gotIgnored, gotRule := set.Match(defaultIgnoreDirs, name, isDir)
+					if gotIgnored != wantIgnored || gotRule != wantRule {
+						t.Logf("rules=%#v dir=%s name=%s isDir=%v: got (%v, %v), want (%v, %v)", rules, dir, name, isDir, gotIgnored, gotRule, wantIgnored, wantRule)
+						return false
+					}
+				}
+			}
+		}
+		return true
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Fatalf("property check failed: %v", err)
+	}
+}
+
+// TestAhoCorasickMatchesOneMatcherPerPatternProperty checks that the
+// automaton reports exactly the ranges of one Matcher per pattern, over
+// random patterns and lines drawn from a small alphabet so they overlap.
+func TestAhoCorasickMatchesOneMatcherPerPatternProperty(t *testing.T) {
+	// ß folds to two characters, so ranges must be mapped back to lines.
+	alphabet := []string{"a", "A", "b", " ", "_", "s", "S", "ß"}
+	randomText := func(random *rand.Rand, maxLen int) string {
+		var text strings.Builder
+		for i := 1 + random.Intn(maxLen); i > 0; i-- {
+			text.WriteString(alphabet[random.Intn(len(alphabet))])
+		}
+		return text.String()
+	}
+
+	property := func(seed int64) bool {
+		random := rand.New(rand.NewSource(seed))
+		patterns := make([]string, 2+random.Intn(6))
+		for i := range patterns {
+			patterns[i] = randomText(random, 4)
+		}
+		ignoreCase, wholeWord, all := random.Intn(2) == 0, random.Intn(3) == 0, random.Intn(4) == 0
+		matchers := make([]search.MatchStrategy, 0, len(patterns))
+		for _, pattern := range patterns {
+			matchers = append(matchers, search.NewMatcher(pattern, ignoreCase, wholeWord))
+		}
+		want := search.NewMultiStrategy(matchers)
+		if all {
+			want = search.NewAllOfStrategy(matchers)
+		}
+		got := search.NewAhoCorasick(patterns, ignoreCase, wholeWord, all)
+		for range make([]struct{}, 20) {
+			line := randomText(random, 24)
+			if wantRanges, gotRanges := want.FindRanges(line), got.FindRanges(line); fmt.Sprint(gotRanges) != fmt.Sprint(wantRanges) {
+				t.Logf("patterns=%q ignoreCase=%v wholeWord=%v all=%v line=%q: got %v, want %v", patterns, ignoreCase, wholeWord, all, line, gotRanges, wantRanges)
+				return false
+			}
+		}
+		return true
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Fatalf("property check failed: %v", err)
+	}
+}
+
+// TestIgnoreCaseLiteralMatchesRegexProperty checks the ASCII case-folding
+// search against (?i) regexp matching of the quoted pattern, which agree
+// on ASCII lines, with patterns long enough for the search to skip ahead.
+func TestIgnoreCaseLiteralMatchesRegexProperty(t *testing.T) {
+	alphabet := "aAbBcC.-"
+	randomText := func(random *rand.Rand, maxLen int) string {
+		text := make([]byte, 1+random.Intn(maxLen))
+		for i := range text {
+			text[i] = alphabet[random.Intn(len(alphabet))]
+		}
+		return string(text)
+	}
+
+	property := func(seed int64) bool {
+		random := rand.New(rand.NewSource(seed))
+		pattern := randomText(random, 12)
+		matcher := search.NewMatcher(pattern, true, false)
+		expression := regexp.MustCompile("(?i)" + regexp.QuoteMeta(pattern))
+		for range make([]struct{}, 20) {
+			line := randomText(random, 60)
+			var want []search.MatchRange
+			for _, loc := range expression.FindAllStringIndex(line, -1) {
+				want = append(want, search.MatchRange{Start: loc[0], End: loc[1]})
+			}
+			if got := matcher.FindRanges(line); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Logf("pattern=%q line=%q: got %v, want %v", pattern, line, got, want)
+				return false
+			}
+		}
+		return true
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Fatalf("property check failed: %v", err)
+	}
+}
+
+func TestJunctionCycleIsSkippedLikeASymlinkLoop(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("junctions exist only on Windows")
+	}
+
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "real", "f.txt"), "needle\n")
+	junction := filepath.Join(root, "real", "loop")
+	if out, err := exec.Command("cmd", "/c", "mklink", "/J", junction, root).CombinedOutput(); err != nil {
+		t.Fatalf("failed to create junction: %v: %s", err, out)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if exitCode := run([]string{"-debug", "-count", "needle", root}, &stdout, &stderr); exitCode != 0 || strings.TrimSpace(stdout.String()) != "1" {
+		t.Fatalf("expected one match, got exit %d: %s%s", exitCode, stdout.String(), stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "decision=not_followed outside_root=false reparse=junction") {
+		t.Fatalf("expected the junction not to be followed, got:\n%s", stderr.String())
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if exitCode := run([]string{"-debug", "-count", "-follow-symlinks", "needle", root}, &stdout, &stderr); exitCode != 0 || strings.TrimSpace(stdout.String()) != "1" {
+		t.Fatalf("expected one match through the junction cycle, got exit %d: %s%s", exitCode, stdout.String(), stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "decision=loop_skipped outside_root=false reparse=junction") {
+		t.Fatalf("expected the junction cycle to be skipped, got:\n%s", stderr.String())
+	}
+}
+
 func TestDebugAndTraceLogging(t *testing.T) {
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
@@ -0,0 +1,40 @@
+// Package clock is the time surface gosearch's background loops read
+// through. The worker scalers and the goroutine monitor use a Clock rather
+// than the time package so tests can drive their tickers by hand instead of
+// sleeping.
+package clock
+
+import "time"
+
+// Clock tells the time and makes tickers.
+type Clock interface {
+	Now() time.Time
+	NewTicker(interval time.Duration) Ticker
+}
+
+// Ticker delivers ticks on C until it is stopped.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real is the system clock.
+type Real struct{}
+
+// Now returns the current time.
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+// NewTicker returns a time.Ticker.
+func (Real) NewTicker(interval time.Duration) Ticker {
+	return realTicker{time.NewTicker(interval)}
+}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (ticker realTicker) C() <-chan time.Time { return ticker.ticker.C }
+
+func (ticker realTicker) Stop() { ticker.ticker.Stop() }
@@ -0,0 +1,109 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is a clock that only moves when told to. Its tickers fire from
+// Advance, which hands each tick over before returning; a loop receives one
+// tick at a time, so once Advance has delivered a tick the loop has finished
+// handling the one before it.
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+// NewFake returns a fake clock reading start.
+func NewFake(start time.Time) *Fake {
+	return &Fake{now: start}
+}
+
+// Now returns the fake time.
+func (clock *Fake) Now() time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return clock.now
+}
+
+// NewTicker returns a ticker that fires every interval of fake time.
+func (clock *Fake) NewTicker(interval time.Duration) Ticker {
+	if interval <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	ticker := &fakeTicker{c: make(chan time.Time), stopped: make(chan struct{}), interval: interval, next: clock.now.Add(interval)}
+	clock.tickers = append(clock.tickers, ticker)
+	return ticker
+}
+
+// Tickers returns how many tickers are running, so a test can wait for a
+// loop to start before advancing.
+func (clock *Fake) Tickers() int {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	running := 0
+	for _, ticker := range clock.tickers {
+		if !ticker.isStopped() {
+			running++
+		}
+	}
+	return running
+}
+
+// Advance moves the clock forward by step, delivering every tick that falls
+// due on the way, in time order. A tick for a stopped ticker is dropped.
+func (clock *Fake) Advance(step time.Duration) {
+	clock.mu.Lock()
+	target := clock.now.Add(step)
+	for {
+		var due *fakeTicker
+		for _, ticker := range clock.tickers {
+			if ticker.isStopped() {
+				continue
+			}
+			if !ticker.next.After(target) && (due == nil || ticker.next.Before(due.next)) {
+				due = ticker
+			}
+		}
+		if due == nil {
+			break
+		}
+		clock.now = due.next
+		due.next = due.next.Add(due.interval)
+		at := clock.now
+		clock.mu.Unlock()
+		select {
+		case due.c <- at:
+		case <-due.stopped:
+		}
+		clock.mu.Lock()
+	}
+	clock.now = target
+	clock.mu.Unlock()
+}
+
+type fakeTicker struct {
+	c        chan time.Time
+	stopped  chan struct{}
+	stopOnce sync.Once
+	interval time.Duration
+	next     time.Time
+}
+
+func (ticker *fakeTicker) C() <-chan time.Time { return ticker.c }
+
+func (ticker *fakeTicker) Stop() {
+	ticker.stopOnce.Do(func() { close(ticker.stopped) })
+}
+
+func (ticker *fakeTicker) isStopped() bool {
+	select {
+	case <-ticker.stopped:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Modes for -color and -hyperlink.
+const (
+	ColorAuto   = "auto"
+	ColorAlways = "always"
+	ColorNever  = "never"
+)
+
+// NoColorEnv names the environment variable (https://no-color.org) that turns
+// -color=auto off. An explicit -color=always still wins.
+const NoColorEnv = "NO_COLOR"
+
+// modeFlag is a flag that is auto, always, or never, such as -color. It is
+// also a boolean flag: a bare flag (or =true) selects on, and =false never,
+// so a bare -color keeps meaning always while a bare -hyperlink means auto.
+type modeFlag struct {
+	name string
+	mode string
+	on   string
+}
+
+// newModeFlag creates a modeFlag starting at mode, or at the .gosearchrc
+// value rc when there is one.
+func newModeFlag(name string, mode string, on string, rc *rcMode) (*modeFlag, error) {
+	flag := &modeFlag{name: name, mode: mode, on: on}
+	if rc != nil {
+		if err := flag.Set(string(*rc)); err != nil {
+			return nil, fmt.Errorf("config: %w", err)
+		}
+	}
+	return flag, nil
+}
+
+func (flag *modeFlag) String() string { return flag.mode }
+
+func (flag *modeFlag) IsBoolFlag() bool { return true }
+
+func (flag *modeFlag) modes() []string { return []string{ColorAuto, ColorAlways, ColorNever} }
+
+func (flag *modeFlag) Set(value string) error {
+	switch value {
+	case ColorAuto, ColorAlways, ColorNever:
+		flag.mode = value
+		return nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("%s must be auto, always, or never", flag.name)
+	}
+	flag.mode = ColorNever
+	if enabled {
+		flag.mode = flag.on
+	}
+	return nil
+}
+
+// checkSpacedMode rejects a bare mode flag followed by one of its modes, as
+// in "-color always". Being boolean flags too, mode flags take a value only
+// after '=', so the mode would quietly become the pattern. Only the last
+// flag parsed can be followed by an argument that is not a flag.
+func checkSpacedMode(fs *flag.FlagSet, args []string) error {
+	remaining := fs.Args()
+	if len(remaining) == 0 || len(remaining) == len(args) {
+		return nil
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(args[len(args)-len(remaining)-1], "-"), "-")
+	defined := fs.Lookup(name)
+	if defined == nil {
+		return nil
+	}
+	value, ok := defined.Value.(interface{ modes() []string })
+	if !ok || !slices.Contains(value.modes(), remaining[0]) {
+		return nil
+	}
+	return fmt.Errorf("%s takes its mode after '=': -%s=%s", name, name, remaining[0])
+}
+
+// rcMode is the .gosearchrc value of a modeFlag or progressFlag: one of its
+// modes, or a JSON boolean.
+type rcMode string
+
+func (value *rcMode) UnmarshalJSON(data []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		*value = rcMode(strconv.FormatBool(enabled))
+		return nil
+	}
+	var mode string
+	if err := json.Unmarshal(data, &mode); err != nil {
+		return errors.New("color, hyperlink, and progress must be a mode, true, or false")
+	}
+	*value = rcMode(mode)
+	return nil
+}
+
+// DefaultHyperlinkFormat links to the file itself.
+const DefaultHyperlinkFormat = "file://{host}{path}"
+
+// checkHyperlinkFormat accepts a -hyperlink-format that names the file and
+// uses only known placeholders. Control characters would end the OSC 8
+// sequence early.
+func checkHyperlinkFormat(format string) error {
+	if !strings.Contains(format, "{path}") {
+		return errors.New("hyperlink-format must contain {path}")
+	}
+	rest := strings.NewReplacer("{path}", "", "{line}", "", "{host}", "").Replace(format)
+	if strings.ContainsAny(rest, "{}") {
+		return errors.New("hyperlink-format placeholders are {path}, {line}, and {host}")
+	}
+	if strings.ContainsFunc(format, unicode.IsControl) {
+		return errors.New("hyperlink-format cannot contain control characters")
+	}
+	return nil
+}
@@ -27,16 +27,56 @@ _gosearch_completion() {
   COMPREPLY=()
   cur="${COMP_WORDS[COMP_CWORD]}"
   prev="${COMP_WORDS[COMP_CWORD-1]}"
-  local opts="-i -n -w -workers -max-size -extensions -exclude-dir -count -quiet -color -abs -format -regex -follow-symlinks -max-depth -dynamic-workers -io-workers -cpu-workers -max-workers -backpressure -metrics -debug -trace -monitor-goroutines -monitor-interval-ms -cpuprofile -memprofile -config -completion -version"
+  local opts="-i -smart-case -n -w -overlapping -v -L -b -1 -m -max-results -null -A -B -C -group-separator -no-group-separator -workers -max-size -on-bad-encoding -encoding -extensions -exclude-dir -files-from -files-from-dedup -files-from-prefix -count -count-matches -quiet -quiet-results -fail-over -baseline -baseline-write -fail-under -errors-exit -color -hyperlink -hyperlink-format -abs -max-per-dir -sort -sort-spill -no-sort -with-metadata -redact -replace -format -template -file-events -file-stats -max-columns -max-columns-omit -max-columns-json -escape -json-invalid-utf8 -offset-unit -combined-output -output -split-output -auto-spill -regex -engine -pcre-timeout-ms -e -match-all -not -hex-pattern -stdin-pattern -match-filter -min-entropy -also-filenames -show-duplicates -follow-symlinks -respect-gitattributes -strict-ignore -z -max-decompressed-size -max-depth -walk-order -dynamic-workers -io-workers -cpu-workers -max-workers -decompress-workers -backpressure -tune -metrics -stats -progress -plain-numbers -why-empty -debug -trace -monitor-goroutines -monitor-interval-ms -cpuprofile -memprofile -stats-file -compare-last -mem-limit -repro -repro-content -repro-replay -config -completion -json-schema -version"
   case "$prev" in
     -format)
-      COMPREPLY=( $(compgen -W "plain json" -- "$cur") )
+      COMPREPLY=( $(compgen -W "plain json json-array json-events json-v1 grep sarif template" -- "$cur") )
       return 0
       ;;
     -completion)
       COMPREPLY=( $(compgen -W "bash zsh fish" -- "$cur") )
       return 0
       ;;
+    -encoding)
+      COMPREPLY=( $(compgen -W "latin1" -- "$cur") )
+      return 0
+      ;;
+    -on-bad-encoding)
+      COMPREPLY=( $(compgen -W "raw warn skip" -- "$cur") )
+      return 0
+      ;;
+    -walk-order)
+      COMPREPLY=( $(compgen -W "depth breadth interleave" -- "$cur") )
+      return 0
+      ;;
+    -files-from-dedup)
+      COMPREPLY=( $(compgen -W "first all" -- "$cur") )
+      return 0
+      ;;
+    -sort)
+      COMPREPLY=( $(compgen -W "path path-desc mtime size" -- "$cur") )
+      return 0
+      ;;
+    -escape)
+      COMPREPLY=( $(compgen -W "auto escape strip off" -- "$cur") )
+      return 0
+      ;;
+    -hyperlink)
+      COMPREPLY=( $(compgen -W "auto always never" -- "$cur") )
+      return 0
+      ;;
+    -json-invalid-utf8)
+      COMPREPLY=( $(compgen -W "replace base64 skip" -- "$cur") )
+      return 0
+      ;;
+    -engine)
+      COMPREPLY=( $(compgen -W "re2 pcre" -- "$cur") )
+      return 0
+      ;;
+    -offset-unit)
+      COMPREPLY=( $(compgen -W "bytes runes utf16" -- "$cur") )
+      return 0
+      ;;
   esac
   if [[ "$cur" == -* ]]; then
     COMPREPLY=( $(compgen -W "$opts" -- "$cur") )
@@ -51,34 +91,108 @@ func zshCompletionScript() string {
 _gosearch_completion() {
   _arguments \
     '-i[case-insensitive matching]' \
+    '-smart-case[case-insensitive unless a pattern has an uppercase letter]' \
     '-n[show line numbers]' \
     '-w[whole-word matching]' \
+    '-overlapping[report a match at every starting position]' \
+    '-v[invert match]' \
+    '-L[list searched files that have no matching line]' \
+    '-b[print the byte offset of each line within its file]' \
+    '-1[print the first match and stop]' \
+    '-m[stop reading a file after its first N matching lines]:count:' \
+    '-max-results[print the first N matches found and stop searching]:count:' \
+    '-null[end output records with NUL]' \
+    '-A[context lines after matches]:count:' \
+    '-B[context lines before matches]:count:' \
+    '-C[context lines around matches]:count:' \
+    '-group-separator[line between context blocks]:string:' \
+    '-no-group-separator[no line between context blocks]' \
     '-workers[worker pool size]:workers:' \
     '-max-size[max file size]:size:' \
+    '-on-bad-encoding[handling of non-UTF-8 files]:mode:(raw warn skip)' \
+    '-encoding[transcode misencoded files from charset]:charset:(latin1)' \
     '-extensions[extensions list]:exts:' \
     '-exclude-dir[exclude dirs]:dirs:' \
+    '-files-from[search the files named in a list, as label=path]:file:_files' \
+    '-files-from-dedup[attribute shared files to the first list or all]:mode:(first all)' \
+    '-files-from-prefix[prefix match lines with the list label]' \
     '-count[count only]' \
+    '-count-matches[print only the total number of matches]' \
     '-quiet[quiet mode]' \
-    '-color[color output]' \
+    '-quiet-results[suppress per-match output but keep summaries]' \
+    '-fail-over[fail if more matches]:count:' \
+    '-baseline[compare against baseline file]:file:_files' \
+    '-baseline-write[write the baseline file]' \
+    '-fail-under[fail if fewer matches]:count:' \
+    '-errors-exit[file error categories that exit 2]:category:' \
+    '-color=-[color output]:when:(auto always never)' \
     '-abs[absolute path output]' \
-    '-format[output format]:format:(plain json)' \
+    '-max-per-dir[cap printed matches per directory]:count:' \
+    '-sort[print results in order once the search ends]:order:(path path-desc mtime size)' \
+    '-sort-spill[results -sort holds in memory before spilling to temp files]:count:' \
+    '-no-sort[print results as produced instead of in walk order]' \
+    '-with-metadata[annotate results with file metadata]' \
+    '-redact[mask matched text in output]' \
+    '-replace[preview matches replaced by text]:text:' \
+    '-format[output format]:format:(plain json json-array json-events json-v1 grep sarif template)' \
+    '-template[text/template for each match]:template:' \
+    '-file-events[per-file JSON events]' \
+    '-file-stats[report per-file lines, matches, bytes read, and scan time]' \
+    '-max-columns[truncate lines longer than N bytes]:N:' \
+    '-max-columns-omit[omit long lines instead of truncating]' \
+    '-max-columns-json[truncate JSON text too]' \
+    '-escape[control characters in plain output]:mode:(auto escape strip off)' \
+    '-json-invalid-utf8[JSON lines that are not valid UTF-8]:policy:(replace base64 skip)' \
+    '-offset-unit[what ranges in JSON output count]:unit:(bytes runes utf16)' \
+    '-combined-output[interleave diagnostics with matches]' \
+    '-output[write results to a file instead of stdout]:file:_files' \
+    '-split-output[write the matches of each pattern to a file in a directory]:directory:_files -/' \
+    '-auto-spill[after N results on a terminal, write the full results to a temp file]:count:' \
     '-regex[regex mode]' \
+    '-engine[regex engine for -regex]:engine:(re2 pcre)' \
+    '-pcre-timeout-ms[per-line match timeout for -engine pcre in milliseconds]:count:' \
+    '-e[match lines containing this pattern (repeatable)]:pattern:' \
+    '-match-all[with several -e, match only lines containing every pattern]' \
+    '-not[skip lines that also contain this pattern]:pattern:' \
+    '-hex-pattern[search raw bytes for a hex sequence]:hex:' \
+    '-stdin-pattern[read the pattern from the first line of standard input]' \
+    '-match-filter[post-filter matched text]:regex:' \
+    '-min-entropy[minimum match entropy in bits per char]:bits:' \
+    '-also-filenames[report filename matches first]' \
+    '-show-duplicates[list matched lines that occur in more than one file]' \
     '-follow-symlinks[follow symlinks]' \
+    '-respect-gitattributes[skip generated and export-ignore files]' \
+    '-strict-ignore[skip the root too when it is excluded]' \
+    '-z[search inside gzip, zstd, and xz files]' \
+    '-max-decompressed-size[max inflated size of a -z file]:size:' \
     '-max-depth[max traversal depth]:depth:' \
+    '-walk-order[directory traversal order]:order:(depth breadth interleave)' \
     '-dynamic-workers[dynamic scaling]' \
     '-io-workers[io workers]:count:' \
     '-cpu-workers[cpu workers]:count:' \
     '-max-workers[max cpu workers]:count:' \
+    '-decompress-workers[decompress worker count]:count:' \
     '-backpressure[channel buffer size]:count:' \
+    '-tune[calibrate worker counts on a sample]' \
     '-metrics[print metrics]' \
+    '-stats[print a summary of the run]' \
+    '-progress=-[show a progress line on stderr]:mode:(counts full estimate)' \
+    '-why-empty[explain why nothing matched]' \
     '-debug[debug logging]' \
     '-trace[verbose trace]' \
     '-monitor-goroutines[monitor goroutine count]' \
     '-monitor-interval-ms[monitor interval ms]:ms:' \
     '-cpuprofile[cpu profile file]:file:_files' \
     '-memprofile[mem profile file]:file:_files' \
+    '-stats-file[append run stats to file]:file:_files' \
+    '-compare-last[print how matches, files searched, and time changed since the last like run]' \
+    '-mem-limit[warn when peak memory nears this size]:size:' \
+    '-repro[write walk decisions to a bundle]:file:_files' \
+    '-repro-content[include file starts in the bundle]' \
+    '-repro-replay[replay a repro bundle]:file:_files' \
     '-config[config file]:file:_files' \
     '-completion[print shell completion]:shell:(bash zsh fish)' \
+    '-json-schema[print the JSON output schema and exit]' \
     '-version[print version]' \
     '*:args:_files'
 }
@@ -90,32 +204,108 @@ func fishCompletionScript() string {
 	return `complete -c gosearch -l i -d 'case-insensitive matching'
 complete -c gosearch -l n -d 'show line numbers'
 complete -c gosearch -l w -d 'whole-word matching'
+complete -c gosearch -l overlapping -d 'report a match at every starting position'
+complete -c gosearch -l v -d 'invert match'
+complete -c gosearch -l L -d 'list searched files that have no matching line'
+complete -c gosearch -l b -d 'print the byte offset of each line within its file'
+complete -c gosearch -l 1 -d 'print the first match and stop'
+complete -c gosearch -l m -r -d 'stop reading a file after its first N matching lines'
+complete -c gosearch -l max-results -r -d 'print the first N matches found and stop searching'
+complete -c gosearch -l null -d 'end output records with NUL'
+complete -c gosearch -l A -r -d 'context lines after matches'
+complete -c gosearch -l B -r -d 'context lines before matches'
+complete -c gosearch -l C -r -d 'context lines around matches'
+complete -c gosearch -l group-separator -r -d 'line between context blocks'
+complete -c gosearch -l no-group-separator -d 'no line between context blocks'
 complete -c gosearch -l workers -r -d 'worker pool size'
 complete -c gosearch -l max-size -r -d 'max file size'
+complete -c gosearch -l on-bad-encoding -r -a 'raw warn skip' -d 'handling of non-UTF-8 files'
+complete -c gosearch -l encoding -r -a 'latin1' -d 'transcode misencoded files from charset'
 complete -c gosearch -l extensions -r -d 'extensions list'
 complete -c gosearch -l exclude-dir -r -d 'exclude directories'
+complete -c gosearch -l files-from -r -d 'search the files named in a list, as label=path'
+complete -c gosearch -l files-from-dedup -r -a 'first all' -d 'attribute shared files to the first list or all'
+complete -c gosearch -l files-from-prefix -d 'prefix match lines with the list label'
 complete -c gosearch -l count -d 'count only'
+complete -c gosearch -l count-matches -d 'print only the total number of matches'
 complete -c gosearch -l quiet -d 'quiet mode'
+complete -c gosearch -l quiet-results -d 'suppress per-match output but keep summaries'
+complete -c gosearch -l fail-over -r -d 'fail if more matches'
+complete -c gosearch -l baseline -r -d 'compare against baseline file'
+complete -c gosearch -l baseline-write -d 'write the baseline file'
+complete -c gosearch -l fail-under -r -d 'fail if fewer matches'
+complete -c gosearch -l errors-exit -r -d 'file error categories that exit 2'
 complete -c gosearch -l color -d 'color output'
+complete -c gosearch -l hyperlink -r -a 'auto always never' -d 'make paths OSC 8 hyperlinks'
+complete -c gosearch -l hyperlink-format -r -d 'URL template for -hyperlink links'
 complete -c gosearch -l abs -d 'absolute paths'
-complete -c gosearch -l format -r -a 'plain json' -d 'output format'
+complete -c gosearch -l max-per-dir -r -d 'cap printed matches per directory'
+complete -c gosearch -l sort -r -a 'path path-desc mtime size' -d 'print results in order once the search ends'
+complete -c gosearch -l sort-spill -r -d 'results -sort holds in memory before spilling to temp files'
+complete -c gosearch -l no-sort -d 'print results as produced instead of in walk order'
+complete -c gosearch -l with-metadata -d 'annotate results with file metadata'
+complete -c gosearch -l redact -d 'mask matched text in output'
+complete -c gosearch -l replace -r -d 'preview matches replaced by text'
+complete -c gosearch -l format -r -a 'plain json json-array json-events json-v1 grep sarif template' -d 'output format'
+complete -c gosearch -l template -r -d 'text/template for each match'
+complete -c gosearch -l file-events -d 'per-file JSON events'
+complete -c gosearch -l file-stats -d 'report per-file lines, matches, bytes read, and scan time'
+complete -c gosearch -l max-columns -r -d 'truncate lines longer than N bytes'
+complete -c gosearch -l max-columns-omit -d 'omit long lines instead of truncating'
+complete -c gosearch -l max-columns-json -d 'truncate JSON text too'
+complete -c gosearch -l escape -r -a 'auto escape strip off' -d 'control characters in plain output'
+complete -c gosearch -l json-invalid-utf8 -r -a 'replace base64 skip' -d 'JSON lines that are not valid UTF-8'
+complete -c gosearch -l offset-unit -r -a 'bytes runes utf16' -d 'what ranges in JSON output count'
+complete -c gosearch -l combined-output -d 'interleave diagnostics with matches'
+complete -c gosearch -l output -r -d 'write results to a file instead of stdout'
+complete -c gosearch -l split-output -r -d 'write the matches of each pattern to a file in a directory'
+complete -c gosearch -l auto-spill -r -d 'after N results on a terminal, write the full results to a temp file'
 complete -c gosearch -l regex -d 'regex mode'
+complete -c gosearch -l engine -r -a 're2 pcre' -d 'regex engine for -regex'
+complete -c gosearch -l pcre-timeout-ms -r -d 'per-line match timeout for -engine pcre in milliseconds'
+complete -c gosearch -l e -r -d 'match lines containing this pattern (repeatable)'
+complete -c gosearch -l match-all -d 'with several -e, match only lines containing every pattern'
+complete -c gosearch -l not -r -d 'skip lines that also contain this pattern'
+complete -c gosearch -l hex-pattern -r -d 'search raw bytes for a hex sequence'
+complete -c gosearch -l stdin-pattern -d 'read the pattern from the first line of standard input'
+complete -c gosearch -l match-filter -r -d 'post-filter matched text'
+complete -c gosearch -l min-entropy -r -d 'minimum match entropy in bits per char'
+complete -c gosearch -l also-filenames -d 'report filename matches first'
+complete -c gosearch -l show-duplicates -d 'list matched lines that occur in more than one file'
 complete -c gosearch -l follow-symlinks -d 'follow symlinks'
+complete -c gosearch -l respect-gitattributes -d 'skip generated and export-ignore files'
+complete -c gosearch -l strict-ignore -d 'skip the root too when it is excluded'
+complete -c gosearch -l z -d 'search inside gzip, zstd, and xz files'
+complete -c gosearch -l max-decompressed-size -r -d 'max inflated size of a -z file'
 complete -c gosearch -l max-depth -r -d 'max traversal depth'
+complete -c gosearch -l walk-order -r -a 'depth breadth interleave' -d 'directory traversal order'
 complete -c gosearch -l dynamic-workers -d 'dynamic cpu workers'
 complete -c gosearch -l io-workers -r -d 'io worker count'
 complete -c gosearch -l cpu-workers -r -d 'cpu worker count'
 complete -c gosearch -l max-workers -r -d 'max cpu worker count'
+complete -c gosearch -l decompress-workers -r -d 'decompress worker count'
 complete -c gosearch -l backpressure -r -d 'channel buffer size'
+complete -c gosearch -l tune -d 'calibrate worker counts on a sample'
 complete -c gosearch -l metrics -d 'print metrics'
+complete -c gosearch -l stats -d 'print a summary of the run'
+complete -c gosearch -l progress -a 'counts full estimate' -d 'show a progress line on stderr'
+complete -c gosearch -l plain-numbers -d 'print counts and sizes as bare integers'
+complete -c gosearch -l why-empty -d 'explain why nothing matched'
 complete -c gosearch -l debug -d 'debug logs'
 complete -c gosearch -l trace -d 'verbose trace'
 complete -c gosearch -l monitor-goroutines -d 'monitor goroutines'
 complete -c gosearch -l monitor-interval-ms -r -d 'monitor interval ms'
 complete -c gosearch -l cpuprofile -r -d 'cpu profile output'
 complete -c gosearch -l memprofile -r -d 'memory profile output'
+complete -c gosearch -l stats-file -r -d 'append run stats to file'
+complete -c gosearch -l compare-last -d 'print how matches, files searched, and time changed since the last like run'
+complete -c gosearch -l mem-limit -r -d 'warn when peak memory nears this size'
+complete -c gosearch -l repro -r -d 'write walk decisions to a bundle'
+complete -c gosearch -l repro-content -d 'include file starts in the bundle'
+complete -c gosearch -l repro-replay -r -d 'replay a repro bundle'
 complete -c gosearch -l config -r -d 'config file'
 complete -c gosearch -l completion -r -a 'bash zsh fish' -d 'print completion script'
+complete -c gosearch -l json-schema -d 'print the JSON output schema and exit'
 complete -c gosearch -l version -d 'print version'
 `
 }
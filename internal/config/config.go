@@ -4,94 +4,419 @@
 package config
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"flag"
+	"fmt"
 	"io"
 	"os"
+	"regexp/syntax"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
+
+	"github.com/vennictus/gosearch/internal/clock"
+	"github.com/vennictus/gosearch/internal/fsys"
+	"github.com/vennictus/gosearch/internal/ignore"
 )
 
 // Config holds all runtime configuration for gosearch.
 type Config struct {
 	ConfigPath       string
 	ShowVersion      bool
+	ShowJSONSchema   bool
 	CompletionTarget string
 	VersionLabel     string
+	// ReproReplay is the bundle -repro-replay walks again instead of searching.
+	ReproReplay string
 
-	Pattern         string
-	RootPath        string
+	// Pattern is the pattern, or the -e patterns joined by newlines, which
+	// no pattern can contain; Patterns holds them one by one.
+	Pattern  string
+	Patterns []string
+	// MatchAll matches lines containing every pattern instead of any.
+	MatchAll bool
+	// NotPatterns are the -not patterns: a line containing any of them is
+	// not reported, however the main patterns match it.
+	NotPatterns []string
+	// HexPattern is the decoded -hex-pattern: raw bytes searched for
+	// without regard to lines. Pattern then holds its normalized hex.
+	HexPattern []byte
+	RootPath   string
+	// FilesFrom holds the files named by -files-from lists, searched instead
+	// of walking RootPath, which is then ".". FilesFromPrefix prefixes plain
+	// and grep match lines with their list's label.
+	FilesFrom       *FileLists
+	FilesFromPrefix bool
 	IgnoreCase      bool
 	ShowLineNumbers bool
 	WholeWord       bool
-	Workers         int
-	MaxSizeBytes    int64
-	Extensions      map[string]struct{}
-	ExcludeDirs     map[string]struct{}
-	CountOnly       bool
-	Quiet           bool
-	Color           bool
-	AbsPath         bool
-	OutputFormat    string
-
-	Regex          bool
+	// Overlapping reports a literal match at every starting position, so
+	// "aa" matches "aaaa" three times; by default matches are leftmost and
+	// non-overlapping, as with -regex.
+	Overlapping bool
+	Invert      bool
+	// FilesWithoutMatch lists searched files with no matching line instead
+	// of printing matches; counts and thresholds then apply to listed files.
+	FilesWithoutMatch bool
+	// ByteOffset prefixes each printed line with its byte offset in the file.
+	ByteOffset bool
+	// FirstMatch prints the first new match and stops the search.
+	FirstMatch bool
+	// MaxCount is -m: each file reports at most its first MaxCount matching
+	// lines and is read no further once it has them. 0 means no limit.
+	MaxCount int
+	// MaxResults stops the search once this many new matches are printed,
+	// as FirstMatch does after one. 0 means no limit.
+	MaxResults int
+	// GroupSeparator is printed between context blocks that are not
+	// contiguous, unless NoGroupSeparator is set.
+	GroupSeparator   string
+	NoGroupSeparator bool
+	// NullTerminate ends each plain output record with NUL instead of a
+	// newline, for xargs -0.
+	NullTerminate bool
+	ContextBefore int
+	ContextAfter  int
+	Workers       int
+	MaxSizeBytes  int64
+	Extensions    map[string]struct{}
+	ExcludeDirs   map[string]struct{}
+	CountOnly     bool
+	// CountMatches, with CountOnly, counts every match rather than every
+	// matching line.
+	CountMatches bool
+	Quiet        bool
+	// QuietResults suppresses per-result output but keeps summaries such
+	// as -show-duplicates groups and -count.
+	QuietResults   bool
+	ShowDuplicates bool
+	// ColorMode is -color: auto, always, or never, with auto already turned
+	// to never when NO_COLOR is set. Color is the resolved setting; the
+	// caller decides it for auto, which depends on whether stdout is a
+	// terminal.
+	ColorMode string
+	Color     bool
+	// HyperlinkMode is -hyperlink, and Hyperlink its resolved setting, like
+	// ColorMode and Color. HyperlinkFormat is the link URL, with {path},
+	// {line}, and {host} replaced.
+	HyperlinkMode   string
+	Hyperlink       bool
+	HyperlinkFormat string
+	// OutputPath is -output: results are written to this file, replaced
+	// atomically once the search ends, instead of to stdout.
+	OutputPath   string
+	AbsPath      bool
+	OutputFormat string
+	// AutoSpill moves output from the terminal to a temporary file once
+	// this many results have been printed; 0 never spills. main clears it
+	// unless stdout is a terminal and OutputPath is empty.
+	AutoSpill int
+	// SplitOutput is -split-output: a directory where each pattern's
+	// matches go to a file of their own, replaced once the search ends, while
+	// stdout gets a summary of the files.
+	SplitOutput string
+	// FileEvents brackets each searched file's json records with file_start
+	// and file_end events.
+	FileEvents bool
+	// FileStats reports each scanned file's lines, matches, bytes read, and
+	// scan time, as json records or on stderr.
+	FileStats bool
+	// JSONArray wraps the json records in a single array ending in a summary
+	// record, for -format json-array. OutputFormat is then "json".
+	JSONArray bool
+	// JSONEvents prints begin, match, end, and summary records for -format
+	// json-events. OutputFormat is then "json" and ByteOffset is set.
+	JSONEvents bool
+	// Template renders each match for -format template.
+	Template       *template.Template
+	CombinedOutput bool
+	// MaxColumns truncates printed lines longer than this many bytes, or
+	// omits them with MaxColumnsOmit; JSON text only with MaxColumnsJSON.
+	MaxColumns     int
+	MaxColumnsOmit bool
+	MaxColumnsJSON bool
+	WithMetadata   bool
+	MaxPerDir      int
+	// Escape is how control characters in matched and context lines are
+	// printed in plain output: escaped, stripped, or left as they are.
+	// EscapeAuto is resolved by the caller, which knows whether stdout is a
+	// terminal; left unresolved it escapes.
+	Escape string
+	// JSONInvalidUTF8 is how JSON records print lines that are not valid
+	// UTF-8: replaced, also base64-encoded, or skipped.
+	JSONInvalidUTF8 string
+	// OffsetUnit is what the ranges in JSON records count: bytes, runes, or
+	// UTF-16 code units.
+	OffsetUnit string
+	// Sort orders the output by path, path-desc, mtime, or size, holding
+	// every result until the search ends; "" prints results as they come.
+	Sort string
+	// SortSpill is how many -sort results are held in memory before they are
+	// sorted and written to a temporary file, to be merged when the search
+	// ends; 0 holds them all in memory.
+	SortSpill int
+	// Ordered prints each file's results together, files in walk order and
+	// lines in order within a file. It is the default unless -no-sort,
+	// -sort, or -quiet make it pointless.
+	Ordered       bool
+	AlsoFilenames bool
+	FailOver      int
+	FailUnder     int
+	// ErrorsExit holds the per-file error categories that make the run
+	// exit 2; see search.ErrorCategories.
+	ErrorsExit    map[string]struct{}
+	BaselinePath  string
+	BaselineWrite bool
+	Redact        bool
+	// Replace prints each matching line with its matches substituted by
+	// Replacement; no file is modified. An empty Replacement deletes them.
+	// With Regex, $1 and ${name} in Replacement refer to the match's groups.
+	Replace       bool
+	Replacement   string
+	MinEntropy    float64
+	OnBadEncoding string
+	Encoding      string
+
+	Regex bool
+	// Engine is re2, Go's regexp, or pcre, a backtracking engine that
+	// gives up on a line after PCRETimeout; see search.RegexEngine.
+	Engine      string
+	PCRETimeout time.Duration
+	MatchFilter string
+	// BinaryAsText searches files containing NUL bytes instead of skipping
+	// them as binary. It is set when the pattern must match a NUL byte.
+	BinaryAsText   bool
 	FollowSymlinks bool
 	MaxDepth       int
+	// WalkOrder is depth, breadth, or interleave; see search.WalkFiles.
+	WalkOrder string
+
+	RespectGitattributes bool
+	// StrictIgnore excludes the root like any other directory when it is on
+	// the default ignore list or holds a prune marker; otherwise the root is
+	// always searched.
+	StrictIgnore bool
 
-	DynamicWorkers   bool
-	IOWorkers        int
-	CPUWorkers       int
-	MaxWorkers       int
-	Backpressure     int
+	SearchCompressed bool
+	// MaxDecompressedBytes stops inflating a -z file past this many bytes;
+	// 0 means no limit.
+	MaxDecompressedBytes int64
+	DynamicWorkers       bool
+	IOWorkers            int
+	CPUWorkers           int
+	DecompressWorkers    int
+	MaxWorkers           int
+	Backpressure         int
+	// Tune replaces the auto worker counts and backpressure with values
+	// calibrated on a sample of the tree; see search.Calibrate.
+	Tune bool
+	// AutoIOWorkers, AutoCPUWorkers, and AutoBackpressure record which of
+	// those values were derived from -workers rather than set, so -tune only
+	// replaces those.
+	AutoIOWorkers    bool
+	AutoCPUWorkers   bool
+	AutoBackpressure bool
 	Metrics          bool
+	// Stats prints a summary of files, lines, matches, and time to stderr
+	// at the end of the run.
+	Stats bool
+	// Progress is -progress: ProgressCounts, ProgressFull, or
+	// ProgressEstimate, or empty for no progress line.
+	Progress string
+	// PlainNumbers prints the counts and sizes of -stats, -progress, and
+	// -compare-last as bare integers instead of grouped digits and units.
+	PlainNumbers bool
+	// WhyEmpty explains on stderr why a run found no matches.
+	WhyEmpty         bool
 	Debug            bool
 	Trace            bool
 	MonitorGoroutine bool
 	MonitorInterval  time.Duration
 	CPUProfilePath   string
 	MemProfilePath   string
+	StatsFile        string
+	// CompareLast prints how the run's matches, files searched, and time
+	// compare with the last run like it, recorded in StatsFile or, without
+	// one, in the user's cache directory.
+	CompareLast bool
+	// MemLimitBytes is -mem-limit: a warning is printed when the run's peak
+	// memory comes within 10% of it. 0 disables the check.
+	MemLimitBytes int64
+	ReproPath     string
+	ReproContent  bool
 
 	DefaultIgnoreDirs map[string]struct{}
+
+	// FS is the filesystem searched. Parse sets it to the OS; tests swap in
+	// an in-memory or fault-injecting one.
+	FS fsys.FS
+	// Clock drives the worker scalers and -monitor-goroutines. Parse sets it
+	// to the real clock; tests swap in a fake one.
+	Clock clock.Clock
+	// IgnoreCache holds parsed ignore and attributes files. Parse gives each
+	// run a fresh one; callers running several searches may share one.
+	IgnoreCache *ignore.Cache
 }
 
 // RCConfig represents the JSON config file structure.
 type RCConfig struct {
-	IgnoreCase        *bool   `json:"ignore_case,omitempty"`
-	ShowLineNumbers   *bool   `json:"show_line_numbers,omitempty"`
-	WholeWord         *bool   `json:"whole_word,omitempty"`
-	Workers           *int    `json:"workers,omitempty"`
-	MaxSize           *string `json:"max_size,omitempty"`
-	Extensions        *string `json:"extensions,omitempty"`
-	ExcludeDir        *string `json:"exclude_dir,omitempty"`
-	CountOnly         *bool   `json:"count,omitempty"`
-	Quiet             *bool   `json:"quiet,omitempty"`
-	Color             *bool   `json:"color,omitempty"`
-	AbsPath           *bool   `json:"abs,omitempty"`
-	OutputFormat      *string `json:"format,omitempty"`
-	Regex             *bool   `json:"regex,omitempty"`
-	FollowSymlinks    *bool   `json:"follow_symlinks,omitempty"`
-	MaxDepth          *int    `json:"max_depth,omitempty"`
-	DynamicWorkers    *bool   `json:"dynamic_workers,omitempty"`
-	IOWorkers         *int    `json:"io_workers,omitempty"`
-	CPUWorkers        *int    `json:"cpu_workers,omitempty"`
-	MaxWorkers        *int    `json:"max_workers,omitempty"`
-	Backpressure      *int    `json:"backpressure,omitempty"`
-	Metrics           *bool   `json:"metrics,omitempty"`
-	Debug             *bool   `json:"debug,omitempty"`
-	Trace             *bool   `json:"trace,omitempty"`
-	MonitorGoroutines *bool   `json:"monitor_goroutines,omitempty"`
-	MonitorIntervalMs *int    `json:"monitor_interval_ms,omitempty"`
+	IgnoreCase           *bool    `json:"ignore_case,omitempty"`
+	SmartCase            *bool    `json:"smart_case,omitempty"`
+	ShowLineNumbers      *bool    `json:"show_line_numbers,omitempty"`
+	WholeWord            *bool    `json:"whole_word,omitempty"`
+	Overlapping          *bool    `json:"overlapping,omitempty"`
+	MatchAll             *bool    `json:"match_all,omitempty"`
+	Invert               *bool    `json:"invert,omitempty"`
+	FilesWithoutMatch    *bool    `json:"files_without_match,omitempty"`
+	ByteOffset           *bool    `json:"byte_offset,omitempty"`
+	NullTerminate        *bool    `json:"null,omitempty"`
+	FirstMatch           *bool    `json:"first_match,omitempty"`
+	MaxCount             *int     `json:"max_count,omitempty"`
+	MaxResults           *int     `json:"max_results,omitempty"`
+	AfterContext         *int     `json:"after_context,omitempty"`
+	BeforeContext        *int     `json:"before_context,omitempty"`
+	Context              *int     `json:"context,omitempty"`
+	GroupSeparator       *string  `json:"group_separator,omitempty"`
+	NoGroupSeparator     *bool    `json:"no_group_separator,omitempty"`
+	Workers              *int     `json:"workers,omitempty"`
+	MaxSize              *string  `json:"max_size,omitempty"`
+	MemLimit             *string  `json:"mem_limit,omitempty"`
+	Extensions           *string  `json:"extensions,omitempty"`
+	ExcludeDir           *string  `json:"exclude_dir,omitempty"`
+	CountOnly            *bool    `json:"count,omitempty"`
+	CountMatches         *bool    `json:"count_matches,omitempty"`
+	Quiet                *bool    `json:"quiet,omitempty"`
+	QuietResults         *bool    `json:"quiet_results,omitempty"`
+	ShowDuplicates       *bool    `json:"show_duplicates,omitempty"`
+	Color                *rcMode  `json:"color,omitempty"`
+	Hyperlink            *rcMode  `json:"hyperlink,omitempty"`
+	HyperlinkFormat      *string  `json:"hyperlink_format,omitempty"`
+	AbsPath              *bool    `json:"abs,omitempty"`
+	OutputFormat         *string  `json:"format,omitempty"`
+	Template             *string  `json:"template,omitempty"`
+	MaxColumns           *int     `json:"max_columns,omitempty"`
+	MaxColumnsOmit       *bool    `json:"max_columns_omit,omitempty"`
+	MaxColumnsJSON       *bool    `json:"max_columns_json,omitempty"`
+	FileEvents           *bool    `json:"file_events,omitempty"`
+	FileStats            *bool    `json:"file_stats,omitempty"`
+	CombinedOutput       *bool    `json:"combined_output,omitempty"`
+	WithMetadata         *bool    `json:"with_metadata,omitempty"`
+	MaxPerDir            *int     `json:"max_per_dir,omitempty"`
+	AutoSpill            *int     `json:"auto_spill,omitempty"`
+	Sort                 *string  `json:"sort,omitempty"`
+	SortSpill            *int     `json:"sort_spill,omitempty"`
+	Escape               *string  `json:"escape,omitempty"`
+	JSONInvalidUTF8      *string  `json:"json_invalid_utf8,omitempty"`
+	OffsetUnit           *string  `json:"offset_unit,omitempty"`
+	NoSort               *bool    `json:"no_sort,omitempty"`
+	AlsoFilenames        *bool    `json:"also_filenames,omitempty"`
+	Redact               *bool    `json:"redact,omitempty"`
+	MinEntropy           *float64 `json:"min_entropy,omitempty"`
+	OnBadEncoding        *string  `json:"on_bad_encoding,omitempty"`
+	Encoding             *string  `json:"encoding,omitempty"`
+	FailOver             *int     `json:"fail_over,omitempty"`
+	FailUnder            *int     `json:"fail_under,omitempty"`
+	ErrorsExit           *string  `json:"errors_exit,omitempty"`
+	Regex                *bool    `json:"regex,omitempty"`
+	Engine               *string  `json:"engine,omitempty"`
+	PCRETimeoutMs        *int     `json:"pcre_timeout_ms,omitempty"`
+	MatchFilter          *string  `json:"match_filter,omitempty"`
+	FollowSymlinks       *bool    `json:"follow_symlinks,omitempty"`
+	RespectGitattributes *bool    `json:"respect_gitattributes,omitempty"`
+	StrictIgnore         *bool    `json:"strict_ignore,omitempty"`
+	MaxDepth             *int     `json:"max_depth,omitempty"`
+	WalkOrder            *string  `json:"walk_order,omitempty"`
+	DynamicWorkers       *bool    `json:"dynamic_workers,omitempty"`
+	IOWorkers            *int     `json:"io_workers,omitempty"`
+	CPUWorkers           *int     `json:"cpu_workers,omitempty"`
+	MaxWorkers           *int     `json:"max_workers,omitempty"`
+	SearchCompressed     *bool    `json:"search_compressed,omitempty"`
+	MaxDecompressedSize  *string  `json:"max_decompressed_size,omitempty"`
+	DecompressWorkers    *int     `json:"decompress_workers,omitempty"`
+	Backpressure         *int     `json:"backpressure,omitempty"`
+	Tune                 *bool    `json:"tune,omitempty"`
+	Metrics              *bool    `json:"metrics,omitempty"`
+	Stats                *bool    `json:"stats,omitempty"`
+	Progress             *rcMode  `json:"progress,omitempty"`
+	PlainNumbers         *bool    `json:"plain_numbers,omitempty"`
+	WhyEmpty             *bool    `json:"why_empty,omitempty"`
+	Debug                *bool    `json:"debug,omitempty"`
+	Trace                *bool    `json:"trace,omitempty"`
+	MonitorGoroutines    *bool    `json:"monitor_goroutines,omitempty"`
+	MonitorIntervalMs    *int     `json:"monitor_interval_ms,omitempty"`
+	CompareLast          *bool    `json:"compare_last,omitempty"`
 }
 
 const UsageText = "Usage: gosearch [flags] <pattern> <path>"
 
+// TemplateFuncs are the functions available to -template besides the
+// text/template builtins.
+var TemplateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// Output orders for -sort.
+const (
+	SortPath     = "path"
+	SortPathDesc = "path-desc"
+	SortMtime    = "mtime"
+	SortSize     = "size"
+)
+
+// Control character handling for -escape.
+const (
+	// EscapeAuto strips control characters on a terminal and escapes them
+	// anywhere else.
+	EscapeAuto = "auto"
+	// EscapeEscape prints control characters as visible escapes, such as \r
+	// and \x1b.
+	EscapeEscape = "escape"
+	// EscapeStrip drops control characters.
+	EscapeStrip = "strip"
+	// EscapeOff prints lines byte for byte.
+	EscapeOff = "off"
+)
+
+// Handling of lines that are not valid UTF-8 in JSON output, for
+// -json-invalid-utf8.
+const (
+	// InvalidUTF8Replace prints each invalid byte as U+FFFD.
+	InvalidUTF8Replace = "replace"
+	// InvalidUTF8Base64 also adds the raw line, base64-encoded, as "bytes".
+	InvalidUTF8Base64 = "base64"
+	// InvalidUTF8Skip leaves such lines out of the output.
+	InvalidUTF8Skip = "skip"
+)
+
+// Units of the ranges in JSON output, for -offset-unit.
+const (
+	// OffsetBytes counts bytes, for slicing the line as read.
+	OffsetBytes = "bytes"
+	// OffsetRunes counts Unicode code points, for column displays.
+	OffsetRunes = "runes"
+	// OffsetUTF16 counts UTF-16 code units, as LSP positions do.
+	OffsetUTF16 = "utf16"
+)
+
+// StatsFileEnv names the environment variable that supplies a default -stats-file path.
+const StatsFileEnv = "GOSEARCH_STATS_FILE"
+
 var Version = "dev"
 
-// Parse parses command line arguments and returns a Config.
+// Parse parses command line arguments and returns a Config. The pattern
+// must be among them.
 func Parse(args []string) (Config, error) {
+	return ParseWithInput(args, PatternInput{})
+}
+
+// ParseWithInput is Parse with somewhere to read a pattern that is not an
+// argument. It is validated like one.
+func ParseWithInput(args []string, input PatternInput) (Config, error) {
 	rcPath := detectConfigPath(args)
 	rcDefaults, rcErr := loadRCConfig(rcPath)
 	if rcErr != nil {
@@ -103,52 +428,222 @@ func Parse(args []string) (Config, error) {
 
 	showVersion := fs.Bool("version", false, "print version")
 	completion := fs.String("completion", "", "print shell completion script: bash|zsh|fish")
+	showJSONSchema := fs.Bool("json-schema", false, "print the JSON output schema and exit")
 	configPath := fs.String("config", rcPath, "path to config file (.gosearchrc JSON)")
 
 	ignoreCase := fs.Bool("i", boolWithDefault(rcDefaults.IgnoreCase, false), "case-insensitive search")
+	smartCase := fs.Bool("smart-case", boolWithDefault(rcDefaults.SmartCase, false), "search case-insensitively unless a pattern contains an uppercase letter (-i overrides)")
 	showLineNumbers := fs.Bool("n", boolWithDefault(rcDefaults.ShowLineNumbers, true), "show line numbers")
 	wholeWord := fs.Bool("w", boolWithDefault(rcDefaults.WholeWord, false), "whole-word matching")
+	overlapping := fs.Bool("overlapping", boolWithDefault(rcDefaults.Overlapping, false), "report a match at every starting position, including overlapping ones (literal patterns only)")
+	invert := fs.Bool("v", boolWithDefault(rcDefaults.Invert, false), "print lines that do not match")
+	filesWithoutMatch := fs.Bool("L", boolWithDefault(rcDefaults.FilesWithoutMatch, false), "list searched files that have no matching line")
+	byteOffset := fs.Bool("b", boolWithDefault(rcDefaults.ByteOffset, false), "print the byte offset of each line within its file")
+	firstMatch := fs.Bool("1", boolWithDefault(rcDefaults.FirstMatch, false), "print the first match found and stop searching")
+	maxCount := fs.Int("m", intWithDefault(rcDefaults.MaxCount, 0), "stop reading a file after its first N matching lines (0 for no limit)")
+	maxResults := fs.Int("max-results", intWithDefault(rcDefaults.MaxResults, 0), "print the first N matches found and stop searching (0 for no limit)")
+	nullTerminate := fs.Bool("null", boolWithDefault(rcDefaults.NullTerminate, false), "end each output record with a NUL byte instead of a newline")
+	afterContext := fs.Int("A", intWithDefault(rcDefaults.AfterContext, 0), "print N lines of context after each match")
+	beforeContext := fs.Int("B", intWithDefault(rcDefaults.BeforeContext, 0), "print N lines of context before each match")
+	bothContext := fs.Int("C", intWithDefault(rcDefaults.Context, 0), "print N lines of context around each match")
+	groupSeparator := fs.String("group-separator", stringWithDefault(rcDefaults.GroupSeparator, "--"), "line printed between context blocks that are not contiguous")
+	noGroupSeparator := fs.Bool("no-group-separator", boolWithDefault(rcDefaults.NoGroupSeparator, false), "print no line between context blocks")
 	workers := fs.Int("workers", intWithDefault(rcDefaults.Workers, runtime.NumCPU()), "base worker count")
 	maxSize := fs.String("max-size", stringWithDefault(rcDefaults.MaxSize, ""), "max file size in bytes, KB, MB, or GB")
 	extensions := fs.String("extensions", stringWithDefault(rcDefaults.Extensions, ""), "comma-separated extensions, e.g. .go,.txt")
 	excludeDir := fs.String("exclude-dir", stringWithDefault(rcDefaults.ExcludeDir, ""), "comma-separated directory names to skip")
 	countOnly := fs.Bool("count", boolWithDefault(rcDefaults.CountOnly, false), "print only total match count")
-	quiet := fs.Bool("quiet", boolWithDefault(rcDefaults.Quiet, false), "suppress output, use exit code only")
-	color := fs.Bool("color", boolWithDefault(rcDefaults.Color, false), "enable ANSI color and highlighting in plain output")
+	countMatches := fs.Bool("count-matches", boolWithDefault(rcDefaults.CountMatches, false), "like -count, but count every match rather than every matching line")
+	quiet := fs.Bool("quiet", boolWithDefault(rcDefaults.Quiet, false), "suppress output, use exit code only (with -count, print only the total)")
+	quietResults := fs.Bool("quiet-results", boolWithDefault(rcDefaults.QuietResults, false), "suppress per-match output but keep summaries")
+	showDuplicates := fs.Bool("show-duplicates", boolWithDefault(rcDefaults.ShowDuplicates, false), "after the search, list matched lines that occur in more than one file")
+	color, err := newModeFlag("color", ColorAuto, ColorAlways, rcDefaults.Color)
+	if err != nil {
+		return Config{}, err
+	}
+	fs.Var(color, "color", "ANSI color and highlighting in plain output: auto|always|never (auto colors a terminal)")
+	hyperlink, err := newModeFlag("hyperlink", ColorNever, ColorAuto, rcDefaults.Hyperlink)
+	if err != nil {
+		return Config{}, err
+	}
+	fs.Var(hyperlink, "hyperlink", "make paths in plain output OSC 8 hyperlinks: auto|always|never (a bare -hyperlink is auto: only on a terminal)")
+	hyperlinkFormat := fs.String("hyperlink-format", stringWithDefault(rcDefaults.HyperlinkFormat, DefaultHyperlinkFormat), "URL of -hyperlink links, with {path}, {line}, and {host}, e.g. vscode://file{path}:{line}")
 	absPath := fs.Bool("abs", boolWithDefault(rcDefaults.AbsPath, false), "print absolute paths")
-	outputFormat := fs.String("format", stringWithDefault(rcDefaults.OutputFormat, "plain"), "output format: plain|json")
+	outputFormat := fs.String("format", stringWithDefault(rcDefaults.OutputFormat, "plain"), "output format: plain|json|json-array|json-events|json-v1|grep|sarif|template")
+	templateText := fs.String("template", stringWithDefault(rcDefaults.Template, ""), "text/template for each match with -format template, e.g. '{{.Path}}:{{.Line}}:{{.Text}}'")
+	fileEvents := fs.Bool("file-events", boolWithDefault(rcDefaults.FileEvents, false), "bracket each file's JSON records with file_start and file_end events")
+	fileStats := fs.Bool("file-stats", boolWithDefault(rcDefaults.FileStats, false), "report each scanned file's lines, matches, bytes read, and scan time (JSON records, or stderr)")
+	maxColumns := fs.Int("max-columns", intWithDefault(rcDefaults.MaxColumns, 0), "truncate printed lines longer than N bytes (0 for unlimited)")
+	maxColumnsOmit := fs.Bool("max-columns-omit", boolWithDefault(rcDefaults.MaxColumnsOmit, false), "replace lines longer than -max-columns with a notice instead of truncating them")
+	maxColumnsJSON := fs.Bool("max-columns-json", boolWithDefault(rcDefaults.MaxColumnsJSON, false), "also truncate text in JSON output to -max-columns")
+	maxPerDir := fs.Int("max-per-dir", intWithDefault(rcDefaults.MaxPerDir, 0), "cap printed matches per directory (0 for unlimited)")
+	escape := fs.String("escape", stringWithDefault(rcDefaults.Escape, EscapeAuto), "control characters in plain output lines: auto|escape|strip|off (auto strips on a terminal, escapes elsewhere)")
+	jsonInvalidUTF8 := fs.String("json-invalid-utf8", stringWithDefault(rcDefaults.JSONInvalidUTF8, InvalidUTF8Replace), "JSON lines that are not valid UTF-8: replace|base64|skip")
+	offsetUnit := fs.String("offset-unit", stringWithDefault(rcDefaults.OffsetUnit, OffsetBytes), "what ranges in JSON output count: bytes|runes|utf16")
+	sortOrder := fs.String("sort", stringWithDefault(rcDefaults.Sort, ""), "print results in order once the search ends: path|path-desc|mtime|size (buffers all output)")
+	sortSpill := fs.Int("sort-spill", intWithDefault(rcDefaults.SortSpill, 100000), "with -sort, hold at most N results in memory and merge the rest from temporary files (0 holds all in memory)")
+	noSort := fs.Bool("no-sort", boolWithDefault(rcDefaults.NoSort, false), "print results as workers produce them instead of in walk order, for throughput")
+	withMetadata := fs.Bool("with-metadata", boolWithDefault(rcDefaults.WithMetadata, false), "annotate results with file size, modification time, and mode")
+	outputPath := fs.String("output", "", "write results to this file instead of stdout, replacing it only once the search completes")
+	splitOutput := fs.String("split-output", "", "write each -e pattern's matches to its own file in this directory and print a summary instead")
+	autoSpill := fs.Int("auto-spill", intWithDefault(rcDefaults.AutoSpill, 0), "after N results on a terminal, write the full results to a temporary file instead (0 never spills)")
+	combinedOutput := fs.Bool("combined-output", boolWithDefault(rcDefaults.CombinedOutput, false), "route diagnostics through the printer so they interleave with matches")
 
+	redact := fs.Bool("redact", boolWithDefault(rcDefaults.Redact, false), "mask matched text in output, keeping the first and last 2 characters")
+	replacement := fs.String("replace", "", "print matching lines with every match replaced by TEXT, where $1 and ${name} refer to -regex groups (preview only, files are not modified)")
+	alsoFilenames := fs.Bool("also-filenames", boolWithDefault(rcDefaults.AlsoFilenames, false), "report files whose names match before content matches")
+	failOver := fs.Int("fail-over", intWithDefault(rcDefaults.FailOver, -1), "exit 3 if there are more than N matches (-1 to disable)")
+	baselinePath := fs.String("baseline", "", "compare matches against a baseline file and report only new ones")
+	baselineWrite := fs.Bool("baseline-write", false, "write current matches to the -baseline file instead of comparing")
+	failUnder := fs.Int("fail-under", intWithDefault(rcDefaults.FailUnder, -1), "exit 3 if there are fewer than N matches (-1 to disable)")
+	errorsExit := fs.String("errors-exit", stringWithDefault(rcDefaults.ErrorsExit, ""), "comma-separated file error categories that make the run exit 2: permission,not-found,io,too-large,binary,encoding,timeout, all, or none")
 	regexMode := fs.Bool("regex", boolWithDefault(rcDefaults.Regex, false), "treat pattern as regex")
+	engine := fs.String("engine", stringWithDefault(rcDefaults.Engine, "re2"), "regex engine for -regex: re2|pcre (backreferences and lookarounds)")
+	pcreTimeoutMs := fs.Int("pcre-timeout-ms", intWithDefault(rcDefaults.PCRETimeoutMs, 1000), "give up matching a line with -engine pcre after this many milliseconds")
+	matchFilter := fs.String("match-filter", stringWithDefault(rcDefaults.MatchFilter, ""), "keep only matches whose matched text also matches this regex")
+	minEntropy := fs.Float64("min-entropy", floatWithDefault(rcDefaults.MinEntropy, 0), "keep only matches with at least this Shannon entropy in bits per character")
+	onBadEncoding := fs.String("on-bad-encoding", stringWithDefault(rcDefaults.OnBadEncoding, "raw"), "handling of files that are not valid UTF-8: raw|warn|skip")
+	encoding := fs.String("encoding", stringWithDefault(rcDefaults.Encoding, ""), "transcode files that are not valid UTF-8 from this charset: latin1")
 	followSymlinks := fs.Bool("follow-symlinks", boolWithDefault(rcDefaults.FollowSymlinks, false), "follow symlinked files/directories")
+	respectGitattributes := fs.Bool("respect-gitattributes", boolWithDefault(rcDefaults.RespectGitattributes, false), "skip files marked linguist-generated or export-ignore in .gitattributes")
+	strictIgnore := fs.Bool("strict-ignore", boolWithDefault(rcDefaults.StrictIgnore, false), "skip the root too when the default ignore list or a prune marker excludes it")
 	maxDepth := fs.Int("max-depth", intWithDefault(rcDefaults.MaxDepth, -1), "max traversal depth (-1 for unlimited)")
+	walkOrder := fs.String("walk-order", stringWithDefault(rcDefaults.WalkOrder, "depth"), "directory traversal order: depth|breadth|interleave")
 
 	dynamicWorkers := fs.Bool("dynamic-workers", boolWithDefault(rcDefaults.DynamicWorkers, false), "dynamically scale CPU workers")
 	ioWorkers := fs.Int("io-workers", intWithDefault(rcDefaults.IOWorkers, 0), "number of IO workers (0=auto)")
 	cpuWorkers := fs.Int("cpu-workers", intWithDefault(rcDefaults.CPUWorkers, 0), "number of CPU workers (0=auto)")
 	maxWorkers := fs.Int("max-workers", intWithDefault(rcDefaults.MaxWorkers, 0), "max CPU workers when dynamic scaling is enabled (0=auto)")
+	searchCompressed := fs.Bool("z", boolWithDefault(rcDefaults.SearchCompressed, false), "search inside gzip, zstd, and xz compressed (.gz, .zst, .xz) files")
+	maxDecompressedSize := fs.String("max-decompressed-size", stringWithDefault(rcDefaults.MaxDecompressedSize, "1GB"), "stop inflating a -z file past this size in bytes, KB, MB, or GB (0 for no limit)")
+	decompressWorkers := fs.Int("decompress-workers", intWithDefault(rcDefaults.DecompressWorkers, 0), "number of decompress workers for -z (0=auto)")
 	backpressure := fs.Int("backpressure", intWithDefault(rcDefaults.Backpressure, 0), "channel buffer size (0=auto)")
+	tune := fs.Bool("tune", boolWithDefault(rcDefaults.Tune, false), "calibrate auto worker counts on a sample of the tree before searching")
 	metrics := fs.Bool("metrics", boolWithDefault(rcDefaults.Metrics, false), "print worker lifecycle metrics")
+	whyEmpty := fs.Bool("why-empty", boolWithDefault(rcDefaults.WhyEmpty, false), "when nothing matches, explain on stderr what was skipped and where the pattern nearly matched")
+	stats := fs.Bool("stats", boolWithDefault(rcDefaults.Stats, false), "print a summary of files searched and skipped, lines, matches, bytes read, and elapsed time to stderr")
+	progress, err := newProgressFlag(rcDefaults.Progress)
+	if err != nil {
+		return Config{}, err
+	}
+	fs.Var(progress, "progress", "show a progress line on stderr: counts|full|estimate (full counts the tree first for percent and ETA, estimate caps that count at a second)")
+	plainNumbers := fs.Bool("plain-numbers", boolWithDefault(rcDefaults.PlainNumbers, false), "print counts and sizes in -stats, -progress, and -compare-last as bare integers, sizes in bytes")
 	debug := fs.Bool("debug", boolWithDefault(rcDefaults.Debug, false), "enable debug logging")
 	trace := fs.Bool("trace", boolWithDefault(rcDefaults.Trace, false), "enable verbose execution trace")
 	monitorGoroutines := fs.Bool("monitor-goroutines", boolWithDefault(rcDefaults.MonitorGoroutines, false), "periodically log goroutine count")
 	monitorIntervalMs := fs.Int("monitor-interval-ms", intWithDefault(rcDefaults.MonitorIntervalMs, 250), "goroutine monitor interval in milliseconds")
 	cpuProfile := fs.String("cpuprofile", "", "write CPU profile to file")
 	memProfile := fs.String("memprofile", "", "write heap profile to file on exit")
+	statsFile := fs.String("stats-file", os.Getenv(StatsFileEnv), "append a JSON-lines run record (timings, counters) to file")
+	compareLast := fs.Bool("compare-last", boolWithDefault(rcDefaults.CompareLast, false), "at the end, print how matches, files searched, and time changed since the last run with the same patterns and root")
+	memLimit := fs.String("mem-limit", stringWithDefault(rcDefaults.MemLimit, ""), "warn when peak memory obtained from the OS comes within 10% of this size (KB, MB, or GB)")
+	reproPath := fs.String("repro", "", "write the walk's decisions, ignore files, and effective config to a bundle file")
+	reproContent := fs.Bool("repro-content", false, "include the first 1 KiB of each walked file in the -repro bundle")
+	reproReplay := fs.String("repro-replay", "", "replay the walk recorded in a -repro bundle and report decisions that differ")
+	filesFrom := &fileSourcesFlag{}
+	fs.Var(filesFrom, "files-from", "search the files named in a newline- or NUL-separated list instead of <path>, as label=path (repeatable)")
+	filesFromDedup := fs.String("files-from-dedup", FilesFromFirst, "attribute a file named by several -files-from lists to the first one or to all: first|all")
+	filesFromPrefix := fs.Bool("files-from-prefix", false, "prefix plain and grep match lines with the -files-from label, e.g. [git] path:3: text")
+	stdinPattern := fs.Bool("stdin-pattern", false, "read the pattern from the first line of standard input; takes only <path>")
+	hexPattern := fs.String("hex-pattern", "", "search raw file bytes for this hex sequence, e.g. DEADBEEF00, reporting byte offsets; takes only <path>")
+	var ePatterns patternsFlag
+	fs.Var(&ePatterns, "e", "match lines containing this pattern; repeat to match any of several (replaces <pattern>)")
+	matchAll := fs.Bool("match-all", boolWithDefault(rcDefaults.MatchAll, false), "with several -e, match only lines containing every pattern")
+	var notPatterns patternsFlag
+	fs.Var(&notPatterns, "not", "skip lines that also contain this pattern, matched as <pattern> is (repeatable)")
 
 	if err := fs.Parse(args); err != nil {
 		return Config{}, err
 	}
+	if err := checkSpacedMode(fs, args); err != nil {
+		return Config{}, err
+	}
 
-	if *showVersion || strings.TrimSpace(*completion) != "" {
+	if *showVersion || *showJSONSchema || strings.TrimSpace(*completion) != "" || strings.TrimSpace(*reproReplay) != "" {
 		return Config{
 			ShowVersion:      *showVersion,
+			ShowJSONSchema:   *showJSONSchema,
 			CompletionTarget: strings.TrimSpace(*completion),
+			ReproReplay:      strings.TrimSpace(*reproReplay),
 			ConfigPath:       strings.TrimSpace(*configPath),
 			VersionLabel:     VersionString(),
 		}, nil
 	}
 
 	remaining := fs.Args()
+	pathsOnly := 1
+	if len(filesFrom.sources) > 0 {
+		pathsOnly = 0
+	}
+	var patterns []string
+	if len(ePatterns) > 0 {
+		if *stdinPattern || strings.TrimSpace(*hexPattern) != "" {
+			return Config{}, errors.New("e cannot be combined with -stdin-pattern or -hex-pattern")
+		}
+		if len(remaining) != pathsOnly {
+			return Config{}, errors.New("e replaces <pattern>: expected only <path>")
+		}
+		for _, item := range ePatterns {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				return Config{}, errors.New("e patterns must be non-empty")
+			}
+			patterns = append(patterns, item)
+		}
+		remaining = append([]string{strings.Join(patterns, "\n")}, remaining...)
+	} else if strings.TrimSpace(*hexPattern) != "" {
+		if *stdinPattern {
+			return Config{}, errors.New("stdin-pattern cannot be combined with -hex-pattern")
+		}
+	} else {
+		supplied, err := supplyPattern(remaining, pathsOnly, *stdinPattern, input)
+		if err != nil {
+			return Config{}, err
+		}
+		remaining = supplied
+	}
+	var notList []string
+	for _, item := range notPatterns {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			return Config{}, errors.New("not patterns must be non-empty")
+		}
+		notList = append(notList, item)
+	}
+	if len(notList) > 0 && strings.TrimSpace(*hexPattern) != "" {
+		return Config{}, errors.New("not cannot be combined with -hex-pattern")
+	}
+	var fileLists *FileLists
+	if len(filesFrom.sources) > 0 {
+		if len(remaining) > 1 {
+			return Config{}, errors.New("files-from replaces <path>: expected only <pattern>")
+		}
+		if *filesFromDedup != FilesFromFirst && *filesFromDedup != FilesFromAll {
+			return Config{}, errors.New("files-from-dedup must be first or all")
+		}
+		lists, err := loadFileLists(filesFrom.sources, *filesFromDedup)
+		if err != nil {
+			return Config{}, err
+		}
+		fileLists = lists
+		// Relative listed paths, like baseline paths, are relative to the
+		// working directory.
+		remaining = append(remaining, ".")
+	} else if *filesFromPrefix {
+		return Config{}, errors.New("files-from-prefix requires -files-from")
+	}
+	var hexNeedle []byte
+	if hexText := strings.TrimSpace(*hexPattern); hexText != "" {
+		if len(remaining) != 1 {
+			return Config{}, errors.New("hex-pattern expects only <path>")
+		}
+		normalized, needle, err := parseHexPattern(hexText)
+		if err != nil {
+			return Config{}, err
+		}
+		hexNeedle = needle
+		remaining = []string{normalized, remaining[0]}
+	}
 	if len(remaining) != 2 {
 		return Config{}, errors.New("expected <pattern> and <path>")
 	}
@@ -159,27 +654,147 @@ func Parse(args []string) (Config, error) {
 		return Config{}, errors.New("pattern and path must be non-empty")
 	}
 
-	info, err := os.Stat(rootPath)
-	if err != nil || !info.IsDir() {
-		return Config{}, errors.New("path must be a readable directory")
+	if patterns == nil {
+		patterns = []string{pattern}
+	}
+	hasNUL := false
+	for _, item := range patterns {
+		newline, nul := patternLiterals(item, *regexMode)
+		if newline {
+			return Config{}, errors.New("pattern contains a newline and can never match: lines are matched one at a time, without their terminators")
+		}
+		hasNUL = hasNUL || nul
 	}
 
 	if *workers < 1 {
 		return Config{}, errors.New("workers must be at least 1")
 	}
 
+	if *afterContext < 0 || *beforeContext < 0 || *bothContext < 0 {
+		return Config{}, errors.New("context line counts must be 0 or greater")
+	}
+	if *maxCount < 0 {
+		return Config{}, errors.New("m must be 0 or greater")
+	}
+	if *maxResults < 0 {
+		return Config{}, errors.New("max-results must be 0 or greater")
+	}
+	// -C widens whichever of -A and -B was not given on the command line.
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	if !explicit["A"] {
+		*afterContext = max(*afterContext, *bothContext)
+	}
+	if !explicit["B"] {
+		*beforeContext = max(*beforeContext, *bothContext)
+	}
+	if explicit["match-all"] && len(ePatterns) == 0 {
+		return Config{}, errors.New("match-all requires -e")
+	}
+	// -smart-case decides -i from the patterns unless -i was given on the
+	// command line. Hex patterns have no case.
+	if *smartCase && !explicit["i"] && hexNeedle == nil {
+		upper := false
+		for _, item := range patterns {
+			upper = upper || hasUppercaseLiteral(item, *regexMode)
+		}
+		*ignoreCase = !upper
+	}
+	if explicit["group-separator"] && explicit["no-group-separator"] {
+		return Config{}, errors.New("group-separator cannot be combined with -no-group-separator")
+	}
+	if strings.ContainsAny(*groupSeparator, "\r\n\x00") {
+		return Config{}, errors.New("group-separator must be a single line")
+	}
+
 	if *maxDepth < -1 {
 		return Config{}, errors.New("max-depth must be -1 or greater")
 	}
+	if *walkOrder != "depth" && *walkOrder != "breadth" && *walkOrder != "interleave" {
+		return Config{}, errors.New("walk-order must be depth, breadth, or interleave")
+	}
 
 	maxSizeBytes, err := ParseSize(*maxSize)
 	if err != nil {
 		return Config{}, err
 	}
+	memLimitBytes, err := ParseSize(*memLimit)
+	if err != nil {
+		return Config{}, errors.New("invalid -mem-limit value")
+	}
+	maxDecompressedBytes, err := ParseSize(*maxDecompressedSize)
+	if err != nil {
+		return Config{}, errors.New("invalid -max-decompressed-size value")
+	}
 
 	format := strings.ToLower(strings.TrimSpace(*outputFormat))
-	if format != "plain" && format != "json" {
-		return Config{}, errors.New("format must be plain or json")
+	if format != "plain" && format != "json" && format != "json-array" && format != "json-events" && format != "json-v1" && format != "grep" && format != "sarif" && format != "template" {
+		return Config{}, errors.New("format must be plain, json, json-array, json-events, json-v1, grep, sarif, or template")
+	}
+	// -count-matches is -count with another unit, and refused alongside
+	// what -count is.
+	if *countMatches {
+		if *filesWithoutMatch {
+			return Config{}, errors.New("count-matches cannot be combined with -L")
+		}
+		*countOnly = true
+	}
+	var matchTemplate *template.Template
+	if format == "template" {
+		if *templateText == "" {
+			return Config{}, errors.New("format template requires -template")
+		}
+		matchTemplate, err = template.New("-template").Funcs(TemplateFuncs).Parse(*templateText)
+		if err != nil {
+			return Config{}, err
+		}
+	} else if *templateText != "" && explicit["template"] {
+		return Config{}, errors.New("template requires -format template")
+	}
+	if format == "sarif" && (*filesWithoutMatch || *countOnly || *alsoFilenames || *showDuplicates) {
+		return Config{}, errors.New("format sarif cannot be combined with -L, -count, -also-filenames, or -show-duplicates")
+	}
+	if *firstMatch && (*countOnly || *filesWithoutMatch) {
+		return Config{}, errors.New("-1 cannot be combined with -count or -L")
+	}
+	if *maxResults > 0 && (*countOnly || *filesWithoutMatch) {
+		return Config{}, errors.New("max-results cannot be combined with -count or -L")
+	}
+	if *fileEvents && format != "json" && format != "json-array" {
+		return Config{}, errors.New("file-events requires -format json or json-array")
+	}
+	if *fileEvents && (*filesWithoutMatch || *countOnly || *alsoFilenames) {
+		return Config{}, errors.New("file-events cannot be combined with -L, -count, or -also-filenames")
+	}
+	if explicit["json-invalid-utf8"] && format != "json" && format != "json-array" && format != "json-events" {
+		return Config{}, errors.New("json-invalid-utf8 requires -format json, json-array, or json-events")
+	}
+	if explicit["offset-unit"] && format != "json" && format != "json-array" && format != "json-events" {
+		return Config{}, errors.New("offset-unit requires -format json, json-array, or json-events")
+	}
+	if *nullTerminate && format != "plain" && format != "grep" {
+		return Config{}, errors.New("null cannot be combined with a JSON format")
+	}
+	if format == "json-v1" && (*filesWithoutMatch || *alsoFilenames) {
+		return Config{}, errors.New("format json-v1 cannot be combined with -L or -also-filenames")
+	}
+	splitDir := strings.TrimSpace(*splitOutput)
+	if splitDir != "" {
+		if format != "plain" && format != "grep" && format != "json" {
+			return Config{}, errors.New("split-output requires -format plain, grep, or json")
+		}
+		if *invert || *filesWithoutMatch || *countOnly || *alsoFilenames || *quiet || hexNeedle != nil || strings.TrimSpace(*outputPath) != "" {
+			return Config{}, errors.New("split-output cannot be combined with -v, -L, -count, -also-filenames, -quiet, -hex-pattern, or -output")
+		}
+	}
+	if format == "json-events" && (*filesWithoutMatch || *countOnly || *alsoFilenames || *fileEvents || *fileStats || *sortOrder != "" || hexNeedle != nil) {
+		return Config{}, errors.New("format json-events cannot be combined with -L, -count, -also-filenames, -file-events, -file-stats, -sort, or -hex-pattern")
+	}
+	// json-array prints the json records as elements of one array, and
+	// json-events brackets each file's matches with begin and end records.
+	jsonArray, jsonEvents := format == "json-array", format == "json-events"
+	if jsonArray || jsonEvents {
+		format = "json"
 	}
 
 	resolvedIOWorkers := *ioWorkers
@@ -206,6 +821,14 @@ func Parse(args []string) (Config, error) {
 		return Config{}, errors.New("max-workers must be >= cpu-workers")
 	}
 
+	resolvedDecompressWorkers := *decompressWorkers
+	if resolvedDecompressWorkers == 0 {
+		resolvedDecompressWorkers = maxInt(1, *workers/2)
+	}
+	if resolvedDecompressWorkers < 1 {
+		return Config{}, errors.New("decompress-workers must be at least 1")
+	}
+
 	resolvedBackpressure := *backpressure
 	if resolvedBackpressure == 0 {
 		resolvedBackpressure = maxInt(1, (*workers)*8)
@@ -214,6 +837,137 @@ func Parse(args []string) (Config, error) {
 		return Config{}, errors.New("backpressure must be at least 1")
 	}
 
+	if *minEntropy < 0 {
+		return Config{}, errors.New("min-entropy must be 0 or greater")
+	}
+
+	badEncodingMode := strings.ToLower(strings.TrimSpace(*onBadEncoding))
+	if badEncodingMode != "raw" && badEncodingMode != "warn" && badEncodingMode != "skip" {
+		return Config{}, errors.New("on-bad-encoding must be raw, warn, or skip")
+	}
+	charset := strings.ToLower(strings.TrimSpace(*encoding))
+	if charset == "iso-8859-1" {
+		charset = "latin1"
+	}
+	if charset != "" && charset != "latin1" {
+		return Config{}, errors.New("encoding must be latin1")
+	}
+
+	colorMode := color.mode
+	if colorMode == ColorAuto && os.Getenv(NoColorEnv) != "" {
+		colorMode = ColorNever
+	}
+	if err := checkHyperlinkFormat(*hyperlinkFormat); err != nil {
+		return Config{}, err
+	}
+
+	if *maxColumns < 0 {
+		return Config{}, errors.New("max-columns must be 0 or greater")
+	}
+	if (*maxColumnsOmit || *maxColumnsJSON) && *maxColumns == 0 {
+		return Config{}, errors.New("max-columns-omit and max-columns-json require -max-columns")
+	}
+
+	if *maxPerDir < 0 {
+		return Config{}, errors.New("max-per-dir must be 0 or greater")
+	}
+	if *autoSpill < 0 {
+		return Config{}, errors.New("auto-spill must be 0 or greater")
+	}
+	switch *escape {
+	case EscapeAuto, EscapeEscape, EscapeStrip, EscapeOff:
+	default:
+		return Config{}, errors.New("escape must be auto, escape, strip, or off")
+	}
+	switch *jsonInvalidUTF8 {
+	case InvalidUTF8Replace, InvalidUTF8Base64, InvalidUTF8Skip:
+	default:
+		return Config{}, errors.New("json-invalid-utf8 must be replace, base64, or skip")
+	}
+	switch *offsetUnit {
+	case OffsetBytes, OffsetRunes, OffsetUTF16:
+	default:
+		return Config{}, errors.New("offset-unit must be bytes, runes, or utf16")
+	}
+	switch *sortOrder {
+	case "", SortPath, SortPathDesc, SortMtime, SortSize:
+	default:
+		return Config{}, errors.New("sort must be path, path-desc, mtime, or size")
+	}
+	if *sortOrder != "" && *fileEvents {
+		return Config{}, errors.New("sort cannot be combined with -file-events")
+	}
+	if *sortSpill < 0 {
+		return Config{}, errors.New("sort-spill must be 0 or greater")
+	}
+
+	if *failOver < -1 {
+		return Config{}, errors.New("fail-over must be -1 or greater")
+	}
+	if *failUnder < -1 {
+		return Config{}, errors.New("fail-under must be -1 or greater")
+	}
+
+	if hexNeedle != nil {
+		if *ignoreCase || *wholeWord || *regexMode || *invert {
+			return Config{}, errors.New("hex-pattern cannot be combined with -i, -w, -regex, or -v")
+		}
+		if *afterContext > 0 || *beforeContext > 0 || *filesWithoutMatch || *alsoFilenames || *fileEvents || *fileStats || *searchCompressed {
+			return Config{}, errors.New("hex-pattern cannot be combined with context lines, -L, -also-filenames, -file-events, -file-stats, or -z")
+		}
+		if *matchFilter != "" || *minEntropy > 0 || *redact || *maxCount > 0 {
+			return Config{}, errors.New("hex-pattern cannot be combined with -match-filter, -min-entropy, -redact, or -m")
+		}
+		if format != "plain" && format != "json" {
+			return Config{}, errors.New("hex-pattern requires -format plain, json, or json-array")
+		}
+	}
+
+	replace := explicit["replace"]
+	if replace {
+		if hexNeedle != nil || *overlapping || *redact {
+			return Config{}, errors.New("replace cannot be combined with -hex-pattern, -overlapping, or -redact")
+		}
+		if format != "plain" && format != "grep" && format != "json" {
+			return Config{}, errors.New("replace requires -format plain, grep, json, or json-array")
+		}
+	}
+
+	if *overlapping {
+		if *regexMode || hexNeedle != nil || len(patterns) > 1 {
+			return Config{}, errors.New("overlapping requires one literal pattern, not -regex, -hex-pattern, or several -e")
+		}
+		if *redact {
+			return Config{}, errors.New("overlapping cannot be combined with -redact")
+		}
+	}
+
+	errorsExitSet, err := parseErrorsExit(*errorsExit, format)
+	if err != nil {
+		return Config{}, err
+	}
+
+	if *baselineWrite && strings.TrimSpace(*baselinePath) == "" {
+		return Config{}, errors.New("baseline-write requires -baseline")
+	}
+	if *reproContent && strings.TrimSpace(*reproPath) == "" {
+		return Config{}, errors.New("repro-content requires -repro")
+	}
+
+	if *filesWithoutMatch && strings.TrimSpace(*baselinePath) != "" {
+		return Config{}, errors.New("-L cannot be combined with -baseline")
+	}
+
+	if *engine != "re2" && *engine != "pcre" {
+		return Config{}, errors.New("engine must be re2 or pcre")
+	}
+	if *engine == "pcre" && !*regexMode {
+		return Config{}, errors.New("engine pcre requires -regex")
+	}
+	if *pcreTimeoutMs < 1 {
+		return Config{}, errors.New("pcre-timeout-ms must be at least 1")
+	}
+
 	if *monitorIntervalMs < 10 {
 		return Config{}, errors.New("monitor-interval-ms must be at least 10")
 	}
@@ -229,45 +983,194 @@ func Parse(args []string) (Config, error) {
 	}
 
 	cfg := Config{
-		ConfigPath:        strings.TrimSpace(*configPath),
-		ShowVersion:       *showVersion,
-		CompletionTarget:  strings.TrimSpace(*completion),
-		VersionLabel:      VersionString(),
-		Pattern:           pattern,
-		RootPath:          rootPath,
-		IgnoreCase:        *ignoreCase,
-		ShowLineNumbers:   *showLineNumbers,
-		WholeWord:         *wholeWord,
-		Workers:           *workers,
-		MaxSizeBytes:      maxSizeBytes,
-		Extensions:        ParseCSVSet(*extensions, true),
-		ExcludeDirs:       excluded,
-		CountOnly:         *countOnly,
-		Quiet:             *quiet,
-		Color:             *color,
-		AbsPath:           *absPath,
-		OutputFormat:      format,
-		Regex:             *regexMode,
-		FollowSymlinks:    *followSymlinks,
-		MaxDepth:          *maxDepth,
-		DynamicWorkers:    *dynamicWorkers,
-		IOWorkers:         resolvedIOWorkers,
-		CPUWorkers:        resolvedCPUWorkers,
-		MaxWorkers:        resolvedMaxWorkers,
-		Backpressure:      resolvedBackpressure,
-		Metrics:           *metrics,
-		Debug:             *debug,
-		Trace:             *trace,
-		MonitorGoroutine:  *monitorGoroutines,
-		MonitorInterval:   time.Duration(*monitorIntervalMs) * time.Millisecond,
-		CPUProfilePath:    strings.TrimSpace(*cpuProfile),
-		MemProfilePath:    strings.TrimSpace(*memProfile),
-		DefaultIgnoreDirs: defaults,
+		ConfigPath:           strings.TrimSpace(*configPath),
+		ShowVersion:          *showVersion,
+		ShowJSONSchema:       *showJSONSchema,
+		CompletionTarget:     strings.TrimSpace(*completion),
+		VersionLabel:         VersionString(),
+		Pattern:              pattern,
+		Patterns:             patterns,
+		HexPattern:           hexNeedle,
+		NotPatterns:          notList,
+		FilesFrom:            fileLists,
+		FilesFromPrefix:      *filesFromPrefix,
+		RootPath:             rootPath,
+		IgnoreCase:           *ignoreCase,
+		ShowLineNumbers:      *showLineNumbers,
+		WholeWord:            *wholeWord,
+		Overlapping:          *overlapping,
+		MatchAll:             *matchAll && len(patterns) > 1,
+		Invert:               *invert,
+		FilesWithoutMatch:    *filesWithoutMatch,
+		ByteOffset:           *byteOffset || jsonEvents,
+		NullTerminate:        *nullTerminate,
+		FirstMatch:           *firstMatch,
+		MaxCount:             *maxCount,
+		MaxResults:           *maxResults,
+		ContextBefore:        *beforeContext,
+		ContextAfter:         *afterContext,
+		GroupSeparator:       *groupSeparator,
+		NoGroupSeparator:     *noGroupSeparator,
+		Workers:              *workers,
+		MaxSizeBytes:         maxSizeBytes,
+		Extensions:           ParseCSVSet(*extensions, true),
+		ExcludeDirs:          excluded,
+		CountOnly:            *countOnly,
+		CountMatches:         *countMatches,
+		Quiet:                *quiet,
+		QuietResults:         *quietResults,
+		ShowDuplicates:       *showDuplicates,
+		ColorMode:            colorMode,
+		Color:                colorMode == ColorAlways,
+		HyperlinkMode:        hyperlink.mode,
+		Hyperlink:            hyperlink.mode == ColorAlways,
+		HyperlinkFormat:      *hyperlinkFormat,
+		OutputPath:           strings.TrimSpace(*outputPath),
+		AbsPath:              *absPath,
+		OutputFormat:         format,
+		JSONArray:            jsonArray,
+		JSONEvents:           jsonEvents,
+		Template:             matchTemplate,
+		FileEvents:           *fileEvents,
+		FileStats:            *fileStats,
+		CombinedOutput:       *combinedOutput,
+		MaxColumns:           *maxColumns,
+		MaxColumnsOmit:       *maxColumnsOmit,
+		MaxColumnsJSON:       *maxColumnsJSON,
+		WithMetadata:         *withMetadata,
+		MaxPerDir:            *maxPerDir,
+		AutoSpill:            *autoSpill,
+		SplitOutput:          splitDir,
+		Sort:                 *sortOrder,
+		SortSpill:            *sortSpill,
+		Escape:               *escape,
+		JSONInvalidUTF8:      *jsonInvalidUTF8,
+		OffsetUnit:           *offsetUnit,
+		Ordered:              !*noSort && *sortOrder == "" && !*quiet,
+		AlsoFilenames:        *alsoFilenames,
+		FailOver:             *failOver,
+		FailUnder:            *failUnder,
+		ErrorsExit:           errorsExitSet,
+		BaselinePath:         strings.TrimSpace(*baselinePath),
+		BaselineWrite:        *baselineWrite,
+		Redact:               *redact,
+		Replace:              replace,
+		Replacement:          *replacement,
+		MinEntropy:           *minEntropy,
+		OnBadEncoding:        badEncodingMode,
+		Encoding:             charset,
+		Regex:                *regexMode,
+		Engine:               *engine,
+		PCRETimeout:          time.Duration(*pcreTimeoutMs) * time.Millisecond,
+		BinaryAsText:         hasNUL,
+		MatchFilter:          *matchFilter,
+		FollowSymlinks:       *followSymlinks,
+		StrictIgnore:         *strictIgnore,
+		MaxDepth:             *maxDepth,
+		WalkOrder:            *walkOrder,
+		RespectGitattributes: *respectGitattributes,
+		DynamicWorkers:       *dynamicWorkers,
+		IOWorkers:            resolvedIOWorkers,
+		CPUWorkers:           resolvedCPUWorkers,
+		SearchCompressed:     *searchCompressed,
+		MaxDecompressedBytes: maxDecompressedBytes,
+		DecompressWorkers:    resolvedDecompressWorkers,
+		MaxWorkers:           resolvedMaxWorkers,
+		Backpressure:         resolvedBackpressure,
+		Tune:                 *tune,
+		AutoIOWorkers:        *ioWorkers == 0,
+		AutoCPUWorkers:       *cpuWorkers == 0,
+		AutoBackpressure:     *backpressure == 0,
+		Metrics:              *metrics,
+		Stats:                *stats,
+		Progress:             progress.mode,
+		PlainNumbers:         *plainNumbers,
+		WhyEmpty:             *whyEmpty,
+		Debug:                *debug,
+		Trace:                *trace,
+		MonitorGoroutine:     *monitorGoroutines,
+		MonitorInterval:      time.Duration(*monitorIntervalMs) * time.Millisecond,
+		CPUProfilePath:       strings.TrimSpace(*cpuProfile),
+		MemProfilePath:       strings.TrimSpace(*memProfile),
+		StatsFile:            strings.TrimSpace(*statsFile),
+		CompareLast:          *compareLast,
+		MemLimitBytes:        memLimitBytes,
+		ReproPath:            strings.TrimSpace(*reproPath),
+		ReproContent:         *reproContent,
+		DefaultIgnoreDirs:    defaults,
+		FS:                   fsys.OS{},
+		Clock:                clock.Real{},
+		IgnoreCache:          ignore.NewCache(),
 	}
 
 	return cfg, nil
 }
 
+// NeedsFileMeta reports whether results must carry file metadata, for
+// -with-metadata or to sort by modification time or size.
+func (cfg Config) NeedsFileMeta() bool {
+	return cfg.WithMetadata || cfg.Sort == SortMtime || cfg.Sort == SortSize
+}
+
+// TracksOutcomes reports whether every file handed to IO workers must report
+// its outcome to the printer: -stats counts files without a match, and a
+// compared -baseline only resolves entries of files searched to the end.
+func (cfg Config) TracksOutcomes() bool {
+	return cfg.Stats || cfg.FileEvents || (cfg.BaselinePath != "" && !cfg.BaselineWrite)
+}
+
+// CollectsFileStats reports whether scanned files must be timed and counted:
+// for -file-stats, and for the end records of -format json-events.
+func (cfg Config) CollectsFileStats() bool {
+	return cfg.FileStats || cfg.JSONEvents
+}
+
+// HasThresholds reports whether -fail-over or -fail-under is set, which
+// requires a complete match count even under -quiet.
+func (cfg Config) HasThresholds() bool {
+	return cfg.FailOver >= 0 || cfg.FailUnder >= 0
+}
+
+// patternLiterals reports whether the pattern must match a newline or a NUL
+// byte. For regexes only literal characters count, not classes such as \s
+// that merely could match one; a regex that does not parse reports neither
+// and is rejected when it is compiled.
+func patternLiterals(pattern string, regex bool) (newline bool, nul bool) {
+	if !regex {
+		return strings.Contains(pattern, "\n"), strings.Contains(pattern, "\x00")
+	}
+	parsed, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return false, false
+	}
+	var walk func(*syntax.Regexp)
+	walk = func(node *syntax.Regexp) {
+		if node.Op == syntax.OpLiteral {
+			for _, r := range node.Rune {
+				newline = newline || r == '\n'
+				nul = nul || r == 0
+			}
+		}
+		for _, sub := range node.Sub {
+			walk(sub)
+		}
+	}
+	walk(parsed)
+	return newline, nul
+}
+
+// ErrRootNotDirectory is returned by CheckRoot when the search path is unusable.
+var ErrRootNotDirectory = errors.New("path must be a readable directory")
+
+// CheckRoot verifies that the search root is a directory in cfg.FS.
+func (cfg Config) CheckRoot() error {
+	info, err := cfg.FS.Stat(cfg.RootPath)
+	if err != nil || !info.IsDir() {
+		return ErrRootNotDirectory
+	}
+	return nil
+}
+
 func detectConfigPath(args []string) string {
 	defaultPath := ".gosearchrc"
 	for i := 0; i < len(args); i++ {
@@ -282,6 +1185,21 @@ func detectConfigPath(args []string) string {
 	return defaultPath
 }
 
+// StatsFileArg returns the -stats-file path args name, or else
+// $GOSEARCH_STATS_FILE, for recording runs whose arguments do not parse.
+func StatsFileArg(args []string) string {
+	for i := 0; i < len(args); i++ {
+		item := args[i]
+		if item == "-stats-file" && i+1 < len(args) {
+			return strings.TrimSpace(args[i+1])
+		}
+		if strings.HasPrefix(item, "-stats-file=") {
+			return strings.TrimSpace(strings.TrimPrefix(item, "-stats-file="))
+		}
+	}
+	return os.Getenv(StatsFileEnv)
+}
+
 func loadRCConfig(path string) (RCConfig, error) {
 	trimmed := strings.TrimSpace(path)
 	if trimmed == "" {
@@ -317,6 +1235,13 @@ func intWithDefault(value *int, fallback int) int {
 	return *value
 }
 
+func floatWithDefault(value *float64, fallback float64) float64 {
+	if value == nil {
+		return fallback
+	}
+	return *value
+}
+
 func stringWithDefault(value *string, fallback string) string {
 	if value == nil {
 		return fallback
@@ -379,9 +1304,55 @@ func ParseCSVSet(input string, normalizeExtension bool) map[string]struct{} {
 	return result
 }
 
+// errorCategories are the per-file error categories -errors-exit accepts.
+var errorCategories = []string{"permission", "not-found", "io", "too-large", "binary", "encoding", "timeout"}
+
+// parseErrorsExit resolves -errors-exit. Left empty, no category affects the
+// exit code, except with -format grep, where unreadable paths exit 2 as they
+// do for grep.
+func parseErrorsExit(input string, format string) (map[string]struct{}, error) {
+	input = strings.TrimSpace(input)
+	if input == "" && format == "grep" {
+		input = "permission,not-found,io,too-large"
+	}
+	selected := ParseCSVSet(input, false)
+	if _, ok := selected["none"]; ok {
+		if len(selected) > 1 {
+			return nil, errors.New("errors-exit none cannot be combined with categories")
+		}
+		return map[string]struct{}{}, nil
+	}
+	if _, ok := selected["all"]; ok {
+		delete(selected, "all")
+		for _, category := range errorCategories {
+			selected[category] = struct{}{}
+		}
+	}
+	for category := range selected {
+		if !slices.Contains(errorCategories, category) {
+			return nil, fmt.Errorf("errors-exit: unknown category %q (want %s, all, or none)", category, strings.Join(errorCategories, ", "))
+		}
+	}
+	return selected, nil
+}
+
 func maxInt(a int, b int) int {
 	if a > b {
 		return a
 	}
 	return b
 }
+
+// parseHexPattern decodes -hex-pattern, which may contain spaces between
+// bytes and a 0x prefix, and returns it normalized to upper-case hex.
+func parseHexPattern(input string) (string, []byte, error) {
+	digits := strings.Join(strings.Fields(input), "")
+	if len(digits) > 1 && (digits[:2] == "0x" || digits[:2] == "0X") {
+		digits = digits[2:]
+	}
+	needle, err := hex.DecodeString(digits)
+	if err != nil || len(needle) == 0 {
+		return "", nil, fmt.Errorf("hex-pattern must be a non-empty sequence of hex byte pairs, got %q", input)
+	}
+	return strings.ToUpper(digits), needle, nil
+}
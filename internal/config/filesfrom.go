@@ -0,0 +1,115 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Duplicate handling for paths named by more than one -files-from list.
+const (
+	// FilesFromFirst attributes a path to the first list naming it.
+	FilesFromFirst = "first"
+	// FilesFromAll attributes a path to every list naming it.
+	FilesFromAll = "all"
+)
+
+// FileSource is one -files-from list and its label.
+type FileSource struct {
+	Label string
+	Path  string
+}
+
+// fileSourcesFlag collects repeated -files-from label=path arguments. A bare
+// path is labelled with itself.
+type fileSourcesFlag struct {
+	sources []FileSource
+}
+
+func (flag *fileSourcesFlag) String() string {
+	items := make([]string, len(flag.sources))
+	for i, source := range flag.sources {
+		items[i] = source.Label + "=" + source.Path
+	}
+	return strings.Join(items, " ")
+}
+
+func (flag *fileSourcesFlag) Set(value string) error {
+	label, path, found := strings.Cut(value, "=")
+	if !found {
+		label, path = value, value
+	}
+	label, path = strings.TrimSpace(label), strings.TrimSpace(path)
+	if label == "" || path == "" {
+		return errors.New("files-from must be label=path")
+	}
+	if strings.Contains(label, ",") {
+		return fmt.Errorf("files-from label %q must not contain a comma", label)
+	}
+	for _, source := range flag.sources {
+		if source.Label == label {
+			return fmt.Errorf("files-from label %q given twice", label)
+		}
+	}
+	flag.sources = append(flag.sources, FileSource{Label: label, Path: path})
+	return nil
+}
+
+// FileLists is the set of files to search assembled from -files-from lists,
+// which replaces walking <path>.
+type FileLists struct {
+	// Paths holds each listed file once, in the order the lists name them.
+	Paths []string
+	// Labels holds the labels a path is attributed to: only the first list
+	// naming it, or with -files-from-dedup all every one, in list order.
+	Labels map[string][]string
+	// Order is every label in the order the lists were given.
+	Order []string
+}
+
+// Label returns the labels of path joined by commas, or "" for a path no
+// list named.
+func (lists *FileLists) Label(path string) string {
+	if lists == nil {
+		return ""
+	}
+	return strings.Join(lists.Labels[path], ",")
+}
+
+// loadFileLists reads every -files-from list. A list that contains a NUL
+// byte is NUL-separated, as written by find -print0 or git ls-files -z;
+// otherwise it has one path per line. Empty entries are skipped and paths
+// are cleaned, so ./a and a are the same file.
+func loadFileLists(sources []FileSource, dedup string) (*FileLists, error) {
+	lists := &FileLists{Labels: make(map[string][]string)}
+	for _, source := range sources {
+		lists.Order = append(lists.Order, source.Label)
+		data, err := os.ReadFile(source.Path)
+		if err != nil {
+			return nil, fmt.Errorf("files-from %s: %w", source.Label, err)
+		}
+		separator := []byte("\n")
+		if bytes.IndexByte(data, 0) >= 0 {
+			separator = []byte{0}
+		}
+		for _, entry := range bytes.Split(data, separator) {
+			entry = bytes.TrimSuffix(entry, []byte("\r"))
+			if len(entry) == 0 {
+				continue
+			}
+			path := filepath.Clean(string(entry))
+			labels, seen := lists.Labels[path]
+			switch {
+			case !seen:
+				lists.Paths = append(lists.Paths, path)
+			case dedup == FilesFromFirst || labels[len(labels)-1] == source.Label:
+				continue
+			}
+			lists.Labels[path] = append(labels, source.Label)
+		}
+	}
+	return lists, nil
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// PatternInput supplies the pattern when it is not on the command line:
+// Stdin for -stdin-pattern, and Prompt, when gosearch runs interactively,
+// for a bare `gosearch <path>`. The zero value supplies neither, as Parse
+// does.
+type PatternInput struct {
+	Stdin  io.Reader
+	Prompt func() (string, error)
+}
+
+// errNoTerminal means there is no terminal to prompt on after all, and the
+// missing pattern is a usage error.
+var errNoTerminal = errors.New("no terminal")
+
+// PromptPattern asks for a pattern on the controlling terminal, so the
+// prompt shows even when stdout and stderr are redirected, and returns the
+// line typed.
+func PromptPattern() (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", errNoTerminal
+	}
+	defer tty.Close()
+	fmt.Fprint(tty, "pattern: ")
+	pattern, _, err := readPatternLine(tty)
+	return pattern, err
+}
+
+// readPatternLine reads the first line of reader without its terminator,
+// and reports whether there was one.
+func readPatternLine(reader io.Reader) (string, bool, error) {
+	if reader == nil {
+		return "", false, nil
+	}
+	line, err := bufio.NewReader(reader).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", false, err
+	}
+	if line == "" {
+		return "", false, nil
+	}
+	return strings.TrimRight(line, "\r\n"), true, nil
+}
+
+// patternsFlag collects the patterns given with -e, in order.
+type patternsFlag []string
+
+func (flag *patternsFlag) String() string {
+	return strings.Join(*flag, " ")
+}
+
+func (flag *patternsFlag) Set(value string) error {
+	*flag = append(*flag, value)
+	return nil
+}
+
+// supplyPattern puts the pattern in front of the positional arguments when
+// -stdin-pattern reads it, or when it is missing and input can prompt for
+// it. pathsOnly is how many arguments there are without a pattern.
+func supplyPattern(remaining []string, pathsOnly int, stdinPattern bool, input PatternInput) ([]string, error) {
+	if stdinPattern {
+		if len(remaining) != pathsOnly {
+			return nil, errors.New("stdin-pattern replaces <pattern>: expected only <path>")
+		}
+		pattern, ok, err := readPatternLine(input.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("stdin-pattern: %w", err)
+		}
+		if !ok {
+			return nil, errors.New("stdin-pattern: no pattern on standard input")
+		}
+		return append([]string{pattern}, remaining...), nil
+	}
+	if len(remaining) != pathsOnly || input.Prompt == nil {
+		return remaining, nil
+	}
+	pattern, err := input.Prompt()
+	if errors.Is(err, errNoTerminal) {
+		return remaining, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("pattern prompt: %w", err)
+	}
+	return append([]string{pattern}, remaining...), nil
+}
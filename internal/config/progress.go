@@ -0,0 +1,59 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Modes for -progress. Counts shows how much has been searched so far; full
+// and estimate first count what there is to search, exactly or within a time
+// budget, to show percent complete and an ETA.
+const (
+	ProgressCounts   = "counts"
+	ProgressFull     = "full"
+	ProgressEstimate = "estimate"
+)
+
+// progressFlag is -progress. Like a modeFlag it is also a boolean flag: a
+// bare -progress (or =true) selects counts, and =false turns it off.
+type progressFlag struct {
+	mode string
+}
+
+// newProgressFlag creates a progressFlag that is off, or set to the
+// .gosearchrc value rc when there is one.
+func newProgressFlag(rc *rcMode) (*progressFlag, error) {
+	flag := &progressFlag{}
+	if rc != nil {
+		if err := flag.Set(string(*rc)); err != nil {
+			return nil, fmt.Errorf("config: %w", err)
+		}
+	}
+	return flag, nil
+}
+
+func (flag *progressFlag) String() string { return flag.mode }
+
+func (flag *progressFlag) IsBoolFlag() bool { return true }
+
+func (flag *progressFlag) modes() []string {
+	return []string{ProgressCounts, ProgressFull, ProgressEstimate}
+}
+
+func (flag *progressFlag) Set(value string) error {
+	switch value {
+	case ProgressCounts, ProgressFull, ProgressEstimate:
+		flag.mode = value
+		return nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return errors.New("progress must be counts, full, or estimate")
+	}
+	flag.mode = ""
+	if enabled {
+		flag.mode = ProgressCounts
+	}
+	return nil
+}
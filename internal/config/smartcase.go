@@ -0,0 +1,55 @@
+package config
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// hasUppercaseLiteral reports whether pattern spells out an uppercase
+// letter, for -smart-case. In a regex only letters that match themselves
+// count, including those in a character class such as [A-Z]; the letters
+// of escapes (\W, \pL, \p{Lu}, \xAB), flags ((?U)), and group names
+// ((?P<Name>...)) do not. Letters quoted with \Q...\E count.
+func hasUppercaseLiteral(pattern string, regex bool) bool {
+	if !regex {
+		return strings.ContainsFunc(pattern, unicode.IsUpper)
+	}
+	for i := 0; i < len(pattern); {
+		r, size := utf8.DecodeRuneInString(pattern[i:])
+		i += size
+		switch {
+		case r == '\\' && i < len(pattern):
+			r, size = utf8.DecodeRuneInString(pattern[i:])
+			i += size
+			switch {
+			case (r == 'p' || r == 'P' || r == 'x') && strings.HasPrefix(pattern[i:], "{"):
+				end := strings.IndexByte(pattern[i:], '}')
+				if end < 0 {
+					return false
+				}
+				i += end + 1
+			case r == 'p' || r == 'P':
+				i++
+			case r == 'x':
+				i += 2
+			case r == 'Q':
+				quoted := pattern[i:]
+				if end := strings.Index(quoted, `\E`); end >= 0 {
+					quoted = quoted[:end]
+				}
+				if strings.ContainsFunc(quoted, unicode.IsUpper) {
+					return true
+				}
+				i += len(quoted)
+			}
+		case r == '(' && strings.HasPrefix(pattern[i:], "?"):
+			if end := strings.IndexAny(pattern[i:], ":)>"); end >= 0 {
+				i += end + 1
+			}
+		case unicode.IsUpper(r):
+			return true
+		}
+	}
+	return false
+}
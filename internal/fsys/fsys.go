@@ -0,0 +1,58 @@
+// Package fsys is the filesystem surface gosearch reads through. The walker,
+// IO workers, and ignore-rule loader use an FS rather than the os package so
+// tests can substitute an in-memory tree and inject faults.
+package fsys
+
+import (
+	"io"
+	"io/fs"
+	"os"
+)
+
+// FS opens, lists, and stats files by OS path.
+type FS interface {
+	Open(name string) (File, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Stat(name string) (fs.FileInfo, error)
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// File is an open file. Seek lets readers rewind after sniffing content.
+type File interface {
+	fs.File
+	io.Seeker
+}
+
+// OS is the real filesystem.
+type OS struct{}
+
+// Open opens name for reading.
+func (OS) Open(name string) (File, error) {
+	return os.Open(name)
+}
+
+// ReadDir lists name sorted by entry name, using the fastest reader the
+// platform has.
+func (OS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return readDir(name)
+}
+
+// Stat follows symlinks.
+func (OS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// Lstat does not follow symlinks.
+func (OS) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+// ReadFile reads the whole of name from filesystem.
+func ReadFile(filesystem FS, name string) ([]byte, error) {
+	file, err := filesystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
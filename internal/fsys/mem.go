@@ -0,0 +1,237 @@
+package fsys
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Op names an FS operation for fault injection.
+type Op string
+
+// Operations Mem can fail.
+const (
+	OpOpen    Op = "open"
+	OpReadDir Op = "readdir"
+	OpStat    Op = "stat"
+	OpLstat   Op = "lstat"
+	// OpRead fails reads of a file that opened successfully.
+	OpRead Op = "read"
+)
+
+// Mem is an in-memory FS for tests. Directories are implied by the files
+// written into them, and Fail makes individual operations on a path return an
+// error, which simulates permission denials, descriptor exhaustion, and files
+// vanishing between listing and opening. Each write advances the file's
+// modification time by a second, so mtime-keyed caches see edits. It is safe
+// for concurrent use.
+type Mem struct {
+	mu       sync.Mutex
+	files    map[string][]byte
+	sizes    map[string]int64
+	modTimes map[string]time.Time
+	dirs     map[string]struct{}
+	faults   map[Op]map[string]error
+	modTime  time.Time
+}
+
+// NewMem creates an empty in-memory filesystem.
+func NewMem() *Mem {
+	return &Mem{
+		files:    make(map[string][]byte),
+		sizes:    make(map[string]int64),
+		modTimes: make(map[string]time.Time),
+		dirs:     make(map[string]struct{}),
+		faults:   make(map[Op]map[string]error),
+		modTime:  time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// WriteFile adds or replaces a file, creating its parent directories.
+func (mem *Mem) WriteFile(name string, data []byte) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	name = filepath.Clean(name)
+	mem.files[name] = append([]byte(nil), data...)
+	mem.modTime = mem.modTime.Add(time.Second)
+	mem.modTimes[name] = mem.modTime
+	mem.addDirsLocked(filepath.Dir(name))
+}
+
+// SetSize makes an existing file report size instead of its length, so a
+// replayed tree can keep the sizes of files whose contents it does not hold.
+func (mem *Mem) SetSize(name string, size int64) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	mem.sizes[filepath.Clean(name)] = size
+}
+
+// Mkdir adds an empty directory and its parents.
+func (mem *Mem) Mkdir(name string) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	mem.addDirsLocked(filepath.Clean(name))
+}
+
+// Fail makes op on name return err until cleared with a nil err.
+func (mem *Mem) Fail(op Op, name string, err error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	name = filepath.Clean(name)
+	if err == nil {
+		delete(mem.faults[op], name)
+		return
+	}
+	if mem.faults[op] == nil {
+		mem.faults[op] = make(map[string]error)
+	}
+	mem.faults[op][name] = err
+}
+
+// Open opens a file or directory.
+func (mem *Mem) Open(name string) (File, error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	name = filepath.Clean(name)
+	if err := mem.faultLocked(OpOpen, name); err != nil {
+		return nil, err
+	}
+	info, err := mem.statLocked("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return &memFile{Reader: bytes.NewReader(mem.files[name]), info: info, readErr: mem.faultLocked(OpRead, name)}, nil
+}
+
+// ReadDir lists a directory in name order.
+func (mem *Mem) ReadDir(name string) ([]fs.DirEntry, error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	name = filepath.Clean(name)
+	if err := mem.faultLocked(OpReadDir, name); err != nil {
+		return nil, err
+	}
+	if _, ok := mem.dirs[name]; !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	entries := make([]fs.DirEntry, 0)
+	for child := range mem.dirs {
+		if child != name && filepath.Dir(child) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(memInfo{name: filepath.Base(child), dir: true, modTime: mem.modTime}))
+		}
+	}
+	for child := range mem.files {
+		if filepath.Dir(child) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(mem.fileInfoLocked(child)))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// Stat describes a file or directory.
+func (mem *Mem) Stat(name string) (fs.FileInfo, error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	name = filepath.Clean(name)
+	if err := mem.faultLocked(OpStat, name); err != nil {
+		return nil, err
+	}
+	return mem.statLocked("stat", name)
+}
+
+// Lstat is Stat; Mem has no symlinks.
+func (mem *Mem) Lstat(name string) (fs.FileInfo, error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	name = filepath.Clean(name)
+	if err := mem.faultLocked(OpLstat, name); err != nil {
+		return nil, err
+	}
+	return mem.statLocked("lstat", name)
+}
+
+func (mem *Mem) addDirsLocked(name string) {
+	for {
+		mem.dirs[name] = struct{}{}
+		parent := filepath.Dir(name)
+		if parent == name {
+			return
+		}
+		name = parent
+	}
+}
+
+func (mem *Mem) faultLocked(op Op, name string) error {
+	if err, ok := mem.faults[op][name]; ok {
+		return &fs.PathError{Op: string(op), Path: name, Err: err}
+	}
+	return nil
+}
+
+func (mem *Mem) statLocked(op string, name string) (fs.FileInfo, error) {
+	if _, ok := mem.files[name]; ok {
+		return mem.fileInfoLocked(name), nil
+	}
+	if _, ok := mem.dirs[name]; ok {
+		return memInfo{name: filepath.Base(name), dir: true, modTime: mem.modTime}, nil
+	}
+	return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+func (mem *Mem) fileInfoLocked(name string) memInfo {
+	size, ok := mem.sizes[name]
+	if !ok {
+		size = int64(len(mem.files[name]))
+	}
+	return memInfo{name: filepath.Base(name), size: size, modTime: mem.modTimes[name]}
+}
+
+type memFile struct {
+	*bytes.Reader
+	info    fs.FileInfo
+	readErr error
+}
+
+func (file *memFile) Read(p []byte) (int, error) {
+	if file.readErr != nil {
+		return 0, file.readErr
+	}
+	return file.Reader.Read(p)
+}
+
+func (file *memFile) WriteTo(w io.Writer) (int64, error) {
+	if file.readErr != nil {
+		return 0, file.readErr
+	}
+	return file.Reader.WriteTo(w)
+}
+
+func (file *memFile) Stat() (fs.FileInfo, error) { return file.info, nil }
+
+func (file *memFile) Close() error { return nil }
+
+type memInfo struct {
+	name    string
+	size    int64
+	dir     bool
+	modTime time.Time
+}
+
+func (info memInfo) Name() string       { return info.name }
+func (info memInfo) Size() int64        { return info.size }
+func (info memInfo) ModTime() time.Time { return info.modTime }
+func (info memInfo) IsDir() bool        { return info.dir }
+func (info memInfo) Sys() any           { return nil }
+
+func (info memInfo) Mode() fs.FileMode {
+	if info.dir {
+		return fs.ModeDir | 0o755
+	}
+	return 0o644
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package fsys
+
+import (
+	"io/fs"
+	"os"
+)
+
+// readDir lists a directory. Platforms without a raw fast path use os.ReadDir.
+func readDir(dir string) ([]fs.DirEntry, error) {
+	return os.ReadDir(dir)
+}
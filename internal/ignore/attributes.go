@@ -0,0 +1,178 @@
+package ignore
+
+import (
+	"bufio"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/vennictus/gosearch/internal/fsys"
+)
+
+// Attribute names that -respect-gitattributes treats as skip hints.
+const (
+	AttrLinguistGenerated = "linguist-generated"
+	AttrExportIgnore      = "export-ignore"
+)
+
+// AttrState is the value a .gitattributes line assigns to an attribute.
+type AttrState int
+
+const (
+	// AttrUnspecified leaves the attribute to earlier lines (or clears it with "!attr").
+	AttrUnspecified AttrState = iota
+	// AttrSet is "attr" or "attr=true".
+	AttrSet
+	// AttrUnset is "-attr" or "attr=false".
+	AttrUnset
+)
+
+// AttrRule is one .gitattributes line, reduced to the attributes gosearch reads.
+type AttrRule struct {
+	BaseDir   string
+	Pattern   string
+	HasPath   bool
+	Generated AttrState
+	Export    AttrState
+	// Reset records "!attr" lines, which return an attribute to unspecified.
+	ResetGenerated bool
+	ResetExport    bool
+}
+
+// LoadAttributes loads .gitattributes rules from currentDir, appended after the
+// inherited rules so that deeper and later lines take precedence.
+func LoadAttributes(filesystem fsys.FS, cache *Cache, currentDir string, inherited []AttrRule) ([]AttrRule, error) {
+	parsed, exists, err := cache.load(filesystem, filepath.Join(currentDir, ".gitattributes"), attrParser(currentDir))
+	if !exists {
+		return inherited, err
+	}
+
+	rules := make([]AttrRule, 0, len(inherited)+len(parsed.attrs))
+	rules = append(rules, inherited...)
+	rules = append(rules, parsed.attrs...)
+	return rules, err
+}
+
+// attrParser parses one .gitattributes file whose patterns are relative to
+// baseDir.
+func attrParser(baseDir string) func(io.Reader) (parsedFile, error) {
+	return func(reader io.Reader) (parsedFile, error) {
+		var parsed parsedFile
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+				continue
+			}
+			// Negative patterns are forbidden and macro definitions carry no
+			// path; git ignores both for matching purposes.
+			if strings.HasPrefix(fields[0], "!") || strings.HasPrefix(fields[0], "[attr]") {
+				continue
+			}
+
+			rule := AttrRule{BaseDir: baseDir, Pattern: fields[0], HasPath: strings.Contains(fields[0], "/")}
+			for _, attr := range fields[1:] {
+				name, state, reset := parseAttr(attr)
+				switch name {
+				case AttrLinguistGenerated:
+					rule.Generated, rule.ResetGenerated = state, reset
+				case AttrExportIgnore:
+					rule.Export, rule.ResetExport = state, reset
+				}
+			}
+			if rule.Generated == AttrUnspecified && rule.Export == AttrUnspecified && !rule.ResetGenerated && !rule.ResetExport {
+				continue
+			}
+			parsed.attrs = append(parsed.attrs, rule)
+		}
+		return parsed, scanner.Err()
+	}
+}
+
+func parseAttr(attr string) (string, AttrState, bool) {
+	switch {
+	case strings.HasPrefix(attr, "-"):
+		return attr[1:], AttrUnset, false
+	case strings.HasPrefix(attr, "!"):
+		return attr[1:], AttrUnspecified, true
+	}
+	name, value, hasValue := strings.Cut(attr, "=")
+	if hasValue && (value == "false" || value == "0") {
+		return name, AttrUnset, false
+	}
+	return name, AttrSet, false
+}
+
+// AttributeSkip returns the attribute that marks fullPath as skippable, or ""
+// when neither linguist-generated nor export-ignore is set for it.
+func AttributeSkip(rules []AttrRule, fullPath string) string {
+	generated := AttrUnspecified
+	export := AttrUnspecified
+	for _, rule := range rules {
+		rel, err := filepath.Rel(rule.BaseDir, fullPath)
+		if err != nil {
+			continue
+		}
+		relSlash := filepath.ToSlash(rel)
+		if relSlash == "." || strings.HasPrefix(relSlash, "../") {
+			continue
+		}
+		if !AttrPatternMatch(rule.Pattern, relSlash) {
+			continue
+		}
+		if rule.Generated != AttrUnspecified || rule.ResetGenerated {
+			generated = rule.Generated
+		}
+		if rule.Export != AttrUnspecified || rule.ResetExport {
+			export = rule.Export
+		}
+	}
+
+	if generated == AttrSet {
+		return AttrLinguistGenerated
+	}
+	if export == AttrSet {
+		return AttrExportIgnore
+	}
+	return ""
+}
+
+// AttrPatternMatch reports whether a .gitattributes pattern matches relSlash,
+// a slash-separated path relative to the attributes file. Unlike gitignore, a
+// pattern naming a directory does not match the files under it ("dir/**" is
+// needed for that), and a trailing slash never matches anything.
+func AttrPatternMatch(pattern string, relSlash string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		return false
+	}
+	if !strings.Contains(pattern, "/") {
+		return globMatch(pattern, path.Base(relSlash))
+	}
+	return matchSegments(strings.Split(strings.TrimPrefix(pattern, "/"), "/"), strings.Split(relSlash, "/"))
+}
+
+// matchSegments matches path segments against pattern segments, where a "**"
+// segment spans zero or more path segments.
+func matchSegments(pattern []string, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			if len(rest) == 0 {
+				return len(segments) > 0
+			}
+			for skip := 0; skip <= len(segments); skip++ {
+				if matchSegments(rest, segments[skip:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 || !globMatch(pattern[0], segments[0]) {
+			return false
+		}
+		pattern = pattern[1:]
+		segments = segments[1:]
+	}
+	return len(segments) == 0
+}
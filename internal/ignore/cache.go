@@ -0,0 +1,98 @@
+package ignore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vennictus/gosearch/internal/fsys"
+)
+
+// Cache holds parsed ignore and attributes files keyed by path, each entry
+// valid while the file keeps the modification time and size it was parsed
+// with. It is safe for concurrent use, so walkers and repeated searches can
+// share one. A nil *Cache parses every file on each load.
+type Cache struct {
+	mu      sync.Mutex
+	entries map[string]cachedFile
+
+	// Hits and Misses count loads of existing files served from the cache
+	// and parsed afresh.
+	Hits   atomic.Int64
+	Misses atomic.Int64
+}
+
+// parsedFile is what gosearch reads from one ignore or attributes file.
+type parsedFile struct {
+	rules []Rule
+	prune bool
+	attrs []AttrRule
+}
+
+type cachedFile struct {
+	modTime time.Time
+	size    int64
+	parsed  parsedFile
+}
+
+// NewCache creates an empty cache.
+func NewCache() *Cache {
+	return &Cache{entries: make(map[string]cachedFile)}
+}
+
+// load returns the parsed contents of the file at path and whether it
+// exists. Errors are prefixed with the path.
+func (cache *Cache) load(filesystem fsys.FS, path string, parse func(io.Reader) (parsedFile, error)) (parsedFile, bool, error) {
+	if cache == nil {
+		return parseFile(filesystem, path, parse)
+	}
+
+	info, err := filesystem.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return parsedFile{}, false, nil
+		}
+		return parsedFile{}, false, fmt.Errorf("%s: %w", path, err)
+	}
+
+	cache.mu.Lock()
+	entry, ok := cache.entries[path]
+	cache.mu.Unlock()
+	if ok && entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+		cache.Hits.Add(1)
+		return entry.parsed, true, nil
+	}
+
+	cache.Misses.Add(1)
+	parsed, exists, err := parseFile(filesystem, path, parse)
+	if err != nil || !exists {
+		return parsed, exists, err
+	}
+	// Keyed on the stat taken before reading, so a file rewritten while it
+	// was parsed is parsed again on the next load.
+	cache.mu.Lock()
+	cache.entries[path] = cachedFile{modTime: info.ModTime(), size: info.Size(), parsed: parsed}
+	cache.mu.Unlock()
+	return parsed, true, nil
+}
+
+func parseFile(filesystem fsys.FS, path string, parse func(io.Reader) (parsedFile, error)) (parsedFile, bool, error) {
+	file, err := filesystem.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return parsedFile{}, false, nil
+		}
+		return parsedFile{}, false, fmt.Errorf("%s: %w", path, err)
+	}
+	defer file.Close()
+
+	parsed, err := parse(file)
+	if err != nil {
+		return parsed, true, fmt.Errorf("%s: %w", path, err)
+	}
+	return parsed, true, nil
+}
@@ -3,12 +3,15 @@ package ignore
 
 import (
 	"bufio"
-	"errors"
-	"fmt"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"unicode"
+
+	"github.com/vennictus/gosearch/internal/fsys"
 )
 
 // Rule represents a single ignore rule from .gitignore or .gosearchignore.
@@ -18,26 +21,77 @@ type Rule struct {
 	Negate  bool
 	DirOnly bool
 	HasPath bool
+	// Source is the "file:line" the rule was read from.
+	Source string
+}
+
+// String describes the rule as its source and original line, for -repro.
+func (rule Rule) String() string {
+	text := rule.Pattern
+	if rule.Negate {
+		text = "!" + text
+	}
+	if rule.DirOnly {
+		text += "/"
+	}
+	return rule.Source + ": " + text
+}
+
+// PruneDirective is the .gosearchignore line that stops traversal of its directory.
+const PruneDirective = "!!prune"
+
+// PruneMarkerFile is a file whose presence stops traversal of its directory.
+const PruneMarkerFile = ".gosearchprune"
+
+// HasPruneMarkerFile reports whether a directory listing holds a
+// .gosearchprune file. The walk checks the entries it has already read, so
+// the marker costs no extra stat.
+func HasPruneMarkerFile(entries []os.DirEntry) bool {
+	for _, entry := range entries {
+		if entry.Name() == PruneMarkerFile {
+			return true
+		}
+	}
+	return false
 }
 
-// LoadRules loads ignore rules from the current directory, merging with inherited rules.
-func LoadRules(currentDir string, inherited []Rule) ([]Rule, error) {
+// LoadRules loads ignore rules from the current directory, merging with
+// inherited rules. It also reports whether the directory's .gosearchignore
+// has a !!prune line, which opts the directory out of traversal regardless
+// of inherited negations.
+func LoadRules(filesystem fsys.FS, cache *Cache, currentDir string, inherited []Rule) ([]Rule, bool, error) {
 	rules := make([]Rule, 0, len(inherited)+8)
 	rules = append(rules, inherited...)
 
+	prune := false
 	for _, fileName := range []string{".gitignore", ".gosearchignore"} {
-		pathToIgnore := filepath.Join(currentDir, fileName)
-		file, err := os.Open(pathToIgnore)
+		path := filepath.Join(currentDir, fileName)
+		parsed, _, err := cache.load(filesystem, path, ruleParser(currentDir, path))
+		rules = append(rules, parsed.rules...)
+		if fileName == ".gosearchignore" {
+			prune = parsed.prune
+		}
 		if err != nil {
-			if errors.Is(err, os.ErrNotExist) {
-				continue
-			}
-			return rules, fmt.Errorf("%s: %w", pathToIgnore, err)
+			return rules, prune, err
 		}
+	}
+	return rules, prune, nil
+}
 
-		scanner := bufio.NewScanner(file)
+// ruleParser parses the ignore file at source, whose rules are relative to
+// baseDir.
+func ruleParser(baseDir string, source string) func(io.Reader) (parsedFile, error) {
+	return func(reader io.Reader) (parsedFile, error) {
+		var parsed parsedFile
+		scanner := bufio.NewScanner(reader)
+		lineNumber := 0
 		for scanner.Scan() {
-			line := strings.TrimSpace(scanner.Text())
+			lineNumber++
+			line := trimRuleLine(scanner.Text())
+			if line == PruneDirective {
+				parsed.prune = true
+				continue
+			}
 			if line == "" || strings.HasPrefix(line, "#") {
 				continue
 			}
@@ -56,34 +110,56 @@ func LoadRules(currentDir string, inherited []Rule) ([]Rule, error) {
 				continue
 			}
 
-			rules = append(rules, Rule{
-				BaseDir: currentDir,
+			parsed.rules = append(parsed.rules, Rule{
+				BaseDir: baseDir,
 				Pattern: line,
 				Negate:  negate,
 				DirOnly: dirOnly,
 				HasPath: strings.Contains(line, "/"),
+				Source:  source + ":" + strconv.Itoa(lineNumber),
 			})
 		}
-		if err := scanner.Err(); err != nil {
-			_ = file.Close()
-			return rules, fmt.Errorf("%s: %w", pathToIgnore, err)
+		return parsed, scanner.Err()
+	}
+}
+
+// trimRuleLine trims the space around an ignore file line, keeping a
+// trailing space escaped with a backslash, as git does: `name\ ` matches a
+// file whose name ends in a space. Patterns, like the names they match, are
+// otherwise taken byte for byte.
+func trimRuleLine(line string) string {
+	left := strings.TrimLeftFunc(line, unicode.IsSpace)
+	trimmed := strings.TrimRightFunc(left, unicode.IsSpace)
+	if len(trimmed) < len(left) && left[len(trimmed)] == ' ' {
+		backslashes := len(trimmed) - len(strings.TrimRight(trimmed, `\`))
+		if backslashes%2 == 1 {
+			trimmed = left[:len(trimmed)+1]
 		}
-		_ = file.Close()
 	}
-	return rules, nil
+	return trimmed
 }
 
 // ShouldIgnore checks if a path should be ignored based on the rules and default ignore dirs.
 func ShouldIgnore(defaultIgnoreDirs map[string]struct{}, rules []Rule, fullPath string, isDir bool) bool {
+	ignored, _ := MatchingRule(defaultIgnoreDirs, rules, fullPath, isDir)
+	return ignored
+}
+
+// MatchingRule is ShouldIgnore that also returns the rule that decided an
+// ignored path. The rule is nil for directories on the default ignore list.
+// It evaluates every rule against the path; the walker matches a directory's
+// entries through a RuleSet instead.
+func MatchingRule(defaultIgnoreDirs map[string]struct{}, rules []Rule, fullPath string, isDir bool) (bool, *Rule) {
 	name := strings.ToLower(filepath.Base(fullPath))
 	if isDir {
 		if _, blocked := defaultIgnoreDirs[name]; blocked {
-			return true
+			return true, nil
 		}
 	}
 
 	ignored := false
-	for _, rule := range rules {
+	var decided *Rule
+	for i, rule := range rules {
 		if rule.DirOnly && !isDir {
 			continue
 		}
@@ -93,25 +169,25 @@ func ShouldIgnore(defaultIgnoreDirs map[string]struct{}, rules []Rule, fullPath
 			continue
 		}
 		relSlash := filepath.ToSlash(rel)
-		if relSlash == "." || strings.HasPrefix(relSlash, "../") {
+		if relSlash == "." || relSlash == ".." || strings.HasPrefix(relSlash, "../") {
 			continue
 		}
 
 		if ruleMatch(rule, relSlash) {
 			ignored = !rule.Negate
+			decided = &rules[i]
 		}
 	}
-	return ignored
+	if !ignored {
+		return false, nil
+	}
+	return true, decided
 }
 
 func ruleMatch(rule Rule, relSlash string) bool {
 	patternText := strings.ReplaceAll(rule.Pattern, "**", "*")
 	if rule.HasPath {
-		if globMatch(patternText, relSlash) {
-			return true
-		}
-		prefix := strings.TrimSuffix(patternText, "/") + "/"
-		return strings.HasPrefix(relSlash, prefix)
+		return pathRuleMatch(patternText, relSlash)
 	}
 
 	for _, segment := range strings.Split(relSlash, "/") {
@@ -122,6 +198,16 @@ func ruleMatch(rule Rule, relSlash string) bool {
 	return false
 }
 
+// pathRuleMatch matches a rule with a slash against a whole relative path,
+// which it also matches when it names one of the path's directories.
+func pathRuleMatch(patternText string, relSlash string) bool {
+	return globMatch(patternText, relSlash) || strings.HasPrefix(relSlash, pathRulePrefix(patternText))
+}
+
+func pathRulePrefix(patternText string) string {
+	return strings.TrimSuffix(patternText, "/") + "/"
+}
+
 func globMatch(patternText string, value string) bool {
 	matched, err := path.Match(patternText, value)
 	if err != nil {
@@ -0,0 +1,249 @@
+package ignore
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// RuleSet is a rule list prepared for matching the entries of one directory.
+// MatchingRule relates every rule to every path it is asked about; a RuleSet
+// does that path math once per ignore file when the directory is opened,
+// settles the rules that match whatever the entry is called, and buckets the
+// rest so that plain names and *.ext globs, the bulk of most ignore files,
+// are map lookups. Its decisions are MatchingRule's, last match winning.
+type RuleSet struct {
+	rules []Rule
+	index *ruleIndex
+	// relDirs holds the directory relative to each base of the index, or ""
+	// when the directory is not inside it.
+	relDirs []string
+	// always holds the last rule matching every file and every directory
+	// entry, or -1.
+	always [2]int
+	// paths holds the path rules that may match an entry, descending.
+	paths []pathCandidate
+}
+
+// pathCandidate is a path rule whose leading segments match the directory,
+// so only its last segment is left to match the entry's name. Patterns with
+// classes or escapes, which can match a slash, are matched whole.
+type pathCandidate struct {
+	rule  int
+	name  string
+	whole bool
+}
+
+// ruleIndex buckets a rule list by how its rules match. It depends only on
+// the rules, so a directory that adds none shares its parent's.
+type ruleIndex struct {
+	// patterns holds each rule's pattern with ** collapsed to *.
+	patterns []string
+	// bases holds the BaseDir of each run of rules read from one file, and
+	// baseOf the run of each rule.
+	bases  []string
+	baseOf []int
+	// names maps the pattern of each name rule without wildcards, and
+	// suffixes the literal tail of each *tail name rule, to their rules,
+	// ascending.
+	names    map[string][]int
+	suffixes map[string][]int
+	// globs and paths hold the other name rules and the path rules,
+	// descending, so the first match found is the one that decides.
+	globs []int
+	paths []int
+}
+
+// NewRuleSet prepares rules for the entries of dir. parent is the set of
+// dir's parent directory, whose rules are a prefix of rules, or nil.
+func NewRuleSet(rules []Rule, dir string, parent *RuleSet) *RuleSet {
+	set := &RuleSet{rules: rules, always: [2]int{-1, -1}}
+	if parent != nil && len(parent.rules) == len(rules) {
+		set.index = parent.index
+	} else {
+		set.index = newRuleIndex(rules)
+	}
+	index := set.index
+
+	set.relDirs = make([]string, len(index.bases))
+	segments := make([][]string, len(index.bases))
+	for base, baseDir := range index.bases {
+		rel, err := filepath.Rel(baseDir, dir)
+		relSlash := filepath.ToSlash(rel)
+		if err != nil || relSlash == ".." || strings.HasPrefix(relSlash, "../") {
+			continue
+		}
+		set.relDirs[base] = relSlash
+		if relSlash != "." {
+			segments[base] = strings.Split(relSlash, "/")
+		}
+	}
+
+	for base, baseSegments := range segments {
+		for _, segment := range baseSegments {
+			for _, i := range index.names[segment] {
+				if index.baseOf[i] == base {
+					set.matchesAll(i)
+				}
+			}
+			for k := 0; k <= len(segment); k++ {
+				for _, i := range index.suffixes[segment[k:]] {
+					if index.baseOf[i] == base {
+						set.matchesAll(i)
+					}
+				}
+			}
+		}
+	}
+	for _, i := range index.globs {
+		for _, segment := range segments[index.baseOf[i]] {
+			if globMatch(index.patterns[i], segment) {
+				set.matchesAll(i)
+				break
+			}
+		}
+	}
+	for _, i := range index.paths {
+		relDir := set.relDirs[index.baseOf[i]]
+		if relDir == "" {
+			continue
+		}
+		patternText := index.patterns[i]
+		if relDir != "." && strings.HasPrefix(relDir+"/", pathRulePrefix(patternText)) {
+			set.matchesAll(i)
+			continue
+		}
+		if strings.ContainsAny(patternText, `[\`) {
+			set.paths = append(set.paths, pathCandidate{rule: i, whole: true})
+			continue
+		}
+		// Without classes or escapes only a slash matches a slash, so the
+		// pattern's segments must line up with the directory's and the name.
+		patternSegments := strings.Split(patternText, "/")
+		dirSegments := segments[index.baseOf[i]]
+		if len(patternSegments) != len(dirSegments)+1 {
+			continue
+		}
+		aligned := true
+		for j, segment := range dirSegments {
+			if !globMatch(patternSegments[j], segment) {
+				aligned = false
+				break
+			}
+		}
+		if aligned {
+			set.paths = append(set.paths, pathCandidate{rule: i, name: patternSegments[len(dirSegments)]})
+		}
+	}
+	return set
+}
+
+func newRuleIndex(rules []Rule) *ruleIndex {
+	index := &ruleIndex{
+		patterns: make([]string, len(rules)),
+		baseOf:   make([]int, len(rules)),
+		names:    make(map[string][]int),
+		suffixes: make(map[string][]int),
+	}
+	for i, rule := range rules {
+		if i == 0 || rule.BaseDir != rules[i-1].BaseDir {
+			index.bases = append(index.bases, rule.BaseDir)
+		}
+		index.baseOf[i] = len(index.bases) - 1
+
+		patternText := strings.ReplaceAll(rule.Pattern, "**", "*")
+		index.patterns[i] = patternText
+		tail, star := strings.CutPrefix(patternText, "*")
+		switch {
+		case rule.HasPath:
+			index.paths = append(index.paths, i)
+		case !hasWildcard(patternText):
+			index.names[patternText] = append(index.names[patternText], i)
+		case star && !hasWildcard(tail):
+			index.suffixes[tail] = append(index.suffixes[tail], i)
+		default:
+			index.globs = append(index.globs, i)
+		}
+	}
+	slices.Reverse(index.globs)
+	slices.Reverse(index.paths)
+	return index
+}
+
+func hasWildcard(patternText string) bool {
+	return strings.ContainsAny(patternText, `*?[\`)
+}
+
+// matchesAll records that rule i matches every entry it applies to.
+func (set *RuleSet) matchesAll(i int) {
+	set.always[1] = max(set.always[1], i)
+	if !set.rules[i].DirOnly {
+		set.always[0] = max(set.always[0], i)
+	}
+}
+
+// Match is MatchingRule for the entry of the set's directory called name.
+func (set *RuleSet) Match(defaultIgnoreDirs map[string]struct{}, name string, isDir bool) (bool, *Rule) {
+	kind := 0
+	if isDir {
+		if _, blocked := defaultIgnoreDirs[strings.ToLower(name)]; blocked {
+			return true, nil
+		}
+		kind = 1
+	}
+
+	index := set.index
+	best := set.always[kind]
+	applies := func(i int) bool {
+		return set.relDirs[index.baseOf[i]] != "" && (isDir || !set.rules[i].DirOnly)
+	}
+	// lastOf raises best to the last rule of matched that applies.
+	lastOf := func(matched []int) {
+		for j := len(matched) - 1; j >= 0 && matched[j] > best; j-- {
+			if applies(matched[j]) {
+				best = matched[j]
+				return
+			}
+		}
+	}
+	lastOf(index.names[name])
+	for k := 0; k <= len(name); k++ {
+		lastOf(index.suffixes[name[k:]])
+	}
+	for _, i := range index.globs {
+		if i <= best {
+			break
+		}
+		if applies(i) && globMatch(index.patterns[i], name) {
+			best = i
+			break
+		}
+	}
+	for _, candidate := range set.paths {
+		i := candidate.rule
+		if i <= best {
+			break
+		}
+		if !applies(i) {
+			continue
+		}
+		if candidate.whole {
+			relSlash := name
+			if relDir := set.relDirs[index.baseOf[i]]; relDir != "." {
+				relSlash = relDir + "/" + name
+			}
+			if pathRuleMatch(index.patterns[i], relSlash) {
+				best = i
+				break
+			}
+		} else if globMatch(candidate.name, name) {
+			best = i
+			break
+		}
+	}
+
+	if best < 0 || set.rules[best].Negate {
+		return false, nil
+	}
+	return true, &set.rules[best]
+}
@@ -0,0 +1,163 @@
+package output
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// baselineVersion is written to every baseline file so the format can evolve.
+const baselineVersion = 1
+
+// BaselineEntry is one recorded match. Path is slash-separated and relative to
+// the search root; Hash covers the path and whitespace-normalized line text, so
+// entries survive line-number drift and reindentation.
+type BaselineEntry struct {
+	Path string `json:"path"`
+	Hash string `json:"hash"`
+	Text string `json:"text"`
+}
+
+type baselineFile struct {
+	Version int             `json:"version"`
+	Entries []BaselineEntry `json:"entries"`
+}
+
+// Baseline either records matches for -baseline-write or, when loaded from a
+// file, classifies matches as known or new. It is owned by the printer
+// goroutine and is not safe for concurrent use.
+type Baseline struct {
+	root      string
+	entries   []BaselineEntry
+	remaining map[string]int
+	recorded  []BaselineEntry
+	// searched holds the relative path of every file searched to the end;
+	// only their entries can be resolved.
+	searched map[string]struct{}
+}
+
+// NewBaselineRecorder creates an empty baseline that records every match.
+func NewBaselineRecorder(root string) *Baseline {
+	return &Baseline{root: root}
+}
+
+// LoadBaseline reads a baseline file written by -baseline-write.
+func LoadBaseline(path string, root string) (*Baseline, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("baseline: %w", err)
+	}
+	var file baselineFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("baseline parse: %w", err)
+	}
+	if file.Version != baselineVersion {
+		return nil, fmt.Errorf("baseline: unsupported version %d", file.Version)
+	}
+
+	baseline := &Baseline{root: root, entries: file.Entries, remaining: make(map[string]int, len(file.Entries)), searched: make(map[string]struct{})}
+	for _, entry := range file.Entries {
+		baseline.remaining[entry.Hash]++
+	}
+	return baseline, nil
+}
+
+// Known reports whether a match at path with text is in the baseline,
+// consuming one occurrence so that duplicated lines beyond the recorded
+// number are reported as new.
+func (baseline *Baseline) Known(path string, text string) bool {
+	hash := baseline.entry(path, text).Hash
+	if baseline.remaining[hash] == 0 {
+		return false
+	}
+	baseline.remaining[hash]--
+	return true
+}
+
+// Record adds a match to the baseline being written. The entry is keyed on
+// text but stores display, which differs from text under -redact.
+func (baseline *Baseline) Record(path string, text string, display string) {
+	entry := baseline.entry(path, text)
+	entry.Text = display
+	baseline.recorded = append(baseline.recorded, entry)
+}
+
+// MarkSearched records that path was searched to the end, so entries of it
+// that no match consumed are resolved rather than merely unseen.
+func (baseline *Baseline) MarkSearched(path string) {
+	if baseline.searched != nil {
+		baseline.searched[baseline.relPath(path)] = struct{}{}
+	}
+}
+
+// Resolved returns loaded entries that no match consumed, in file order.
+// Entries of files that were skipped, could not be read, or were never
+// reached are not resolved: nothing is known about them.
+func (baseline *Baseline) Resolved() []BaselineEntry {
+	unconsumed := make(map[string]int, len(baseline.remaining))
+	for hash, count := range baseline.remaining {
+		unconsumed[hash] = count
+	}
+	resolved := make([]BaselineEntry, 0)
+	for _, entry := range baseline.entries {
+		if _, ok := baseline.searched[entry.Path]; !ok {
+			continue
+		}
+		if unconsumed[entry.Hash] > 0 {
+			unconsumed[entry.Hash]--
+			resolved = append(resolved, entry)
+		}
+	}
+	return resolved
+}
+
+// AbsPath maps an entry's root-relative path back to a search path.
+func (baseline *Baseline) AbsPath(entry BaselineEntry) string {
+	return filepath.Join(baseline.root, filepath.FromSlash(entry.Path))
+}
+
+// Write stores the recorded matches at path, sorted so that reruns over an
+// unchanged tree produce identical files. The file is replaced whole, so a
+// run reading it while another writes it loads one version or the other.
+func (baseline *Baseline) Write(path string) error {
+	entries := append([]BaselineEntry(nil), baseline.recorded...)
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Path != entries[j].Path {
+			return entries[i].Path < entries[j].Path
+		}
+		return entries[i].Hash < entries[j].Hash
+	})
+	if entries == nil {
+		entries = []BaselineEntry{}
+	}
+
+	content, err := json.MarshalIndent(baselineFile{Version: baselineVersion, Entries: entries}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("baseline: %w", err)
+	}
+	if err := ReplaceFile(path, append(content, '\n')); err != nil {
+		return fmt.Errorf("baseline: %w", err)
+	}
+	return nil
+}
+
+func (baseline *Baseline) entry(path string, text string) BaselineEntry {
+	rel := baseline.relPath(path)
+	sum := sha256.Sum256([]byte(rel + "\x00" + normalizeLine(text)))
+	return BaselineEntry{Path: rel, Hash: hex.EncodeToString(sum[:]), Text: text}
+}
+
+// relPath is path relative to the baseline's root, with forward slashes, as
+// entries store it.
+func (baseline *Baseline) relPath(path string) string {
+	rel, err := filepath.Rel(baseline.root, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = path
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,146 @@
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/vennictus/gosearch/internal/config"
+)
+
+// compareHistoryLimit is the size past which the -compare-last history in
+// the cache directory is cut to its newest half. A -stats-file is never cut.
+const compareHistoryLimit = 1 << 20
+
+// RunSummary is what -compare-last compares between two runs.
+type RunSummary struct {
+	Matches      int
+	FilesScanned int64
+	TotalMs      float64
+}
+
+// CompareKey identifies the runs -compare-last compares: the same patterns,
+// matched the same way, in the same tree or -files-from lists. Filters such
+// as -extensions, -exclude-dir, -max-size, -not, or -match-filter are left
+// out, since narrowing them between runs is what the comparison is for, and
+// so are output flags, which do not change what is found, except
+// -count-matches, which changes what the match count counts. The fields
+// include the patterns, so they are hashed with the stats key.
+func CompareKey(cfg config.Config, key []byte) string {
+	root, err := filepath.Abs(cfg.RootPath)
+	if err != nil {
+		root = cfg.RootPath
+	}
+	fields := struct {
+		Patterns          []string `json:"patterns"`
+		HexPattern        []byte   `json:"hex_pattern"`
+		Regex             bool     `json:"regex"`
+		Engine            string   `json:"engine,omitempty"`
+		IgnoreCase        bool     `json:"ignore_case"`
+		WholeWord         bool     `json:"whole_word"`
+		Overlapping       bool     `json:"overlapping"`
+		Invert            bool     `json:"invert"`
+		MatchAll          bool     `json:"match_all"`
+		FilesWithoutMatch bool     `json:"files_without_match"`
+		CountMatches      bool     `json:"count_matches,omitempty"`
+		Root              string   `json:"root"`
+		FilesFrom         []string `json:"files_from"`
+	}{cfg.Patterns, cfg.HexPattern, cfg.Regex, "", cfg.IgnoreCase, cfg.WholeWord, cfg.Overlapping, cfg.Invert, cfg.MatchAll, cfg.FilesWithoutMatch, cfg.CountMatches, root, nil}
+	if cfg.FilesFrom != nil {
+		fields.FilesFrom = cfg.FilesFrom.Paths
+	}
+	// Keys of re2 runs stay what they were before -engine existed.
+	if cfg.Engine == "pcre" {
+		fields.Engine = cfg.Engine
+	}
+	encoded, _ := json.Marshal(fields)
+	return keyedHash(key, encoded)
+}
+
+// CompareHistoryPath is where -compare-last keeps run records when there
+// is no -stats-file: runs.jsonl in a gosearch directory of the user's cache
+// directory, created if needed.
+func CompareHistoryPath() (string, error) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("compare-last: %w", err)
+	}
+	dir := filepath.Join(cache, "gosearch")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("compare-last: %w", err)
+	}
+	return filepath.Join(dir, "runs.jsonl"), nil
+}
+
+// LastRun returns the newest run recorded at path with key that searched
+// everything: it neither stopped early nor failed with exit code 2. A
+// missing file, or unreadable lines in it, only mean there is nothing to
+// compare.
+func LastRun(path string, key string) (RunSummary, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return RunSummary{}, false
+	}
+	defer file.Close()
+
+	var last RunSummary
+	found := false
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64<<10), compareHistoryLimit)
+	for scanner.Scan() {
+		var record struct {
+			ExitCode      int    `json:"exit_code"`
+			CompareKey    string `json:"compare_key"`
+			StoppedReason string `json:"stopped_reason"`
+			Matches       int    `json:"matches"`
+			Timings       struct {
+				TotalMs float64 `json:"total_ms"`
+			} `json:"timings"`
+			Metrics struct {
+				FilesScanned int64 `json:"files_scanned"`
+			} `json:"metrics"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &record) != nil || record.CompareKey != key || record.StoppedReason != "" || record.ExitCode == 2 {
+			continue
+		}
+		last = RunSummary{Matches: record.Matches, FilesScanned: record.Metrics.FilesScanned, TotalMs: record.Timings.TotalMs}
+		found = true
+	}
+	return last, found
+}
+
+// PrintComparison prints current against previous on one line, e.g.
+// "compare-last: matches: 412 (-38), files searched: 9,801 (-1,204), time: 0.8s (-0.3s)".
+func PrintComparison(stderr io.Writer, numbers Numbers, previous RunSummary, current RunSummary) {
+	fmt.Fprintf(stderr, "compare-last: matches: %s (%s), files searched: %s (%s), time: %.1fs (%+.1fs)\n",
+		numbers.Count(int64(current.Matches)), numbers.Signed(int64(current.Matches-previous.Matches)),
+		numbers.Count(current.FilesScanned), numbers.Signed(current.FilesScanned-previous.FilesScanned),
+		current.TotalMs/1000, (current.TotalMs-previous.TotalMs)/1000)
+}
+
+// TrimCompareHistory cuts the -compare-last history at path to its newest
+// half once it passes compareHistoryLimit.
+func TrimCompareHistory(path string) error {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && info.Size() <= compareHistoryLimit) {
+		return nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("compare-last: %w", err)
+	}
+	half := content[len(content)/2:]
+	if newline := bytes.IndexByte(half, '\n'); newline >= 0 {
+		half = half[newline+1:]
+	}
+	if err := ReplaceFile(path, half); err != nil {
+		return fmt.Errorf("compare-last: %w", err)
+	}
+	return nil
+}
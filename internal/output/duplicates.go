@@ -0,0 +1,127 @@
+package output
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vennictus/gosearch/internal/search"
+)
+
+// duplicateLimit caps how many matched lines -show-duplicates remembers, so
+// a search matching millions of lines cannot exhaust memory.
+const duplicateLimit = 100000
+
+type duplicateLocation struct {
+	Path string `json:"path"`
+	Line int    `json:"line"`
+}
+
+type duplicateGroup struct {
+	text      string
+	locations []duplicateLocation
+}
+
+// duplicateTracker groups matched lines by whitespace-normalized text for
+// -show-duplicates. It is owned by the printer goroutine.
+type duplicateTracker struct {
+	groups    map[[sha256.Size]byte]*duplicateGroup
+	tracked   int
+	truncated bool
+}
+
+type jsonDuplicateGroup struct {
+	Schema    int                 `json:"schema"`
+	Type      string              `json:"type"`
+	Text      string              `json:"text"`
+	Locations []duplicateLocation `json:"locations"`
+}
+
+func newDuplicateTracker() *duplicateTracker {
+	return &duplicateTracker{groups: make(map[[sha256.Size]byte]*duplicateGroup)}
+}
+
+// add records a match; display is the text printed for its group, which
+// differs from text under -redact. Groups print their normalized text, so
+// the output does not depend on which occurrence arrived first.
+func (tracker *duplicateTracker) add(result search.Result, display string) {
+	if tracker.tracked == duplicateLimit {
+		tracker.truncated = true
+		return
+	}
+	tracker.tracked++
+
+	key := sha256.Sum256([]byte(normalizeLine(result.Text)))
+	group := tracker.groups[key]
+	if group == nil {
+		group = &duplicateGroup{text: normalizeLine(display)}
+		tracker.groups[key] = group
+	}
+	group.locations = append(group.locations, duplicateLocation{Path: result.Path, Line: result.Line})
+}
+
+// crossFile returns the groups whose lines occur in more than one file,
+// sorted by text with locations in path and line order.
+func (tracker *duplicateTracker) crossFile() []*duplicateGroup {
+	var groups []*duplicateGroup
+	for _, group := range tracker.groups {
+		first := group.locations[0].Path
+		for _, location := range group.locations[1:] {
+			if location.Path != first {
+				groups = append(groups, group)
+				break
+			}
+		}
+	}
+	for _, group := range groups {
+		sort.Slice(group.locations, func(i, j int) bool {
+			a, b := group.locations[i], group.locations[j]
+			if a.Path != b.Path {
+				return a.Path < b.Path
+			}
+			return a.Line < b.Line
+		})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].text != groups[j].text {
+			return groups[i].text < groups[j].text
+		}
+		return groups[i].locations[0].Path < groups[j].locations[0].Path
+	})
+	return groups
+}
+
+// printDuplicates prints every cross-file group: a "duplicate:" line with the
+// text followed by one indented path:line per occurrence.
+func (state *printState) printDuplicates() {
+	tracker := state.duplicates
+	for _, group := range tracker.crossFile() {
+		locations := make([]duplicateLocation, len(group.locations))
+		for i, location := range group.locations {
+			locations[i] = duplicateLocation{Path: formatPath(location.Path, state.cfg.AbsPath), Line: location.Line}
+		}
+		switch state.cfg.OutputFormat {
+		case "json-v1":
+			// v1 had no duplicate groups.
+		case "json":
+			_ = state.jsonEncoder.Encode(jsonDuplicateGroup{Schema: JSONSchemaVersion, Type: "duplicate", Text: group.text, Locations: locations})
+		default:
+			text := group.text
+			if state.cfg.OutputFormat == "plain" {
+				text, _ = escapeControls(text, nil, state.cfg.Escape)
+			}
+			state.printRecord("duplicate: %s", text)
+			for _, location := range locations {
+				state.printRecord("  %s:%d", location.Path, location.Line)
+			}
+		}
+	}
+	if tracker.truncated {
+		fmt.Fprintf(state.stderr, "show-duplicates: stopped tracking after %d matched lines; groups may be incomplete\n", duplicateLimit)
+	}
+}
+
+func normalizeLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,90 @@
+package output
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vennictus/gosearch/internal/config"
+	"github.com/vennictus/gosearch/internal/search"
+)
+
+// isControl reports whether r would break a line or drive the terminal:
+// C0 controls other than tab, DEL, and C1 controls.
+func isControl(r rune) bool {
+	return (r < 0x20 && r != '\t') || r == 0x7f || (r >= 0x80 && r <= 0x9f)
+}
+
+// hasControl reports whether line holds a character isControl flags. It
+// scans bytes rather than runes, since most lines have none: the only
+// controls past ASCII are C1, encoded as 0xc2 followed by 0x80 to 0x9f.
+func hasControl(line string) bool {
+	for i := 0; i < len(line); i++ {
+		b := line[i]
+		if (b < 0x20 && b != '\t') || b == 0x7f || (b == 0xc2 && i+1 < len(line) && line[i+1] >= 0x80 && line[i+1] <= 0x9f) {
+			return true
+		}
+	}
+	return false
+}
+
+// escapeControls applies -escape to a plain output line so it prints as one
+// physical line that cannot move the cursor or change colors, and returns
+// ranges remapped onto the new text. Escaped characters read as \r, \n, or
+// \xNN (\u0085 for C1 controls); a match on a stripped character keeps its
+// place as an empty range.
+func escapeControls(line string, ranges []search.MatchRange, mode string) (string, []search.MatchRange) {
+	if mode == config.EscapeOff || !hasControl(line) {
+		return line, ranges
+	}
+
+	var builder strings.Builder
+	// moved holds the new position of each byte offset of line.
+	moved := make([]int, len(line)+1)
+	for i := 0; i < len(line); {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		for j := i; j < i+size; j++ {
+			moved[j] = builder.Len()
+		}
+		switch {
+		case r == utf8.RuneError && size == 1, !isControl(r):
+			builder.WriteString(line[i : i+size])
+		case mode == config.EscapeStrip:
+		case r == '\r':
+			builder.WriteString(`\r`)
+		case r == '\n':
+			builder.WriteString(`\n`)
+		case r < 0x80:
+			fmt.Fprintf(&builder, `\x%02x`, r)
+		default:
+			fmt.Fprintf(&builder, `\u%04x`, r)
+		}
+		i += size
+	}
+	moved[len(line)] = builder.Len()
+
+	remapped := make([]search.MatchRange, 0, len(ranges))
+	for _, match := range ranges {
+		if match.Start > len(line) || match.End > len(line) {
+			continue
+		}
+		remapped = append(remapped, search.MatchRange{Start: moved[match.Start], End: moved[match.End], Captures: moveCaptures(match.Captures, moved)})
+	}
+	return builder.String(), remapped
+}
+
+// moveCaptures returns captures with their offsets moved as moved says,
+// keeping -1 for a group that took no part.
+func moveCaptures(captures *[]search.Capture, moved []int) *[]search.Capture {
+	if captures == nil {
+		return nil
+	}
+	out := make([]search.Capture, len(*captures))
+	for i, capture := range *captures {
+		out[i] = capture
+		if capture.Start >= 0 {
+			out[i].Start, out[i].End = moved[capture.Start], moved[capture.End]
+		}
+	}
+	return &out
+}
@@ -0,0 +1,129 @@
+package output
+
+import (
+	"github.com/vennictus/gosearch/internal/search"
+)
+
+// -format json-events brackets the matches of each file with begin and end
+// records and ends the output with a summary. Every record has a "type".
+
+type jsonBeginEvent struct {
+	Schema    int    `json:"schema"`
+	Type      string `json:"type"`
+	Path      string `json:"path"`
+	PathBytes string `json:"path_bytes,omitempty"`
+}
+
+type jsonMatchEvent struct {
+	Schema    int    `json:"schema"`
+	Type      string `json:"type"`
+	Path      string `json:"path"`
+	PathBytes string `json:"path_bytes,omitempty"`
+	Line      int    `json:"line"`
+	// Offset is the line's byte offset within the file.
+	Offset int64  `json:"offset"`
+	Text   string `json:"text"`
+	Bytes  string `json:"bytes,omitempty"`
+	// Ranges are the ranges of the matches within text, in -offset-unit
+	// units.
+	Ranges []jsonRange `json:"ranges"`
+	// Captures holds what named groups matched, as in a json record.
+	Captures  []map[string]jsonCapture `json:"captures,omitempty"`
+	Truncated bool                     `json:"truncated,omitempty"`
+	Baseline  string                   `json:"baseline,omitempty"`
+	Replaced  *string                  `json:"replaced,omitempty"`
+	Context   *jsonContext             `json:"context,omitempty"`
+}
+
+type jsonRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// jsonEndEvent closes a file opened by a begin record. Matches counts the
+// match records printed for it; Stats describes the whole scan.
+type jsonEndEvent struct {
+	Schema    int             `json:"schema"`
+	Type      string          `json:"type"`
+	Path      string          `json:"path"`
+	PathBytes string          `json:"path_bytes,omitempty"`
+	Matches   int             `json:"matches"`
+	Stats     *jsonEventStats `json:"stats,omitempty"`
+}
+
+type jsonEventStats struct {
+	Lines      int     `json:"lines"`
+	Matches    int     `json:"matches"`
+	Bytes      int64   `json:"bytes"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+type jsonSummaryEvent struct {
+	Schema        int     `json:"schema"`
+	Type          string  `json:"type"`
+	Matches       int     `json:"matches"`
+	MatchedFiles  int     `json:"matched_files"`
+	FilesSearched int64   `json:"files_searched"`
+	ElapsedMs     float64 `json:"elapsed_ms"`
+	StoppedReason string  `json:"stopped_reason,omitempty"`
+}
+
+// printMatchEvent prints a match record, preceded by a begin record when it
+// is the first one printed for its file.
+func (state *printState) printMatchEvent(result search.Result, pathText string, text string, ranges []search.MatchRange, baselineTag string) {
+	cfg := state.cfg
+	if state.eventPath != pathText {
+		state.endEvent(nil)
+		_ = state.jsonEncoder.Encode(jsonBeginEvent{Schema: JSONSchemaVersion, Type: "begin", Path: pathText, PathBytes: pathBytes(pathText)})
+		state.eventPath = pathText
+	}
+	state.eventMatches++
+
+	out := jsonMatchEvent{Schema: JSONSchemaVersion, Type: "match", Path: pathText, PathBytes: pathBytes(pathText), Line: result.Line, Offset: result.Offset, Baseline: baselineTag, Captures: jsonCaptures(result.Text, result.Ranges, cfg.OffsetUnit)}
+	if cfg.Replace {
+		replaced, _ := replaceRanges(text, ranges, state.replacement)
+		if cfg.MaxColumnsJSON {
+			replaced, _, _ = truncateLine(replaced, nil, cfg.MaxColumns)
+		}
+		replaced, _, _ = state.jsonText(replaced, nil)
+		out.Replaced = &replaced
+	}
+	if cfg.MaxColumnsJSON {
+		text, ranges, out.Truncated = truncateLine(text, ranges, cfg.MaxColumns)
+	}
+	out.Text, ranges, out.Bytes = state.jsonText(text, ranges)
+	offset := offsetUnits(out.Text, cfg.OffsetUnit)
+	out.Ranges = make([]jsonRange, 0, len(ranges))
+	for _, match := range ranges {
+		out.Ranges = append(out.Ranges, jsonRange{Start: offset(match.Start), End: offset(match.End)})
+	}
+	if len(result.Before) > 0 || len(result.After) > 0 {
+		out.Context = &jsonContext{Before: state.jsonContextLines(result.Before), After: state.jsonContextLines(result.After)}
+	}
+	_ = state.jsonEncoder.Encode(out)
+}
+
+// endEvent prints the end record of the file whose begin record was printed
+// last, if it has not been ended yet. stats is nil when the file was not
+// scanned to its end.
+func (state *printState) endEvent(stats *search.FileStats) {
+	if state.eventPath == "" {
+		return
+	}
+	out := jsonEndEvent{Schema: JSONSchemaVersion, Type: "end", Path: state.eventPath, PathBytes: pathBytes(state.eventPath), Matches: state.eventMatches}
+	if stats != nil {
+		out.Stats = &jsonEventStats{Lines: stats.Lines, Matches: stats.Matches, Bytes: stats.Bytes, DurationMs: durationMs(stats.Duration)}
+	}
+	_ = state.jsonEncoder.Encode(out)
+	state.eventPath, state.eventMatches = "", 0
+}
+
+// printSummaryEvent ends -format json-events output.
+func (state *printState) printSummaryEvent() {
+	state.endEvent(nil)
+	out := jsonSummaryEvent{Schema: JSONSchemaVersion, Type: "summary", Matches: state.count, MatchedFiles: len(state.matchedFiles), ElapsedMs: durationMs(state.cfg.Clock.Now().Sub(state.started)), StoppedReason: state.stoppedReason()}
+	if state.metrics != nil {
+		out.FilesSearched = state.metrics.FilesScanned.Load()
+	}
+	_ = state.jsonEncoder.Encode(out)
+}
@@ -0,0 +1,54 @@
+package output
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/vennictus/gosearch/internal/config"
+)
+
+// hyperlinker makes printed paths OSC 8 hyperlinks for -hyperlink. A nil
+// hyperlinker leaves them alone, as every format but plain does.
+type hyperlinker struct {
+	format string
+	host   string
+	// dir resolves relative paths, which links need absolute even without
+	// -abs.
+	dir string
+}
+
+func newHyperlinker(cfg config.Config) *hyperlinker {
+	if !cfg.Hyperlink || cfg.OutputFormat != "plain" {
+		return nil
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil
+	}
+	host, _ := os.Hostname()
+	return &hyperlinker{format: cfg.HyperlinkFormat, host: host, dir: dir}
+}
+
+// link wraps text, the printed form of path, in a link to path at line.
+// Results without a line link to line 1.
+func (linker *hyperlinker) link(text string, path string, line int) string {
+	if linker == nil {
+		return text
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(linker.dir, path)
+	}
+	slashed := filepath.ToSlash(path)
+	if !strings.HasPrefix(slashed, "/") {
+		slashed = "/" + slashed
+	}
+	target := strings.NewReplacer(
+		"{path}", (&url.URL{Path: slashed}).EscapedPath(),
+		"{line}", strconv.Itoa(max(line, 1)),
+		"{host}", linker.host,
+	).Replace(linker.format)
+	return "\x1b]8;;" + target + "\x1b\\" + text + "\x1b]8;;\x1b\\"
+}
@@ -0,0 +1,78 @@
+package output
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// sizeUnits are the units Numbers.Size steps through, in powers of 1024 as
+// -max-size reads them.
+var sizeUnits = []string{"KB", "MB", "GB", "TB"}
+
+// Numbers formats the counts and sizes of the summaries written for people
+// to read: -stats, -progress, -compare-last, and the -auto-spill notice.
+// Counts have commas between groups of three digits and sizes one decimal in
+// the largest unit they reach, the same whatever the locale. With Plain, for
+// -plain-numbers, both are bare integers and sizes are in bytes. Records
+// meant for programs, JSON and the key=value lines of -metrics, always keep
+// raw integers.
+type Numbers struct {
+	Plain bool
+}
+
+// Count formats n, e.g. "12,345".
+func (numbers Numbers) Count(n int64) string {
+	if numbers.Plain {
+		return strconv.FormatInt(n, 10)
+	}
+	if n < 0 {
+		return "-" + groupThousands(-n)
+	}
+	return groupThousands(n)
+}
+
+// Signed formats n with its sign, e.g. "+1,204" or "-38".
+func (numbers Numbers) Signed(n int64) string {
+	if n < 0 {
+		return numbers.Count(n)
+	}
+	return "+" + numbers.Count(n)
+}
+
+// Size formats a number of bytes, e.g. "512 B" or "3.4 MB", or with Plain
+// "3565158 B".
+func (numbers Numbers) Size(bytes int64) string {
+	if numbers.Plain || bytes < 1024 {
+		return strconv.FormatInt(bytes, 10) + " B"
+	}
+	value := float64(bytes) / 1024
+	unit := 0
+	for value >= 1024 && unit < len(sizeUnits)-1 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", value, sizeUnits[unit])
+}
+
+// Rate formats the bytes read per second over elapsed, e.g. "41.3 MB/s".
+func (numbers Numbers) Rate(bytes int64, elapsed time.Duration) string {
+	if elapsed <= 0 {
+		return numbers.Size(0) + "/s"
+	}
+	return numbers.Size(int64(float64(bytes)/elapsed.Seconds())) + "/s"
+}
+
+// groupThousands formats n, which is not negative, with commas between
+// groups of three digits.
+func groupThousands(n int64) string {
+	digits := strconv.FormatInt(n, 10)
+	var out []byte
+	for i := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			out = append(out, ',')
+		}
+		out = append(out, digits[i])
+	}
+	return string(out)
+}
@@ -0,0 +1,105 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// OutputFile is the -output destination. Results are written to a temporary
+// file beside it, which Commit renames into place, so a reader never sees a
+// partial file and an interrupted run leaves any previous one intact.
+type OutputFile struct {
+	path string
+	temp *os.File
+}
+
+// CreateOutputFile starts writing results for path. The error names path
+// and says why it cannot be written.
+func CreateOutputFile(path string) (*OutputFile, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return nil, fmt.Errorf("output %s: is a directory", path)
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, outputError(path, err)
+	}
+	return &OutputFile{path: path, temp: temp}, nil
+}
+
+// Write appends to the temporary file.
+func (file *OutputFile) Write(data []byte) (int, error) {
+	return file.temp.Write(data)
+}
+
+// Commit flushes the results to disk and replaces path with them.
+func (file *OutputFile) Commit() error {
+	if err := file.commit(); err != nil {
+		return outputError(file.path, err)
+	}
+	return nil
+}
+
+func (file *OutputFile) commit() error {
+	err := file.temp.Sync()
+	if err == nil {
+		err = file.temp.Chmod(0o644)
+	}
+	if closeErr := file.temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.temp.Name(), file.path)
+	}
+	if err != nil {
+		_ = os.Remove(file.temp.Name())
+	}
+	return err
+}
+
+// Discard drops the results, leaving path as it was.
+func (file *OutputFile) Discard() {
+	_ = file.temp.Close()
+	_ = os.Remove(file.temp.Name())
+}
+
+// ReplaceFile writes data to path as -output writes its file: through a
+// temporary file renamed into place. A concurrent reader sees the old
+// content or the new, never part of either, and of several concurrent
+// writers one wins whole. Errors name path, as os.WriteFile's do.
+func ReplaceFile(path string, data []byte) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err == nil {
+		file := &OutputFile{path: path, temp: temp}
+		if _, err = file.Write(data); err != nil {
+			file.Discard()
+		} else {
+			err = file.commit()
+		}
+	}
+	if err != nil {
+		return &fs.PathError{Op: "write", Path: path, Err: errorCause(err)}
+	}
+	return nil
+}
+
+// outputError reports err against the -output path rather than the
+// temporary file it happened on.
+func outputError(path string, err error) error {
+	return fmt.Errorf("output %s: %w", path, errorCause(err))
+}
+
+// errorCause strips the path of the temporary file from err.
+func errorCause(err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+	var linkErr *os.LinkError
+	if errors.As(err, &linkErr) {
+		err = linkErr.Err
+	}
+	return err
+}
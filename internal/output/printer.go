@@ -2,26 +2,149 @@
 package output
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/vennictus/gosearch/internal/config"
 	"github.com/vennictus/gosearch/internal/search"
 )
 
-// PrintSummary contains the final match count.
+// PrintSummary contains the final match counts.
 type PrintSummary struct {
-	MatchCount int
+	MatchCount    int
+	FilenameCount int
+	// MatchedFiles is the number of files with at least one counted match.
+	MatchedFiles int
+	// NoMatchFiles is the number of files searched to the end without a
+	// match; it is counted only when outcomes are tracked.
+	NoMatchFiles int
+	// BaselineErr is set when -baseline-write could not save the baseline.
+	BaselineErr error
+	// TemplateErr is the first error executing -template on a match; no
+	// template output follows it.
+	TemplateErr error
+	// WriteErr is the first error writing to stdout; the search was
+	// cancelled when it occurred.
+	WriteErr error
+}
+
+// IsBrokenPipe reports whether err means the reader of stdout went away, as
+// when output is piped into head.
+func IsBrokenPipe(err error) bool {
+	return errors.Is(err, syscall.EPIPE)
+}
+
+// stickyWriter remembers the first write error and fails every later write
+// without touching the underlying writer.
+type stickyWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (writer *stickyWriter) Write(p []byte) (int, error) {
+	if writer.err != nil {
+		return 0, writer.err
+	}
+	n, err := writer.w.Write(p)
+	if err != nil {
+		writer.err = err
+	}
+	return n, err
 }
 
 type jsonResult struct {
-	Path string `json:"path"`
-	Line *int   `json:"line,omitempty"`
-	Text string `json:"text"`
+	Schema int    `json:"schema"`
+	Kind   string `json:"kind,omitempty"`
+	Path   string `json:"path"`
+	// PathBytes holds the path when it is not valid UTF-8; see pathBytes.
+	PathBytes string `json:"path_bytes,omitempty"`
+	Line      *int   `json:"line,omitempty"`
+	// Offset is the line's byte offset within the file, with -b.
+	Offset *int64 `json:"offset,omitempty"`
+	Text   string `json:"text"`
+	// Bytes is the raw line in base64 when it is not valid UTF-8, with
+	// -json-invalid-utf8 base64.
+	Bytes string `json:"bytes,omitempty"`
+	// Source is the -files-from label of the file, or its labels joined by
+	// commas with -files-from-dedup all.
+	Source string `json:"source,omitempty"`
+	// Truncated marks text cut short by -max-columns with -max-columns-json.
+	Truncated bool   `json:"truncated,omitempty"`
+	Size      *int64 `json:"size,omitempty"`
+	ModTime   string `json:"mtime,omitempty"`
+	Mode      string `json:"mode,omitempty"`
+	// Baseline tags results as "new" or "known" when -baseline is compared.
+	Baseline string `json:"baseline,omitempty"`
+	// RedactedLengths holds each masked match's original length in characters.
+	RedactedLengths []int `json:"redacted_lengths,omitempty"`
+	// Entropy holds each match's bits per character when -min-entropy is set.
+	Entropy []float64 `json:"entropy,omitempty"`
+	// Captures holds, for each match of a -regex pattern with named groups,
+	// what each group matched; see jsonCaptures.
+	Captures []map[string]jsonCapture `json:"captures,omitempty"`
+	// Replaced is the text with every match substituted, with -replace.
+	Replaced *string `json:"replaced,omitempty"`
+	// Context holds -A/-B/-C lines not already attached to an earlier result.
+	Context *jsonContext `json:"context,omitempty"`
+}
+
+// jsonCapture is what one named group matched: its text and range in the
+// line as read, counted in -offset-unit units.
+type jsonCapture struct {
+	Text  string `json:"text"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// jsonCaptures returns, for each match in ranges, an object of what its
+// named groups matched in line, with the groups that took no part left
+// out. It is nil when no pattern that matched has named groups. Offsets
+// are counted in unit.
+func jsonCaptures(line string, ranges []search.MatchRange, unit string) []map[string]jsonCapture {
+	named := func(match search.MatchRange) bool {
+		return match.Captures != nil && slices.ContainsFunc(*match.Captures, func(capture search.Capture) bool { return capture.Name != "" })
+	}
+	if !slices.ContainsFunc(ranges, named) {
+		return nil
+	}
+	offset := offsetUnits(line, unit)
+	captures := make([]map[string]jsonCapture, 0, len(ranges))
+	for _, match := range ranges {
+		groups := map[string]jsonCapture{}
+		if match.Captures != nil {
+			for _, capture := range *match.Captures {
+				if capture.Name != "" && capture.Start >= 0 {
+					groups[capture.Name] = jsonCapture{Text: line[capture.Start:capture.End], Start: offset(capture.Start), End: offset(capture.End)}
+				}
+			}
+		}
+		captures = append(captures, groups)
+	}
+	return captures
+}
+
+type jsonContext struct {
+	Before []jsonContextLine `json:"before,omitempty"`
+	After  []jsonContextLine `json:"after,omitempty"`
+}
+
+type jsonContextLine struct {
+	Line      int    `json:"line"`
+	Offset    *int64 `json:"offset,omitempty"`
+	Text      string `json:"text"`
+	Bytes     string `json:"bytes,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
 }
 
 // Printer reads results and prints them to stdout.
@@ -29,79 +152,1057 @@ func Printer(
 	ctx context.Context,
 	results <-chan search.Result,
 	stdout io.Writer,
+	stderr io.Writer,
 	cfg config.Config,
-	cancel context.CancelFunc,
+	baseline *Baseline,
+	split *SplitOutput,
+	metrics *search.Metrics,
+	cancel context.CancelCauseFunc,
 	done chan<- PrintSummary,
 ) {
-	count := 0
-	jsonEncoder := json.NewEncoder(stdout)
-	cancelledOnce := false
+	state := newPrintState(cfg, stdout, stderr)
+	state.baseline = baseline
+	state.split = split
+	state.metrics = metrics
+	state.cancel = cancel
+	finish := func() {
+		state.flushDiagnostics(ctx.Err() != nil)
+		state.stopped = search.StopCauseOf(ctx)
+		state.finalize()
+		state.flush()
+		state.finishSpill()
+		done <- state.summary()
+		close(done)
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
-			for result := range results {
-				count++
-				_ = result
-			}
-			finalizePrint(count, cfg, jsonEncoder, stdout)
-			done <- PrintSummary{MatchCount: count}
-			close(done)
+			state.drain(results, nil)
+			finish()
 			return
 		case result, ok := <-results:
 			if !ok {
-				finalizePrint(count, cfg, jsonEncoder, stdout)
-				done <- PrintSummary{MatchCount: count}
-				close(done)
+				finish()
+				return
+			}
+			if ctx.Err() != nil {
+				state.drain(results, &result)
+				finish()
 				return
 			}
 
-			count++
-			if cfg.Quiet {
-				if !cfg.CountOnly && !cancelledOnce {
-					cancel()
-					cancelledOnce = true
-				}
-				continue
+			if result.Seq > 0 {
+				state.reorder(result)
+			} else {
+				state.handle(result)
 			}
-			if cfg.CountOnly {
-				continue
+			if len(results) == 0 {
+				state.flush()
+			}
+			state.checkWrite()
+		}
+	}
+}
+
+// handle counts and prints one result, or reacts to a pipeline event.
+func (state *printState) handle(result search.Result) {
+	cfg, stderr := state.cfg, state.stderr
+	switch result.Kind {
+	case search.KindDiagnostic:
+		state.flush()
+		fmt.Fprintln(stderr, result.Text)
+		state.printFileError(result)
+	case search.KindWalkDone:
+		state.walkDone = true
+		state.flushPending()
+	case search.KindFilename:
+		state.filenameCount++
+		if state.admitOutput() {
+			state.countPrinted()
+			state.printFilename(result)
+		}
+	case search.KindFileWithoutMatch, search.KindBinaryMatch:
+		state.count++
+		if result.Kind == search.KindBinaryMatch {
+			state.matchedFiles[result.Path] = struct{}{}
+		}
+		if state.admitOutput() {
+			state.output(result)
+		}
+	case search.KindFileCount:
+		state.count += result.Count
+		if result.Count > 0 {
+			state.matchedFiles[result.Path] = struct{}{}
+		}
+		if !cfg.Quiet && !cfg.QuietResults {
+			state.output(result)
+		}
+	case search.KindFileDone:
+		// Moves ordered output on to the next file, ending the events of a
+		// file whose matches were streamed.
+		if state.eventPath != "" && state.eventPath == formatPath(result.Path, state.cfg.AbsPath) {
+			state.endEvent(result.Stats)
+		}
+	case search.KindGroup:
+		state.printFileEvent("file_start", result)
+		for _, match := range result.Group {
+			state.handleMatch(match)
+		}
+		state.printFileEvent("file_end", result)
+		state.endEvent(result.Stats)
+	default:
+		state.handleMatch(result)
+	}
+	if result.Stats != nil && cfg.FileStats {
+		state.printFileStats(result)
+	}
+	if result.Outcome == search.OutcomeNoMatch {
+		state.noMatchFiles++
+	}
+	if result.Outcome.Searched() && state.baseline != nil {
+		state.baseline.MarkSearched(result.Path)
+	}
+}
+
+// reorder handles the results of files in the order the walk enqueued them.
+// The file being printed, nextSeq, goes straight through: a streamed file
+// sends its matches as they come, then a last result that ends it. Results
+// of later files are held until their turn, and their readers wait while
+// too many are held. Diagnostics are held until the file they precede is
+// due, and printed just before its results.
+func (state *printState) reorder(result search.Result) {
+	defer state.updateWindow()
+	if result.Kind == search.KindDiagnostic {
+		if result.Seq <= state.nextSeq {
+			state.handle(result)
+			return
+		}
+		state.heldDiagnostics[result.Seq] = append(state.heldDiagnostics[result.Seq], result)
+		state.heldCount++
+		return
+	}
+	if result.Seq != state.nextSeq {
+		state.held[result.Seq] = append(state.held[result.Seq], result)
+		state.heldCount += heldSize(result)
+		return
+	}
+	state.handle(result)
+	done := result.Kind != search.KindMatch
+	for done {
+		state.nextSeq++
+		for _, diagnostic := range state.heldDiagnostics[state.nextSeq] {
+			state.heldCount--
+			state.handle(diagnostic)
+		}
+		delete(state.heldDiagnostics, state.nextSeq)
+		done = false
+		for _, next := range state.held[state.nextSeq] {
+			state.heldCount -= heldSize(next)
+			state.handle(next)
+			done = next.Kind != search.KindMatch
+		}
+		delete(state.held, state.nextSeq)
+	}
+}
+
+// heldSize is what a held result counts against the order window: one, or
+// a group's matches.
+func heldSize(result search.Result) int {
+	return max(len(result.Group), 1)
+}
+
+// updateWindow tells readers waiting on the order window where the printer
+// is.
+func (state *printState) updateWindow() {
+	if state.metrics != nil {
+		state.metrics.Order.Update(state.nextSeq, state.heldCount)
+	}
+}
+
+// flushDiagnostics prints the diagnostics still held when the search ends:
+// those the walk reported after its last file, or, after cancellation,
+// those of files whose results were dropped, which like drain only go to
+// stderr.
+func (state *printState) flushDiagnostics(cancelled bool) {
+	seqs := make([]int64, 0, len(state.heldDiagnostics))
+	for seq := range state.heldDiagnostics {
+		seqs = append(seqs, seq)
+	}
+	slices.Sort(seqs)
+	for _, seq := range seqs {
+		for _, diagnostic := range state.heldDiagnostics[seq] {
+			if cancelled {
+				fmt.Fprintln(state.stderr, diagnostic.Text)
+			} else {
+				state.handle(diagnostic)
+			}
+		}
+	}
+	state.heldDiagnostics = nil
+}
+
+// drain discards the results still in flight after the search was cancelled,
+// starting with first when it is non-nil. Only diagnostics are passed on:
+// dropped results are neither printed nor counted, so what was printed is a
+// prefix of the uncancelled output, cut between results, and counts and exit
+// codes describe exactly that output.
+func (state *printState) drain(results <-chan search.Result, first *search.Result) {
+	state.flush()
+	if first != nil && first.Kind == search.KindDiagnostic {
+		fmt.Fprintln(state.stderr, first.Text)
+	}
+	for result := range results {
+		if result.Kind == search.KindDiagnostic {
+			fmt.Fprintln(state.stderr, result.Text)
+		}
+	}
+}
+
+// printState holds everything the printer goroutine accumulates across results.
+type printState struct {
+	cfg config.Config
+	// stdout buffers what the printer writes to out, the search's stdout;
+	// it is flushed whenever the printer has no result waiting, so output
+	// is as prompt as unbuffered but written in blocks under load.
+	stdout      *bufio.Writer
+	out         *stickyWriter
+	stderr      io.Writer
+	jsonEncoder *json.Encoder
+	// jsonArray is nil unless -format json-array is set; the encoder writes
+	// through it.
+	jsonArray *jsonArrayWriter
+	// metrics supplies the files searched for the json-array summary; it
+	// may be nil.
+	metrics *search.Metrics
+	// replacement is the parsed -replace text.
+	replacement replacement
+	// eol ends every plain and grep output record: "\n", or NUL with -null.
+	eol   string
+	count int
+	// matchedFiles holds the path of every file with a counted match.
+	matchedFiles map[string]struct{}
+	// noMatchFiles counts files whose tracked outcome was no match.
+	noMatchFiles int
+	// sourceCounts holds the match count of each -files-from label.
+	sourceCounts map[string]int
+
+	// With -also-filenames, content matches are held until the walk ends so
+	// every filename hit is printed first.
+	filenameCount int
+	walkDone      bool
+	pending       []search.Result
+
+	dirCounts map[string]int
+	dirOrder  []string
+
+	// baseline is nil unless -baseline is set. Known matches are counted in
+	// knownCount rather than count.
+	baseline    *Baseline
+	knownCount  int
+	baselineErr error
+	templateErr error
+
+	// lastBlockPath and lastBlockLine locate the end of the last context
+	// block printed by -format grep, to place "--" separators.
+	lastBlockPath string
+	lastBlockLine int
+
+	// sarifResults buffers matches for the single document written by
+	// -format sarif when the search ends.
+	sarifResults []sarifResult
+
+	// held holds, in ordered mode, the results that arrived for files after
+	// file nextSeq, the one being printed; heldCount is how many results
+	// it and heldDiagnostics hold, for the order window.
+	held      map[int64][]search.Result
+	heldCount int
+	nextSeq   int64
+	// heldDiagnostics holds per-file diagnostics by the Seq of the file
+	// they are printed before, until that file is due.
+	heldDiagnostics map[int64][]search.Result
+
+	// sorted holds the results to print with -sort, spilling them to
+	// temporary files past -sort-spill.
+	sorted *SpillSorter
+
+	// duplicates is nil unless -show-duplicates is set.
+	duplicates *duplicateTracker
+	// linker is nil unless -hyperlink applies.
+	linker *hyperlinker
+	// split is nil unless -split-output is set; matches go to its files
+	// instead of stdout.
+	split *SplitOutput
+
+	// eventPath is the file whose json-events begin record was printed last,
+	// until its end record is; eventMatches counts its match records.
+	// started is when the printer started, for the summary's elapsed time.
+	eventPath    string
+	eventMatches int
+	started      time.Time
+
+	// invalidSkipped counts lines -json-invalid-utf8 skip left out.
+	invalidSkipped int
+
+	// spill is nil unless -auto-spill applies; printed counts the results
+	// printed so far against its limit.
+	spill   *spillWriter
+	printed int
+
+	// cancel stops the search early, with the cause; see stop.
+	cancel    context.CancelCauseFunc
+	cancelled bool
+	// stopped is why the search stopped early, once it has ended; nil if it
+	// did not.
+	stopped *search.StopCause
+}
+
+type jsonCountSummary struct {
+	Schema int `json:"schema"`
+	Count  int `json:"count"`
+	// Unit is what Count counts: matching "lines", "matches" with
+	// -count-matches, or "files" with -L.
+	Unit          string `json:"unit"`
+	FilenameCount *int   `json:"filename_count,omitempty"`
+	KnownCount    *int   `json:"known_count,omitempty"`
+	FailOver      *int   `json:"fail_over,omitempty"`
+	FailUnder     *int   `json:"fail_under,omitempty"`
+	ThresholdFail bool   `json:"threshold_failed,omitempty"`
+	// Sources holds each -files-from label's match count.
+	Sources []jsonSourceCount `json:"sources,omitempty"`
+	// StoppedReason names why the search stopped early, if it did.
+	StoppedReason string `json:"stopped_reason,omitempty"`
+}
+
+type jsonBaselineResolved struct {
+	Schema int    `json:"schema"`
+	Type   string `json:"type"`
+	Path   string `json:"path"`
+	Text   string `json:"text"`
+}
+
+type jsonDirSummary struct {
+	Schema  int    `json:"schema"`
+	Type    string `json:"type"`
+	Dir     string `json:"dir"`
+	Printed int    `json:"printed"`
+	Omitted int    `json:"omitted"`
+}
+
+// jsonFileEvent brackets a file's records with -file-events.
+type jsonFileEvent struct {
+	Schema    int    `json:"schema"`
+	Type      string `json:"type"`
+	Path      string `json:"path"`
+	PathBytes string `json:"path_bytes,omitempty"`
+	// Matches, SkippedReason, and Outcome are set on file_end only.
+	Matches       *int   `json:"matches,omitempty"`
+	SkippedReason string `json:"skipped_reason,omitempty"`
+	Outcome       string `json:"outcome,omitempty"`
+}
+
+// jsonFileStats reports one scanned file with -file-stats.
+type jsonFileStats struct {
+	Schema     int     `json:"schema"`
+	Type       string  `json:"type"`
+	Path       string  `json:"path"`
+	PathBytes  string  `json:"path_bytes,omitempty"`
+	Lines      int     `json:"lines"`
+	Matches    int     `json:"matches"`
+	Bytes      int64   `json:"bytes"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// jsonFileError is a per-file error in -format json, also printed to stderr.
+type jsonFileError struct {
+	Schema    int    `json:"schema"`
+	Type      string `json:"type"`
+	Path      string `json:"path"`
+	PathBytes string `json:"path_bytes,omitempty"`
+	Category  string `json:"category"`
+	Message   string `json:"message"`
+}
+
+// jsonSummary ends the array printed by -format json-array.
+type jsonSummary struct {
+	Schema        int    `json:"schema"`
+	Type          string `json:"type"`
+	Count         int    `json:"count"`
+	FilesSearched int64  `json:"files_searched"`
+	// Sources holds each -files-from label's match count.
+	Sources []jsonSourceCount `json:"sources,omitempty"`
+	// StoppedReason names why the search stopped early, if it did.
+	StoppedReason string `json:"stopped_reason,omitempty"`
+}
+
+// jsonArrayWriter turns the newline-terminated records a json.Encoder
+// writes, one per Write, into the elements of a single JSON array.
+type jsonArrayWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (writer *jsonArrayWriter) Write(p []byte) (int, error) {
+	separator := ",\n"
+	if !writer.started {
+		separator = "[\n"
+		writer.started = true
+	}
+	if _, err := io.WriteString(writer.w, separator+strings.TrimSuffix(string(p), "\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// close ends the array; it must be called even when nothing was written.
+func (writer *jsonArrayWriter) close() {
+	if !writer.started {
+		_, _ = io.WriteString(writer.w, "[]\n")
+		return
+	}
+	_, _ = io.WriteString(writer.w, "\n]\n")
+}
+
+func newPrintState(cfg config.Config, stdout io.Writer, stderr io.Writer) *printState {
+	var spill *spillWriter
+	if cfg.AutoSpill > 0 {
+		spill = &spillWriter{terminal: stdout}
+		stdout = spill
+	}
+	out := &stickyWriter{w: stdout}
+	buffered := bufio.NewWriterSize(out, 64*1024)
+	var records io.Writer = buffered
+	var array *jsonArrayWriter
+	if cfg.JSONArray && (!cfg.Quiet || cfg.CountOnly) {
+		array = &jsonArrayWriter{w: buffered}
+		records = array
+	}
+	var duplicates *duplicateTracker
+	if cfg.ShowDuplicates {
+		duplicates = newDuplicateTracker()
+	}
+	eol := "\n"
+	if cfg.NullTerminate {
+		eol = "\x00"
+	}
+	var started time.Time
+	if cfg.JSONEvents {
+		started = cfg.Clock.Now()
+	}
+	return &printState{
+		cfg:             cfg,
+		stdout:          buffered,
+		out:             out,
+		stderr:          stderr,
+		jsonEncoder:     json.NewEncoder(records),
+		jsonArray:       array,
+		eol:             eol,
+		replacement:     parseReplacement(cfg.Replacement, cfg.Regex),
+		dirCounts:       make(map[string]int),
+		matchedFiles:    make(map[string]struct{}),
+		held:            make(map[int64][]search.Result),
+		heldDiagnostics: make(map[int64][]search.Result),
+		nextSeq:         1,
+		duplicates:      duplicates,
+		linker:          newHyperlinker(cfg),
+		spill:           spill,
+		started:         started,
+	}
+}
+
+// printRecord writes one plain or grep output record followed by the record
+// terminator.
+func (state *printState) printRecord(format string, args ...any) {
+	fmt.Fprintf(state.stdout, format, args...)
+	_, _ = state.stdout.WriteString(state.eol)
+}
+
+// writeRecord is printRecord for records that are only strings put
+// together, as matches and context lines are: it writes the parts as they
+// are, without formatting them.
+func (state *printState) writeRecord(parts ...string) {
+	for _, part := range parts {
+		_, _ = state.stdout.WriteString(part)
+	}
+	_, _ = state.stdout.WriteString(state.eol)
+}
+
+// flush writes out what the printer has buffered. A failed write is left in
+// out.err for checkWrite and the summary.
+func (state *printState) flush() {
+	_ = state.stdout.Flush()
+}
+
+func (state *printState) summary() PrintSummary {
+	return PrintSummary{MatchCount: state.count, FilenameCount: state.filenameCount, MatchedFiles: len(state.matchedFiles), NoMatchFiles: state.noMatchFiles, BaselineErr: state.baselineErr, TemplateErr: state.templateErr, WriteErr: state.out.err}
+}
+
+// tallyMatch counts a content match and reports whether it is new. Without a
+// baseline to compare against every match is new.
+func (state *printState) tallyMatch(result search.Result) bool {
+	if state.baseline != nil {
+		if state.cfg.BaselineWrite {
+			state.recordBaseline(result)
+		} else if state.baseline.Known(result.Path, result.Text) {
+			state.knownCount += state.weight(result)
+			return false
+		}
+	}
+	state.count += state.weight(result)
+	state.matchedFiles[result.Path] = struct{}{}
+	state.countSource(result.Path, state.weight(result))
+	return true
+}
+
+// recordBaseline adds a match to the baseline -baseline-write is writing.
+func (state *printState) recordBaseline(result search.Result) {
+	display := result.Text
+	if state.cfg.Redact {
+		display, _, _ = redactRanges(result.Text, result.Ranges)
+	}
+	state.baseline.Record(result.Path, result.Text, display)
+}
+
+// weight is what a content match adds to the count: one for its line, or
+// with -count-matches one for each match on it.
+func (state *printState) weight(result search.Result) int {
+	if state.cfg.CountMatches {
+		return result.MatchCount()
+	}
+	return 1
+}
+
+// handleMatch counts a content match and prints it, unless -quiet or -count
+// suppress output or -also-filenames is still holding content back.
+// -baseline-write keeps the search going past -1 and -max-results, so the
+// baseline holds every match, but what is counted and printed stops there.
+func (state *printState) handleMatch(result search.Result) {
+	cfg := state.cfg
+	if (cfg.FirstMatch && state.count > 0) || (cfg.MaxResults > 0 && state.count >= cfg.MaxResults) {
+		if state.baseline != nil && cfg.BaselineWrite {
+			state.recordBaseline(result)
+		}
+		return
+	}
+	if !state.tallyMatch(result) {
+		if cfg.OutputFormat == "json" && !cfg.Quiet && !cfg.CountOnly {
+			state.writeMatch(result, "known")
+		}
+		return
+	}
+	if state.duplicates != nil {
+		display := result.Text
+		if cfg.Redact {
+			display, _, _ = redactRanges(result.Text, result.Ranges)
+		}
+		state.duplicates.add(result, display)
+	}
+	if !state.admitOutput() {
+		return
+	}
+	if !cfg.BaselineWrite {
+		if cfg.FirstMatch {
+			state.stop(search.StopFirstMatch)
+		} else if cfg.MaxResults > 0 && state.count >= cfg.MaxResults {
+			state.stop(search.StopMaxResults)
+		}
+	}
+	if cfg.AlsoFilenames && !state.walkDone {
+		state.pending = append(state.pending, result)
+		return
+	}
+	state.output(result)
+}
+
+// checkWrite cancels the search after the first failed write to stdout:
+// nobody is reading what would be produced.
+func (state *printState) checkWrite() {
+	if state.out.err == nil {
+		return
+	}
+	if IsBrokenPipe(state.out.err) {
+		state.stop(search.StopBrokenPipe)
+	} else {
+		state.stop(search.StopWriteError)
+	}
+}
+
+// stoppedReason is the "stopped_reason" of JSON summaries: why the search
+// stopped early, or "".
+func (state *printState) stoppedReason() string {
+	if state.stopped == nil {
+		return ""
+	}
+	return state.stopped.Reason
+}
+
+// stop cancels the search with cause, unless it was already cancelled.
+func (state *printState) stop(cause *search.StopCause) {
+	if !state.cancelled {
+		state.cancel(cause)
+		state.cancelled = true
+	}
+}
+
+// admitOutput reports whether a counted hit should be printed. Under -quiet
+// the first hit cancels the search, unless thresholds need the full count or
+// -baseline-write every match.
+func (state *printState) admitOutput() bool {
+	cfg := state.cfg
+	if cfg.Quiet {
+		if !cfg.CountOnly && !cfg.HasThresholds() && !cfg.BaselineWrite {
+			state.stop(search.StopQuiet)
+		}
+		return false
+	}
+	return !cfg.CountOnly && !cfg.QuietResults
+}
+
+// baselineTag labels new results in JSON while a baseline is being compared.
+func (state *printState) baselineTag() string {
+	if state.baseline == nil || state.cfg.BaselineWrite {
+		return ""
+	}
+	return "new"
+}
+
+func (state *printState) flushPending() {
+	for _, result := range state.pending {
+		state.output(result)
+	}
+	state.pending = nil
+}
+
+// output prints a counted result, or with -sort holds it until the search
+// ends.
+func (state *printState) output(result search.Result) {
+	if state.cfg.Sort != "" {
+		state.holdSorted(result)
+		return
+	}
+	state.print(result)
+}
+
+// print prints a result that passed counting and -quiet.
+func (state *printState) print(result search.Result) {
+	state.countPrinted()
+	switch result.Kind {
+	case search.KindFileWithoutMatch:
+		state.printWithoutMatch(result)
+	case search.KindBinaryMatch:
+		state.printRecord("Binary file %s matches", formatPath(result.Path, state.cfg.AbsPath))
+	case search.KindFileCount:
+		state.printRecord("%s:%d", formatPath(result.Path, state.cfg.AbsPath), result.Count)
+	default:
+		if state.admitDir(result.Path) {
+			state.writeMatch(result, state.baselineTag())
+		}
+	}
+}
+
+// writeMatch prints a match on stdout, or with -split-output to the files
+// of the patterns that matched it.
+func (state *printState) writeMatch(result search.Result, baselineTag string) {
+	if state.split != nil {
+		state.split.print(result, baselineTag)
+		return
+	}
+	state.printMatch(result, baselineTag)
+}
+
+func (state *printState) printFilename(result search.Result) {
+	pathText := formatPath(result.Path, state.cfg.AbsPath)
+	if state.cfg.OutputFormat == "json" {
+		_ = state.jsonEncoder.Encode(jsonResult{Schema: JSONSchemaVersion, Kind: "filename", Path: pathText, PathBytes: pathBytes(pathText)})
+		return
+	}
+	state.writeRecord(state.linker.link(pathText, pathText, 0), " (filename match)")
+}
+
+// printWithoutMatch prints a file listed by -L, one path per line.
+func (state *printState) printWithoutMatch(result search.Result) {
+	pathText := formatPath(result.Path, state.cfg.AbsPath)
+	if state.cfg.OutputFormat == "json" {
+		_ = state.jsonEncoder.Encode(jsonResult{Schema: JSONSchemaVersion, Kind: "without_match", Path: pathText, PathBytes: pathBytes(pathText)})
+		return
+	}
+	state.writeRecord(state.linker.link(pathText, pathText, 0))
+}
+
+// printFileEvent prints a -file-events record for a file's group: file_start
+// before its matches, and file_end with the match count and any skip reason.
+func (state *printState) printFileEvent(eventType string, result search.Result) {
+	if !state.cfg.FileEvents || state.cfg.Quiet {
+		return
+	}
+	pathText := formatPath(result.Path, state.cfg.AbsPath)
+	event := jsonFileEvent{Schema: JSONSchemaVersion, Type: eventType, Path: pathText, PathBytes: pathBytes(pathText)}
+	if eventType == "file_end" {
+		matches := len(result.Group)
+		event.Matches = &matches
+		event.SkippedReason = result.SkipReason
+		event.Outcome = result.Outcome.String()
+	}
+	_ = state.jsonEncoder.Encode(event)
+}
+
+// printFileStats reports a scanned file's -file-stats as a JSON record, or
+// on stderr when the format is not JSON or -quiet keeps records off stdout.
+func (state *printState) printFileStats(result search.Result) {
+	stats, pathText := result.Stats, formatPath(result.Path, state.cfg.AbsPath)
+	if state.cfg.OutputFormat == "json" && !state.cfg.Quiet {
+		_ = state.jsonEncoder.Encode(jsonFileStats{Schema: JSONSchemaVersion, Type: "file_stats", Path: pathText, PathBytes: pathBytes(pathText), Lines: stats.Lines, Matches: stats.Matches, Bytes: stats.Bytes, DurationMs: durationMs(stats.Duration)})
+		return
+	}
+	fmt.Fprintf(state.stderr, "file-stats %s: lines=%d matches=%d bytes=%d duration=%s\n", pathText, stats.Lines, stats.Matches, stats.Bytes, stats.Duration.Round(time.Microsecond))
+}
+
+// printFileError prints a per-file error diagnostic as a JSON error record.
+func (state *printState) printFileError(result search.Result) {
+	if result.ErrorCategory == "" || state.cfg.OutputFormat != "json" || state.cfg.Quiet {
+		return
+	}
+	pathText := formatPath(result.Path, state.cfg.AbsPath)
+	_ = state.jsonEncoder.Encode(jsonFileError{Schema: JSONSchemaVersion, Type: "error", Path: pathText, PathBytes: pathBytes(pathText), Category: result.ErrorCategory, Message: result.Text})
+}
+
+// admitDir applies -max-per-dir, keyed by the immediate parent directory of
+// the result path. Capped matches are still counted toward the total.
+func (state *printState) admitDir(pathText string) bool {
+	if state.cfg.MaxPerDir <= 0 {
+		return true
+	}
+	dir := filepath.Dir(pathText)
+	seen := state.dirCounts[dir]
+	if seen == state.cfg.MaxPerDir {
+		state.dirOrder = append(state.dirOrder, dir)
+	}
+	state.dirCounts[dir] = seen + 1
+	return seen < state.cfg.MaxPerDir
+}
+
+func (state *printState) printMatch(result search.Result, baselineTag string) {
+	cfg := state.cfg
+	pathText := formatPath(result.Path, cfg.AbsPath)
+	if result.Kind == search.KindByteMatch {
+		state.printByteMatch(result, pathText, baselineTag)
+		return
+	}
+	text, ranges := result.Text, result.Ranges
+	var entropy []float64
+	if cfg.MinEntropy > 0 {
+		for _, match := range ranges {
+			entropy = append(entropy, math.Round(search.ShannonEntropy(text[match.Start:match.End])*1000)/1000)
+		}
+	}
+	var redactedLengths []int
+	if cfg.Redact {
+		text, ranges, redactedLengths = redactRanges(text, ranges)
+	}
+	switch cfg.OutputFormat {
+	case "json-v1":
+		out := jsonResultV1{Path: pathText, Text: text}
+		if cfg.ShowLineNumbers {
+			line := result.Line
+			out.Line = &line
+		}
+		_ = state.jsonEncoder.Encode(out)
+	case "json":
+		if !state.admitJSONText(text) {
+			return
+		}
+		if cfg.JSONEvents {
+			state.printMatchEvent(result, pathText, text, ranges, baselineTag)
+			return
+		}
+		out := jsonResult{Schema: JSONSchemaVersion, Path: pathText, PathBytes: pathBytes(pathText), Text: text, Source: cfg.FilesFrom.Label(result.Path), Baseline: baselineTag, RedactedLengths: redactedLengths, Entropy: entropy, Captures: jsonCaptures(result.Text, result.Ranges, cfg.OffsetUnit)}
+		if cfg.MaxColumnsJSON {
+			out.Text, _, out.Truncated = truncateLine(text, nil, cfg.MaxColumns)
+		}
+		out.Text, _, out.Bytes = state.jsonText(out.Text, nil)
+		if cfg.Replace {
+			replaced, _ := replaceRanges(text, ranges, state.replacement)
+			if cfg.MaxColumnsJSON {
+				replaced, _, _ = truncateLine(replaced, nil, cfg.MaxColumns)
 			}
+			replaced, _, _ = state.jsonText(replaced, nil)
+			out.Replaced = &replaced
+		}
+		if cfg.ShowLineNumbers {
+			line := result.Line
+			out.Line = &line
+		}
+		if cfg.ByteOffset {
+			offset := result.Offset
+			out.Offset = &offset
+		}
+		if len(result.Before) > 0 || len(result.After) > 0 {
+			out.Context = &jsonContext{Before: state.jsonContextLines(result.Before), After: state.jsonContextLines(result.After)}
+		}
+		if cfg.WithMetadata && result.Meta != nil {
+			size := result.Meta.Size
+			out.Size = &size
+			out.ModTime = result.Meta.ModTime.UTC().Format(time.RFC3339)
+			out.Mode = result.Meta.Mode.String()
+		}
+		_ = state.jsonEncoder.Encode(out)
+	case "sarif":
+		state.addSarif(result, text, baselineTag)
+	case "template":
+		state.printTemplate(templateRecord{Path: pathText, Line: result.Line, Offset: result.Offset, Text: text, Ranges: ranges, Before: result.Before, After: result.After})
+	case "grep":
+		if cfg.Replace {
+			text, ranges = replaceRanges(text, ranges, state.replacement)
+		}
+		text, _, suffix := state.limitColumns(text, ranges)
+		text += suffix
+		state.printGroupSeparator(result)
+		state.printContext(pathText, result.Before)
+		state.writeRecord(state.sourcePrefix(result.Path), state.linePrefix(pathText, result.Line, result.Offset, ":"), text)
+		state.printContext(pathText, result.After)
+	default:
+		if cfg.Replace {
+			text, ranges = replaceRanges(text, ranges, state.replacement)
+		}
+		text, ranges = escapeControls(text, ranges, cfg.Escape)
+		text, ranges, suffix := state.limitColumns(text, ranges)
+		if cfg.Color {
+			text = highlightRanges(text, ranges)
+		}
+		text += suffix
+		if cfg.WithMetadata && result.Meta != nil {
+			text += formatMetaSuffix(result.Meta)
+		}
+		if redactedLengths != nil {
+			text += formatRedactedSuffix(redactedLengths)
+		}
+		state.printGroupSeparator(result)
+		state.printContext(pathText, result.Before)
+		state.writeRecord(state.sourcePrefix(result.Path), state.linePrefix(pathText, result.Line, result.Offset, ":"), " ", text)
+		state.printContext(pathText, result.After)
+	}
+}
 
-			pathText := formatPath(result.Path, cfg.AbsPath)
+// printByteMatch prints a -hex-pattern occurrence by its byte offset, e.g.
+// "path: offset 0x1A2B (match)"; JSON records carry the offset in decimal.
+func (state *printState) printByteMatch(result search.Result, pathText string, baselineTag string) {
+	if state.cfg.OutputFormat == "json" {
+		offset := result.Offset
+		_ = state.jsonEncoder.Encode(jsonResult{Schema: JSONSchemaVersion, Kind: "byte_match", Path: pathText, PathBytes: pathBytes(pathText), Offset: &offset, Text: result.Text, Source: state.cfg.FilesFrom.Label(result.Path), Baseline: baselineTag})
+		return
+	}
+	state.printRecord("%s%s: offset 0x%X (match)", state.sourcePrefix(result.Path), state.linker.link(state.colorize(colorPath, pathText), pathText, 0), result.Offset)
+}
+
+// printGroupSeparator prints -group-separator ("--", as in grep) between
+// context blocks that are not contiguous, including blocks of different
+// files, and remembers where the block for result ends.
+func (state *printState) printGroupSeparator(result search.Result) {
+	cfg := state.cfg
+	if (cfg.ContextBefore == 0 && cfg.ContextAfter == 0) || cfg.NoGroupSeparator {
+		return
+	}
+	first, last := result.Line, result.Line
+	if len(result.Before) > 0 {
+		first = result.Before[0].Line
+	}
+	if len(result.After) > 0 {
+		last = result.After[len(result.After)-1].Line
+	}
+	if state.lastBlockPath != "" && (state.lastBlockPath != result.Path || state.lastBlockLine+1 != first) {
+		state.writeRecord(cfg.GroupSeparator)
+	}
+	state.lastBlockPath, state.lastBlockLine = result.Path, last
+}
+
+// printContext prints context lines grep-style, with '-' in place of the
+// ':' separators used for matches.
+func (state *printState) printContext(pathText string, lines []search.ContextLine) {
+	gap := " "
+	if state.cfg.OutputFormat == "grep" {
+		gap = ""
+	}
+	for _, line := range lines {
+		text := line.Text
+		if state.cfg.OutputFormat == "plain" {
+			text, _ = escapeControls(text, nil, state.cfg.Escape)
+		}
+		text, _, suffix := state.limitColumns(text, nil)
+		state.writeRecord(state.linePrefix(pathText, line.Line, line.Offset, "-"), gap, text, suffix)
+	}
+}
+
+// linePrefix builds the "path:line:offset:" location of a plain output line,
+// leaving out the line number and byte offset unless -n and -b ask for them.
+// With color the path and numbers are colored, but not the separators; with
+// -hyperlink the path links to the line.
+func (state *printState) linePrefix(pathText string, line int, offset int64, separator string) string {
+	prefix := state.linker.link(state.colorize(colorPath, pathText), pathText, line)
+	if state.cfg.ShowLineNumbers {
+		prefix += separator + state.colorize(colorLineNumber, strconv.Itoa(line))
+	}
+	if state.cfg.ByteOffset {
+		prefix += separator + state.colorize(colorLineNumber, strconv.FormatInt(offset, 10))
+	}
+	return prefix + separator
+}
+
+// colorize wraps text in an ANSI color when color is on. Only plain output is
+// colored: -format grep feeds tools that parse grep's lines, and like the
+// other machine formats never contains escapes.
+func (state *printState) colorize(color string, text string) string {
+	if !state.cfg.Color || state.cfg.OutputFormat != "plain" {
+		return text
+	}
+	return color + text + colorReset
+}
+
+func (state *printState) jsonContextLines(lines []search.ContextLine) []jsonContextLine {
+	if len(lines) == 0 {
+		return nil
+	}
+	out := make([]jsonContextLine, 0, len(lines))
+	for _, line := range lines {
+		if !state.admitJSONText(line.Text) {
+			continue
+		}
+		record := jsonContextLine{Line: line.Line, Text: line.Text}
+		if state.cfg.MaxColumnsJSON {
+			record.Text, _, record.Truncated = truncateLine(line.Text, nil, state.cfg.MaxColumns)
+		}
+		record.Text, _, record.Bytes = state.jsonText(record.Text, nil)
+		if state.cfg.ByteOffset {
+			offset := line.Offset
+			record.Offset = &offset
+		}
+		out = append(out, record)
+	}
+	return out
+}
+
+func (state *printState) finalize() {
+	cfg := state.cfg
+	state.flushPending()
+	state.flushSorted()
+	if !cfg.Quiet && !cfg.CountOnly {
+		for _, dir := range state.dirOrder {
+			omitted := state.dirCounts[dir] - cfg.MaxPerDir
+			dirText := formatPath(dir, cfg.AbsPath)
 			switch cfg.OutputFormat {
+			case "json-v1", "sarif":
+				// v1 and SARIF have no directory summaries.
 			case "json":
-				out := jsonResult{Path: pathText, Text: result.Text}
-				if cfg.ShowLineNumbers {
-					line := result.Line
-					out.Line = &line
-				}
-				_ = jsonEncoder.Encode(out)
+				_ = state.jsonEncoder.Encode(jsonDirSummary{Schema: JSONSchemaVersion, Type: "dir_capped", Dir: dirText, Printed: cfg.MaxPerDir, Omitted: omitted})
 			default:
-				text := result.Text
-				if cfg.Color {
-					text = highlightRanges(text, result.Ranges)
-				}
-				if cfg.ShowLineNumbers {
-					fmt.Fprintf(stdout, "%s:%d: %s\n", pathText, result.Line, text)
-				} else {
-					fmt.Fprintf(stdout, "%s: %s\n", pathText, text)
-				}
+				state.printRecord("%s: … and %d more matches in this directory", dirText, omitted)
 			}
 		}
+		state.printResolved()
+	}
+	if state.duplicates != nil && !cfg.Quiet {
+		state.printDuplicates()
+	}
+	if state.split != nil {
+		state.printSplitSummary()
+	}
+	if state.baseline != nil && cfg.BaselineWrite {
+		state.baselineErr = state.baseline.Write(cfg.BaselinePath)
+	}
+
+	// -quiet silences matches, not the total -count asks for; only -format
+	// grep, like grep -q -c, prints nothing.
+	if cfg.CountOnly && cfg.OutputFormat != "grep" {
+		switch {
+		case cfg.OutputFormat == "json-v1":
+			_ = state.jsonEncoder.Encode(jsonCountSummaryV1{Count: state.count})
+		case cfg.OutputFormat == "json":
+			out := jsonCountSummary{Schema: JSONSchemaVersion, Count: state.count, Unit: "lines", StoppedReason: state.stoppedReason()}
+			switch {
+			case cfg.FilesWithoutMatch:
+				out.Unit = "files"
+			case cfg.CountMatches:
+				out.Unit = "matches"
+			}
+			if cfg.AlsoFilenames {
+				out.FilenameCount = &state.filenameCount
+			}
+			if state.baselineTag() != "" {
+				out.KnownCount = &state.knownCount
+			}
+			if cfg.FailOver >= 0 {
+				out.FailOver = &cfg.FailOver
+			}
+			if cfg.FailUnder >= 0 {
+				out.FailUnder = &cfg.FailUnder
+			}
+			out.ThresholdFail = ThresholdViolation(cfg, state.count) != ""
+			out.Sources = state.sourceSummary()
+			_ = state.jsonEncoder.Encode(out)
+		case cfg.AlsoFilenames:
+			state.printRecord("filenames: %d", state.filenameCount)
+			state.printRecord("content: %d", state.count)
+		default:
+			state.printRecord("%d", state.count)
+		}
+		if cfg.OutputFormat != "json" && cfg.OutputFormat != "json-v1" {
+			for _, source := range state.sourceSummary() {
+				state.printRecord("source %s: %d", source.Source, source.Count)
+			}
+		}
+	}
+	if cfg.OutputFormat == "sarif" && !cfg.Quiet {
+		state.writeSarif()
+	}
+	if state.invalidSkipped > 0 {
+		fmt.Fprintf(state.stderr, "json-invalid-utf8: skipped %d lines that are not valid UTF-8\n", state.invalidSkipped)
+	}
+	if cfg.JSONEvents && !cfg.Quiet {
+		state.printSummaryEvent()
+	}
+	if state.jsonArray != nil {
+		summary := jsonSummary{Schema: JSONSchemaVersion, Type: "summary", Count: state.count, Sources: state.sourceSummary(), StoppedReason: state.stoppedReason()}
+		if state.metrics != nil {
+			summary.FilesSearched = state.metrics.FilesScanned.Load()
+		}
+		_ = state.jsonEncoder.Encode(summary)
+		state.jsonArray.close()
 	}
 }
 
-func finalizePrint(count int, cfg config.Config, jsonEncoder *json.Encoder, stdout io.Writer) {
-	if cfg.CountOnly && !cfg.Quiet {
-		if cfg.OutputFormat == "json" {
-			_ = jsonEncoder.Encode(map[string]int{"count": count})
-		} else {
-			fmt.Fprintln(stdout, count)
+// printResolved reports baseline entries that no longer match anywhere.
+func (state *printState) printResolved() {
+	if state.baselineTag() == "" {
+		return
+	}
+	for _, entry := range state.baseline.Resolved() {
+		pathText := formatPath(state.baseline.AbsPath(entry), state.cfg.AbsPath)
+		switch state.cfg.OutputFormat {
+		case "json-v1", "sarif":
+			// v1 and SARIF have no baseline records.
+		case "json":
+			_ = state.jsonEncoder.Encode(jsonBaselineResolved{Schema: JSONSchemaVersion, Type: "baseline_resolved", Path: pathText, Text: entry.Text})
+		default:
+			state.printRecord("%s: resolved: %s", pathText, entry.Text)
 		}
 	}
 }
 
+// ThresholdViolation returns a message describing how count breaks
+// -fail-over or -fail-under, or "" when it satisfies both.
+func ThresholdViolation(cfg config.Config, count int) string {
+	if cfg.FailOver >= 0 && count > cfg.FailOver {
+		return fmt.Sprintf("fail-over: %d matches exceeds threshold of %d", count, cfg.FailOver)
+	}
+	if cfg.FailUnder >= 0 && count < cfg.FailUnder {
+		return fmt.Sprintf("fail-under: %d matches is below threshold of %d", count, cfg.FailUnder)
+	}
+	return ""
+}
+
+func formatMetaSuffix(meta *search.FileMeta) string {
+	return fmt.Sprintf(" [size=%d mtime=%s mode=%s]", meta.Size, meta.ModTime.UTC().Format(time.RFC3339), meta.Mode)
+}
+
 func formatPath(pathText string, absolute bool) string {
 	if !absolute {
 		return pathText
@@ -113,6 +1214,18 @@ func formatPath(pathText string, absolute bool) string {
 	return abs
 }
 
+// ANSI colors of plain output, as in grep and ripgrep.
+const (
+	colorMatch      = "\x1b[31m"
+	colorPath       = "\x1b[35m"
+	colorLineNumber = "\x1b[32m"
+	colorReset      = "\x1b[0m"
+)
+
+// colorGroups are the colors of a -regex pattern's capture groups, taken in
+// turn by group number. None is a color already used for something else.
+var colorGroups = []string{"\x1b[33m", "\x1b[36m", "\x1b[34m", "\x1b[93m", "\x1b[96m", "\x1b[94m"}
+
 func highlightRanges(line string, ranges []search.MatchRange) string {
 	if len(ranges) == 0 {
 		return line
@@ -121,19 +1234,69 @@ func highlightRanges(line string, ranges []search.MatchRange) string {
 	var builder strings.Builder
 	last := 0
 	for _, match := range ranges {
-		if match.Start < last || match.Start > len(line) || match.End > len(line) {
+		if match.Start > len(line) || match.End > len(line) {
 			continue
 		}
+		if match.Start < last {
+			// An -overlapping match continues the highlight of the one before.
+			if match.End <= last {
+				continue
+			}
+			match.Start = last
+		}
 		builder.WriteString(line[last:match.Start])
-		builder.WriteString("\x1b[31m")
-		builder.WriteString(line[match.Start:match.End])
-		builder.WriteString("\x1b[0m")
+		writeHighlight(&builder, line, match)
 		last = match.End
 	}
 	builder.WriteString(line[last:])
 	return builder.String()
 }
 
+// writeHighlight writes the text of match in colorMatch, except what its
+// capture groups matched, which takes the group's color, or where groups
+// nest the innermost one's. The color is switched in place and reset once
+// at the end, so escape sequences never nest.
+func writeHighlight(builder *strings.Builder, line string, match search.MatchRange) {
+	if match.Captures == nil {
+		builder.WriteString(colorMatch)
+		builder.WriteString(line[match.Start:match.End])
+		builder.WriteString(colorReset)
+		return
+	}
+	bounds := []int{match.Start, match.End}
+	for _, capture := range *match.Captures {
+		for _, bound := range []int{capture.Start, capture.End} {
+			if bound > match.Start && bound < match.End {
+				bounds = append(bounds, bound)
+			}
+		}
+	}
+	slices.Sort(bounds)
+	bounds = slices.Compact(bounds)
+	current := ""
+	for i := 0; i+1 < len(bounds); i++ {
+		if color := groupColor(*match.Captures, bounds[i]); color != current {
+			builder.WriteString(color)
+			current = color
+		}
+		builder.WriteString(line[bounds[i]:bounds[i+1]])
+	}
+	builder.WriteString(colorReset)
+}
+
+// groupColor returns the color of the text at offset: that of the shortest
+// group covering it, the later one of two as long, or colorMatch when no
+// group does.
+func groupColor(captures []search.Capture, offset int) string {
+	color, length := colorMatch, -1
+	for number, capture := range captures {
+		if capture.Start <= offset && offset < capture.End && (length < 0 || capture.End-capture.Start <= length) {
+			color, length = colorGroups[number%len(colorGroups)], capture.End-capture.Start
+		}
+	}
+	return color
+}
+
 // PrintMetrics prints worker lifecycle metrics.
 func PrintMetrics(stderr io.Writer, metrics *search.Metrics) {
 	ioLive := metrics.IOWorkersStarted.Load() - metrics.IOWorkersStopped.Load()
@@ -143,7 +1306,7 @@ func PrintMetrics(stderr io.Writer, metrics *search.Metrics) {
 
 	fmt.Fprintf(
 		stderr,
-		"metrics io(started=%d,stopped=%d,active=%d,idle=%d,max_active=%d) cpu(started=%d,stopped=%d,active=%d,idle=%d,max_active=%d,scaleups=%d) files(enqueued=%d,scanned=%d) lines(enqueued=%d,processed=%d) matches=%d\n",
+		"metrics io(started=%d,stopped=%d,active=%d,idle=%d,max_active=%d) cpu(started=%d,stopped=%d,active=%d,idle=%d,max_active=%d,scaleups=%d) decompress(started=%d,stopped=%d,active=%d,max_active=%d,scaleups=%d,files=%d) decompress_errors(gzip=%d,zstd=%d,xz=%d) dirs(entered=%d,pruned_ignore=%d,pruned_default=%d,pruned_depth=%d,pruned_marker=%d,read_errors=%d,max_depth=%d) ignore_cache(hits=%d,misses=%d) files(enqueued=%d,scanned=%d,skipped_generated=%d,skipped_export_ignore=%d,skipped_encoding=%d,transcoded=%d) errors(permission=%d,not_found=%d,io=%d,too_large=%d,binary=%d,encoding=%d,timeout=%d) symlinks(not_followed=%d,ignored=%d,followed_file=%d,followed_dir=%d,loop_skipped=%d,dangling=%d,error=%d,reparse_skipped=%d,outside_root=%d) lines(enqueued=%d,processed=%d) matches=%d\n",
 		metrics.IOWorkersStarted.Load(),
 		metrics.IOWorkersStopped.Load(),
 		metrics.IOActiveWorkers.Load(),
@@ -155,19 +1318,78 @@ func PrintMetrics(stderr io.Writer, metrics *search.Metrics) {
 		search.MaxInt64(0, cpuIdle),
 		metrics.CPUMaxActive.Load(),
 		metrics.ScaleUps.Load(),
+		metrics.DecompressWorkersStarted.Load(),
+		metrics.DecompressWorkersStopped.Load(),
+		metrics.DecompressActiveWorkers.Load(),
+		metrics.DecompressMaxActive.Load(),
+		metrics.DecompressScaleUps.Load(),
+		metrics.FilesDecompressed.Load(),
+		metrics.DecompressErrors.Count(search.FormatGzip),
+		metrics.DecompressErrors.Count(search.FormatZstd),
+		metrics.DecompressErrors.Count(search.FormatXz),
+		metrics.DirsEntered.Load(),
+		metrics.DirsPrunedIgnore.Load(),
+		metrics.DirsPrunedDefault.Load(),
+		metrics.DirsPrunedDepth.Load(),
+		metrics.DirsPrunedMarker.Load(),
+		metrics.DirReadErrors.Load(),
+		metrics.MaxDepth.Load(),
+		metrics.IgnoreCacheHits.Load(),
+		metrics.IgnoreCacheMisses.Load(),
 		metrics.FilesEnqueued.Load(),
 		metrics.FilesScanned.Load(),
+		metrics.FilesSkippedGenerated.Load(),
+		metrics.FilesSkippedExportIgnore.Load(),
+		metrics.FilesSkippedEncoding.Load(),
+		metrics.FilesTranscoded.Load(),
+		metrics.FileErrors.Count(search.ErrorPermission),
+		metrics.FileErrors.Count(search.ErrorNotFound),
+		metrics.FileErrors.Count(search.ErrorIO),
+		metrics.FileErrors.Count(search.ErrorTooLarge),
+		metrics.FileErrors.Count(search.ErrorBinary),
+		metrics.FileErrors.Count(search.ErrorEncoding),
+		metrics.FileErrors.Count(search.ErrorTimeout),
+		metrics.Symlinks.Count(search.SymlinkNotFollowed),
+		metrics.Symlinks.Count(search.SymlinkIgnored),
+		metrics.Symlinks.Count(search.SymlinkFollowedFile),
+		metrics.Symlinks.Count(search.SymlinkFollowedDir),
+		metrics.Symlinks.Count(search.SymlinkLoop),
+		metrics.Symlinks.Count(search.SymlinkDangling),
+		metrics.Symlinks.Count(search.SymlinkError),
+		metrics.Symlinks.Count(search.SymlinkReparseSkipped),
+		metrics.Symlinks.OutsideRoot(),
 		metrics.LinesEnqueued.Load(),
 		metrics.LinesProcessed.Load(),
 		metrics.MatchesProduced.Load(),
 	)
 }
 
+// PrintPhaseMemory prints the peak heap, peak memory obtained from the OS,
+// and garbage collections of each phase, in bytes.
+func PrintPhaseMemory(stderr io.Writer, memory search.PhaseMemory) {
+	phase := func(peak search.MemoryPeak) string {
+		return fmt.Sprintf("peak_heap=%d,peak_sys=%d,gc=%d", peak.HeapAlloc, peak.Sys, peak.NumGC)
+	}
+	fmt.Fprintf(
+		stderr,
+		"memory walk(%s) scan(%s) print(%s) total(%s)\n",
+		phase(memory.Walk),
+		phase(memory.Scan),
+		phase(memory.Print),
+		phase(memory.Total),
+	)
+}
+
 // PrintPhaseTimings prints timing information for each phase.
 func PrintPhaseTimings(stderr io.Writer, timings search.PhaseTimings) {
+	precount := ""
+	if timings.PreCount > 0 {
+		precount = fmt.Sprintf("precount=%s ", timings.PreCount)
+	}
 	fmt.Fprintf(
 		stderr,
-		"timings walk=%s scan=%s print=%s total=%s\n",
+		"timings %swalk=%s scan=%s print=%s total=%s\n",
+		precount,
 		timings.Walk,
 		timings.Scan,
 		timings.Print,
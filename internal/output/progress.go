@@ -0,0 +1,95 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/vennictus/gosearch/internal/config"
+	"github.com/vennictus/gosearch/internal/search"
+)
+
+// progressInterval is how often the -progress line is redrawn.
+const progressInterval = 200 * time.Millisecond
+
+// ReportProgress draws the -progress line on stderr until stop is closed,
+// redrawing it in place, then ends it with a line saying what the search
+// read. total is what the pre-count found with -progress=full or estimate,
+// and nil with -progress=counts. done is closed once the last line is out.
+func ReportProgress(cfg config.Config, stderr io.Writer, metrics *search.Metrics, total *search.WorkTotal, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := cfg.Clock.NewTicker(progressInterval)
+	defer ticker.Stop()
+	start := cfg.Clock.Now()
+	numbers := Numbers{Plain: cfg.PlainNumbers}
+	drawn := 0
+	draw := func(line string, end string) {
+		pad := ""
+		if len(line) < drawn {
+			pad = strings.Repeat(" ", drawn-len(line))
+		}
+		fmt.Fprintf(stderr, "\r%s%s%s", line, pad, end)
+		drawn = len(line)
+	}
+	for {
+		select {
+		case <-stop:
+			draw(progressDone(numbers, metrics, cfg.Clock.Now().Sub(start)), "\n")
+			return
+		case <-ticker.C():
+			draw(progressLine(numbers, metrics, total, cfg.Clock.Now().Sub(start)), "")
+		}
+	}
+}
+
+// progressLine describes a search elapsed into. Percent complete and the
+// ETA go by bytes, which track the time a search takes better than files,
+// or by files when the files to search are all empty. While the search runs
+// neither claims it is finished: an estimate can fall short, and files can
+// be read only in part.
+func progressLine(numbers Numbers, metrics *search.Metrics, total *search.WorkTotal, elapsed time.Duration) string {
+	files, bytes := metrics.FilesScanned.Load(), metrics.BytesRead.Load()
+	rate := numbers.Rate(bytes, elapsed)
+	if total == nil {
+		return fmt.Sprintf("progress: %s files, %s, %s", numbers.Count(files), numbers.Size(bytes), rate)
+	}
+	approx := ""
+	if total.Approximate {
+		approx = "~"
+	}
+	done, all := bytes, total.Bytes
+	if all == 0 {
+		done, all = files, total.Files
+	}
+	percent := 0
+	eta := "--:--"
+	if all > 0 {
+		percent = min(int(done*100/all), 99)
+	}
+	if done > 0 && elapsed > 0 {
+		remaining := time.Duration(float64(elapsed) * float64(max(all-done, 0)) / float64(done))
+		eta = formatETA(remaining)
+	}
+	return fmt.Sprintf("progress: %s/%s%s files, %s/%s%s (%s%d%%), %s, ETA %s%s",
+		numbers.Count(files), approx, numbers.Count(total.Files),
+		numbers.Size(bytes), approx, numbers.Size(total.Bytes),
+		approx, percent, rate, approx, eta)
+}
+
+// progressDone is the last progress line.
+func progressDone(numbers Numbers, metrics *search.Metrics, elapsed time.Duration) string {
+	files, bytes := metrics.FilesScanned.Load(), metrics.BytesRead.Load()
+	return fmt.Sprintf("progress: done, %s files, %s in %s, %s",
+		numbers.Count(files), numbers.Size(bytes), elapsed.Round(time.Millisecond), numbers.Rate(bytes, elapsed))
+}
+
+// formatETA formats d as minutes and seconds, or hours, minutes, and
+// seconds once it reaches an hour.
+func formatETA(d time.Duration) string {
+	seconds := int64(d.Round(time.Second) / time.Second)
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
@@ -0,0 +1,59 @@
+package output
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vennictus/gosearch/internal/search"
+)
+
+// redactKeep is how many characters -redact leaves visible at each end of a
+// match. Matches too short to keep both ends are masked entirely.
+const redactKeep = 2
+
+const redactMask = "…"
+
+// redactRanges masks each matched range of line and returns the masked line,
+// the ranges remapped onto it, and each match's unredacted length in
+// characters. Ranges must be sorted and non-overlapping, as strategies
+// produce them.
+func redactRanges(line string, ranges []search.MatchRange) (string, []search.MatchRange, []int) {
+	if len(ranges) == 0 {
+		return line, ranges, nil
+	}
+
+	var builder strings.Builder
+	remapped := make([]search.MatchRange, 0, len(ranges))
+	lengths := make([]int, 0, len(ranges))
+	last := 0
+	for _, match := range ranges {
+		if match.Start < last || match.Start > len(line) || match.End > len(line) {
+			continue
+		}
+		builder.WriteString(line[last:match.Start])
+		start := builder.Len()
+		builder.WriteString(maskMatch(line[match.Start:match.End]))
+		remapped = append(remapped, search.MatchRange{Start: start, End: builder.Len()})
+		lengths = append(lengths, utf8.RuneCountInString(line[match.Start:match.End]))
+		last = match.End
+	}
+	builder.WriteString(line[last:])
+	return builder.String(), remapped, lengths
+}
+
+func maskMatch(matched string) string {
+	runes := []rune(matched)
+	if len(runes) <= 2*redactKeep {
+		return redactMask
+	}
+	return string(runes[:redactKeep]) + redactMask + string(runes[len(runes)-redactKeep:])
+}
+
+func formatRedactedSuffix(lengths []int) string {
+	parts := make([]string, len(lengths))
+	for i, length := range lengths {
+		parts[i] = fmt.Sprint(length)
+	}
+	return " [redacted=" + strings.Join(parts, ",") + "]"
+}
@@ -0,0 +1,168 @@
+package output
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/vennictus/gosearch/internal/search"
+)
+
+// replacement is a parsed -replace text. With -regex it may refer to the
+// groups of each match in the syntax of regexp.Expand: $1 or ${1} for a
+// group by number, $0 for the whole match, $name or ${name} for a named
+// group, and $$ for a dollar sign. A name is as long as possible, so $1x
+// means ${1x}; a $ that starts no reference is kept.
+type replacement []replacementPart
+
+type replacementPart struct {
+	literal string
+	// ref is a reference as written, e.g. "$1" or "${name}", or "" for a
+	// literal part. number is the group it refers to, or -1 when it refers
+	// to one by name.
+	ref    string
+	number int
+	name   string
+}
+
+// parseReplacement parses text, which is all literal without regex.
+func parseReplacement(text string, regex bool) replacement {
+	if !regex {
+		return replacement{{literal: text}}
+	}
+	var parts replacement
+	var literal strings.Builder
+	for len(text) > 0 {
+		dollar := strings.IndexByte(text, '$')
+		if dollar < 0 {
+			literal.WriteString(text)
+			break
+		}
+		literal.WriteString(text[:dollar])
+		text = text[dollar:]
+		if strings.HasPrefix(text, "$$") {
+			literal.WriteByte('$')
+			text = text[2:]
+			continue
+		}
+		part, rest, ok := parseReference(text)
+		if !ok {
+			literal.WriteByte('$')
+			text = text[1:]
+			continue
+		}
+		if literal.Len() > 0 {
+			parts = append(parts, replacementPart{literal: literal.String()})
+			literal.Reset()
+		}
+		parts = append(parts, part)
+		text = rest
+	}
+	if literal.Len() > 0 {
+		parts = append(parts, replacementPart{literal: literal.String()})
+	}
+	return parts
+}
+
+// parseReference parses the reference text starts with, as regexp.Expand
+// does.
+func parseReference(text string) (replacementPart, string, bool) {
+	name := text[1:]
+	brace := strings.HasPrefix(name, "{")
+	if brace {
+		name = name[1:]
+	}
+	end := 0
+	for end < len(name) {
+		r, size := utf8.DecodeRuneInString(name[end:])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			break
+		}
+		end += size
+	}
+	if end == 0 || (brace && (end == len(name) || name[end] != '}')) {
+		return replacementPart{}, "", false
+	}
+	rest := name[end:]
+	if brace {
+		rest = rest[1:]
+	}
+	name = name[:end]
+	part := replacementPart{ref: text[:len(text)-len(rest)], number: -1, name: name}
+	// As with regexp.Expand, $01 names a group "01" and numbers stop
+	// below 1e8.
+	if number, err := strconv.Atoi(name); err == nil && (name == "0" || name[0] != '0') && number < 1e8 {
+		part.number, part.name = number, ""
+	}
+	return part, rest, true
+}
+
+// CheckReplacement reports the first reference in a -regex -replace text
+// to a group pattern does not have; names are its groups' names by number
+// from group 1, "" for a group without one.
+func CheckReplacement(text string, pattern string, names []string) error {
+	for _, part := range parseReplacement(text, true) {
+		if part.ref == "" || part.number == 0 || (part.number > 0 && part.number <= len(names)) {
+			continue
+		}
+		if part.number < 0 && slices.Contains(names, part.name) {
+			continue
+		}
+		return fmt.Errorf("replace: %s refers to no group of %q", part.ref, pattern)
+	}
+	return nil
+}
+
+// expand writes what part stands for in a match of line.
+func (part replacementPart) expand(builder *strings.Builder, line string, match search.MatchRange) {
+	if part.ref == "" {
+		builder.WriteString(part.literal)
+		return
+	}
+	if part.number == 0 {
+		builder.WriteString(line[match.Start:match.End])
+		return
+	}
+	if match.Captures == nil {
+		return
+	}
+	for i, capture := range *match.Captures {
+		if (part.number > 0 && i+1 == part.number) || (part.number < 0 && capture.Name == part.name) {
+			if capture.Start >= 0 {
+				builder.WriteString(line[capture.Start:capture.End])
+			}
+			return
+		}
+	}
+}
+
+// replaceRanges substitutes replacement for each matched range of line and
+// returns the new line and the ranges of the inserted replacements, so they
+// can be highlighted. Ranges must be sorted and non-overlapping, as
+// strategies produce them.
+func replaceRanges(line string, ranges []search.MatchRange, replacement replacement) (string, []search.MatchRange) {
+	if len(ranges) == 0 {
+		return line, ranges
+	}
+
+	var builder strings.Builder
+	remapped := make([]search.MatchRange, 0, len(ranges))
+	last := 0
+	for _, match := range ranges {
+		if match.Start < last || match.Start > len(line) || match.End > len(line) {
+			continue
+		}
+		builder.WriteString(line[last:match.Start])
+		start := builder.Len()
+		for _, part := range replacement {
+			part.expand(&builder, line, match)
+		}
+		remapped = append(remapped, search.MatchRange{Start: start, End: builder.Len()})
+		last = match.End
+	}
+	builder.WriteString(line[last:])
+	return builder.String(), remapped
+}
@@ -0,0 +1,185 @@
+package output
+
+import (
+	"encoding/json"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vennictus/gosearch/internal/search"
+)
+
+// sarifRuleID identifies the single rule of a -format sarif run: the pattern.
+const sarifRuleID = "gosearch/pattern"
+
+// sarifRootBase is the uriBaseId every result location is relative to.
+const sarifRootBase = "SRCROOT"
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool               sarifTool                   `json:"tool"`
+	OriginalURIBaseIDs map[string]sarifArtifactLoc `json:"originalUriBaseIds"`
+	ColumnKind         string                      `json:"columnKind"`
+	Results            []sarifResult               `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	Name             string       `json:"name"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID        string          `json:"ruleId"`
+	RuleIndex     int             `json:"ruleIndex"`
+	Level         string          `json:"level"`
+	Message       sarifMessage    `json:"message"`
+	Locations     []sarifLocation `json:"locations"`
+	BaselineState string          `json:"baselineState,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLoc `json:"artifactLocation"`
+	Region           sarifRegion      `json:"region"`
+	ContextRegion    *sarifRegion     `json:"contextRegion,omitempty"`
+}
+
+type sarifArtifactLoc struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine   int           `json:"startLine"`
+	EndLine     int           `json:"endLine,omitempty"`
+	StartColumn int           `json:"startColumn,omitempty"`
+	EndColumn   int           `json:"endColumn,omitempty"`
+	Snippet     *sarifMessage `json:"snippet,omitempty"`
+}
+
+// addSarif buffers a match for the document written by writeSarif. message
+// is the line as printed, which differs from result.Text under -redact; the
+// columns always refer to the file's own text.
+func (state *printState) addSarif(result search.Result, message string, baselineTag string) {
+	region := sarifRegion{StartLine: result.Line}
+	if len(result.Ranges) > 0 {
+		first := result.Ranges[0]
+		region.StartColumn = utf8.RuneCountInString(result.Text[:first.Start]) + 1
+		region.EndColumn = utf8.RuneCountInString(result.Text[:first.End]) + 1
+	}
+	location := sarifPhysicalLocation{
+		ArtifactLocation: sarifArtifactLoc{URI: sarifURI(state.cfg.RootPath, result.Path), URIBaseID: sarifRootBase},
+		Region:           region,
+	}
+	if len(result.Before) > 0 || len(result.After) > 0 {
+		context := sarifRegion{StartLine: result.Line, EndLine: result.Line}
+		var lines []string
+		for _, line := range result.Before {
+			lines = append(lines, line.Text)
+		}
+		lines = append(lines, message)
+		for _, line := range result.After {
+			lines = append(lines, line.Text)
+		}
+		if len(result.Before) > 0 {
+			context.StartLine = result.Before[0].Line
+		}
+		if len(result.After) > 0 {
+			context.EndLine = result.After[len(result.After)-1].Line
+		}
+		context.Snippet = &sarifMessage{Text: strings.Join(lines, "\n")}
+		location.ContextRegion = &context
+	}
+	state.sarifResults = append(state.sarifResults, sarifResult{
+		RuleID:        sarifRuleID,
+		Level:         "warning",
+		Message:       sarifMessage{Text: message},
+		Locations:     []sarifLocation{{PhysicalLocation: location}},
+		BaselineState: baselineTag,
+	})
+}
+
+// writeSarif prints the buffered matches as one SARIF 2.1.0 document.
+func (state *printState) writeSarif() {
+	root, err := filepath.Abs(state.cfg.RootPath)
+	if err != nil {
+		root = state.cfg.RootPath
+	}
+	rootURI := url.URL{Scheme: "file", Path: filepath.ToSlash(root)}
+	if !strings.HasPrefix(rootURI.Path, "/") {
+		rootURI.Path = "/" + rootURI.Path
+	}
+	joiner := " or "
+	if state.cfg.MatchAll {
+		joiner = " and "
+	}
+	if !strings.HasSuffix(rootURI.Path, "/") {
+		rootURI.Path += "/"
+	}
+	results := state.sarifResults
+	if results == nil {
+		results = []sarifResult{}
+	}
+	document := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "gosearch",
+				Version:        state.cfg.VersionLabel,
+				InformationURI: "https://github.com/vennictus/gosearch",
+				Rules: []sarifRule{{
+					ID:               sarifRuleID,
+					Name:             "PatternMatch",
+					ShortDescription: sarifMessage{Text: "Line matches " + strings.ReplaceAll(state.cfg.Pattern, "\n", joiner)},
+				}},
+			}},
+			OriginalURIBaseIDs: map[string]sarifArtifactLoc{sarifRootBase: {URI: rootURI.String()}},
+			ColumnKind:         "unicodeCodePoints",
+			Results:            results,
+		}},
+	}
+	encoder := json.NewEncoder(state.stdout)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(document)
+}
+
+// sarifURI returns path relative to root as a URI reference with forward
+// slashes, escaped where the file name needs it.
+func sarifURI(root string, path string) string {
+	relative, err := filepath.Rel(root, path)
+	if err != nil {
+		relative = path
+	}
+	relative = filepath.ToSlash(relative)
+	// A colon in the first segment would read as a URI scheme.
+	if first, _, _ := strings.Cut(relative, "/"); strings.Contains(first, ":") {
+		relative = "./" + relative
+	}
+	return (&url.URL{Path: relative}).EscapedPath()
+}
@@ -0,0 +1,140 @@
+package output
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// JSONSchemaVersion is written as "schema" on every -format json record. It
+// is bumped whenever a field is renamed, removed, or changes type; adding an
+// optional field is not a breaking change.
+const JSONSchemaVersion = 2
+
+// jsonResultV1 and jsonCountSummaryV1 are the original records, still emitted
+// by -format json-v1.
+type jsonResultV1 struct {
+	Path string `json:"path"`
+	Line *int   `json:"line,omitempty"`
+	Text string `json:"text"`
+}
+
+type jsonCountSummaryV1 struct {
+	Count int `json:"count"`
+}
+
+// schemaRecord describes one kind of JSON record and how to recognise it.
+type schemaRecord struct {
+	Name     string        `json:"name"`
+	Identify string        `json:"identify"`
+	Fields   []schemaField `json:"fields"`
+}
+
+type schemaField struct {
+	Name     string        `json:"name"`
+	Type     string        `json:"type"`
+	Presence string        `json:"presence"`
+	Items    string        `json:"items,omitempty"`
+	Fields   []schemaField `json:"fields,omitempty"`
+	// Values describes the values of objects keyed by name, such as each
+	// match's captures.
+	Values []schemaField `json:"values,omitempty"`
+}
+
+type schemaDocument struct {
+	Schema  int            `json:"schema"`
+	Records []schemaRecord `json:"records"`
+}
+
+// JSONSchema returns the machine-readable description of -format json
+// records printed by -json-schema. It is derived from the record types
+// themselves, so a renamed field changes the schema.
+func JSONSchema() ([]byte, error) {
+	records := []struct {
+		name     string
+		identify string
+		record   any
+	}{
+		{"match", `no "kind" or "type" field`, jsonResult{}},
+		{"filename", `"kind":"filename" (-also-filenames)`, jsonResult{}},
+		{"without_match", `"kind":"without_match" (-L)`, jsonResult{}},
+		{"byte_match", `"kind":"byte_match" (-hex-pattern), text is the matched bytes in hex`, jsonResult{}},
+		{"count", `"count" field (-count)`, jsonCountSummary{}},
+		{"dir_capped", `"type":"dir_capped" (-max-per-dir)`, jsonDirSummary{}},
+		{"baseline_resolved", `"type":"baseline_resolved" (-baseline)`, jsonBaselineResolved{}},
+		{"duplicate", `"type":"duplicate" (-show-duplicates)`, jsonDuplicateGroup{}},
+		{"file_start", `"type":"file_start" (-file-events)`, jsonFileEvent{}},
+		{"file_end", `"type":"file_end" (-file-events)`, jsonFileEvent{}},
+		{"file_stats", `"type":"file_stats" (-file-stats)`, jsonFileStats{}},
+		{"summary", `"type":"summary", the last element of -format json-array`, jsonSummary{}},
+		{"error", `"type":"error", a path that could not be read or was searched with a warning`, jsonFileError{}},
+		{"begin", `"type":"begin", before the first match of a file (-format json-events)`, jsonBeginEvent{}},
+		{"match_event", `"type":"match" (-format json-events), ranges are byte ranges within text`, jsonMatchEvent{}},
+		{"end", `"type":"end", after the last match of a file (-format json-events)`, jsonEndEvent{}},
+		{"events_summary", `"type":"summary", the last record of -format json-events`, jsonSummaryEvent{}},
+		{"split", `"type":"split", one per pattern in place of its matches (-split-output)`, jsonSplitSummary{}},
+	}
+
+	document := schemaDocument{Schema: JSONSchemaVersion}
+	for _, record := range records {
+		document.Records = append(document.Records, schemaRecord{
+			Name:     record.name,
+			Identify: record.identify,
+			Fields:   schemaFields(reflect.TypeOf(record.record)),
+		})
+	}
+	return json.MarshalIndent(document, "", "  ")
+}
+
+func schemaFields(structType reflect.Type) []schemaField {
+	fields := make([]schemaField, 0, structType.NumField())
+	for i := 0; i < structType.NumField(); i++ {
+		tag := structType.Field(i).Tag.Get("json")
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		field := schemaField{Name: name, Presence: "always"}
+		if options == "omitempty" {
+			field.Presence = "optional"
+		}
+
+		fieldType := structType.Field(i).Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		field.Type = schemaType(fieldType)
+		switch fieldType.Kind() {
+		case reflect.Slice:
+			field.Items = schemaType(fieldType.Elem())
+			switch elem := fieldType.Elem(); {
+			case elem.Kind() == reflect.Struct:
+				field.Fields = schemaFields(elem)
+			case elem.Kind() == reflect.Map && elem.Elem().Kind() == reflect.Struct:
+				field.Values = schemaFields(elem.Elem())
+			}
+		case reflect.Struct:
+			field.Fields = schemaFields(fieldType)
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func schemaType(valueType reflect.Type) string {
+	switch valueType.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int64:
+		return "integer"
+	case reflect.Float64:
+		return "number"
+	case reflect.Slice:
+		return "array"
+	case reflect.Struct, reflect.Map:
+		return "object"
+	}
+	return valueType.Kind().String()
+}
@@ -0,0 +1,74 @@
+package output
+
+import (
+	"cmp"
+	"strings"
+	"time"
+
+	"github.com/vennictus/gosearch/internal/config"
+	"github.com/vennictus/gosearch/internal/search"
+)
+
+// holdSorted keeps a result for -sort. Past -sort-spill held results the
+// sorter writes them to a temporary file as a sorted run, so memory holds
+// one run at a time; flushSorted merges the runs.
+func (state *printState) holdSorted(result search.Result) {
+	if state.sorted == nil {
+		order := state.cfg.Sort
+		state.sorted = NewSpillSorter(state.cfg.SortSpill, func(a, b search.Result) int {
+			return compareSorted(order, a, b)
+		}, state.stderr)
+	}
+	state.sorted.Add(result)
+}
+
+// flushSorted prints the results held for -sort in the requested order and
+// removes any runs spilled to disk.
+func (state *printState) flushSorted() {
+	if state.sorted == nil {
+		return
+	}
+	state.sorted.Drain(state.print)
+	state.sorted = nil
+}
+
+// compareSorted orders results for -sort. Ties, and every file's own
+// results, fall back to path, line, and offset, so two runs over the same
+// tree print the same output.
+func compareSorted(order string, a, b search.Result) int {
+	var c int
+	switch order {
+	case config.SortPathDesc:
+		c = strings.Compare(b.Path, a.Path)
+	case config.SortMtime:
+		c = metaTime(a).Compare(metaTime(b))
+	case config.SortSize:
+		c = cmp.Compare(metaSize(a), metaSize(b))
+	}
+	if c != 0 {
+		return c
+	}
+	if c = strings.Compare(a.Path, b.Path); c != 0 {
+		return c
+	}
+	if c = cmp.Compare(a.Line, b.Line); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Offset, b.Offset)
+}
+
+// metaTime and metaSize read the file metadata a result carries for -sort;
+// a file that could not be stat'ed sorts first.
+func metaTime(result search.Result) time.Time {
+	if result.Meta == nil {
+		return time.Time{}
+	}
+	return result.Meta.ModTime
+}
+
+func metaSize(result search.Result) int64 {
+	if result.Meta == nil {
+		return 0
+	}
+	return result.Meta.Size
+}
@@ -0,0 +1,42 @@
+package output
+
+// jsonSourceCount is one -files-from label's match count in a summary.
+type jsonSourceCount struct {
+	Source string `json:"source"`
+	Count  int    `json:"count"`
+}
+
+// countSource adds n matches to every label their file is attributed to.
+func (state *printState) countSource(path string, n int) {
+	if state.cfg.FilesFrom == nil {
+		return
+	}
+	if state.sourceCounts == nil {
+		state.sourceCounts = make(map[string]int)
+	}
+	for _, label := range state.cfg.FilesFrom.Labels[path] {
+		state.sourceCounts[label] += n
+	}
+}
+
+// sourceSummary lists the match count of every -files-from label, in the
+// order the lists were given, or nil without -files-from.
+func (state *printState) sourceSummary() []jsonSourceCount {
+	if state.cfg.FilesFrom == nil {
+		return nil
+	}
+	summary := make([]jsonSourceCount, 0, len(state.cfg.FilesFrom.Order))
+	for _, label := range state.cfg.FilesFrom.Order {
+		summary = append(summary, jsonSourceCount{Source: label, Count: state.sourceCounts[label]})
+	}
+	return summary
+}
+
+// sourcePrefix returns the -files-from-prefix tag of a match line, e.g.
+// "[git] ", or "".
+func (state *printState) sourcePrefix(path string) string {
+	if !state.cfg.FilesFromPrefix {
+		return ""
+	}
+	return "[" + state.cfg.FilesFrom.Label(path) + "] "
+}
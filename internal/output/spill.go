@@ -0,0 +1,74 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// spillWriter sits between the printer and a terminal for -auto-spill. It
+// keeps a copy of what the terminal was shown so that, once the limit is
+// passed, the temporary file can start with it and hold the full results.
+type spillWriter struct {
+	terminal io.Writer
+	shown    bytes.Buffer
+	file     *os.File
+}
+
+func (writer *spillWriter) Write(p []byte) (int, error) {
+	if writer.file != nil {
+		return writer.file.Write(p)
+	}
+	writer.shown.Write(p)
+	return writer.terminal.Write(p)
+}
+
+// start creates the temporary file and sends every later write to it.
+func (writer *spillWriter) start() error {
+	file, err := os.CreateTemp("", "gosearch-*.txt")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(writer.shown.Bytes()); err != nil {
+		_ = file.Close()
+		return err
+	}
+	writer.shown = bytes.Buffer{}
+	writer.file = file
+	return nil
+}
+
+// countPrinted counts a result about to be printed and, on the one past the
+// -auto-spill limit, moves the output to a temporary file. A json-array
+// left open on the terminal is closed there; the file carries on with it.
+func (state *printState) countPrinted() {
+	if state.spill == nil {
+		return
+	}
+	state.printed++
+	if state.printed != state.cfg.AutoSpill+1 {
+		return
+	}
+	state.flush()
+	if err := state.spill.start(); err != nil {
+		fmt.Fprintf(state.stderr, "auto-spill: %v; output continues on the terminal\n", err)
+		state.spill = nil
+		return
+	}
+	if state.jsonArray != nil && state.jsonArray.started {
+		_, _ = io.WriteString(state.spill.terminal, "\n]\n")
+	}
+}
+
+// finishSpill closes the temporary file and says where the results went.
+// The file is left for the user to remove.
+func (state *printState) finishSpill() {
+	if state.spill == nil || state.spill.file == nil {
+		return
+	}
+	if err := state.spill.file.Close(); err != nil && state.out.err == nil {
+		state.out.err = err
+	}
+	fmt.Fprintf(state.stderr, "output truncated at %d results; full results written to %s (%s total)\n", state.cfg.AutoSpill, state.spill.file.Name(), Numbers{Plain: state.cfg.PlainNumbers}.Count(int64(state.printed)))
+}
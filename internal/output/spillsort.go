@@ -0,0 +1,202 @@
+package output
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/vennictus/gosearch/internal/search"
+)
+
+// SpillSorter puts results in order without holding them all in memory, for
+// output modes that must see every result before printing the first. Once
+// threshold results are held they are sorted and written to a temporary
+// file in $TMPDIR as one run, and Drain merges the runs with the results
+// still held: a classic external sort.
+type SpillSorter struct {
+	compare   func(a, b search.Result) int
+	threshold int
+	stderr    io.Writer
+	held      []search.Result
+	runs      []*os.File
+	// failed is set once writing a run failed; later results stay in memory.
+	failed bool
+}
+
+// NewSpillSorter returns a sorter that orders results by compare and holds
+// at most threshold of them in memory; 0 holds them all. Runs that cannot be
+// written or read back are reported on stderr.
+func NewSpillSorter(threshold int, compare func(a, b search.Result) int, stderr io.Writer) *SpillSorter {
+	return &SpillSorter{compare: compare, threshold: threshold, stderr: stderr}
+}
+
+// Add holds a result, spilling the held results to a run once there are
+// threshold of them. If a run cannot be written, results stay in memory.
+func (sorter *SpillSorter) Add(result search.Result) {
+	sorter.held = append(sorter.held, result)
+	if sorter.threshold == 0 || len(sorter.held) < sorter.threshold || sorter.failed {
+		return
+	}
+	if err := sorter.spill(); err != nil {
+		fmt.Fprintf(sorter.stderr, "sort-spill: %v; results stay in memory\n", err)
+		sorter.failed = true
+	}
+}
+
+// Runs returns how many runs have been written to disk.
+func (sorter *SpillSorter) Runs() int {
+	return len(sorter.runs)
+}
+
+// Drain passes every result to emit in order, merging the runs on disk
+// with the results still held, and then removes the runs. Equal results
+// keep the order they were added in.
+func (sorter *SpillSorter) Drain(emit func(search.Result)) {
+	defer sorter.Close()
+	sorter.sortHeld()
+	if len(sorter.runs) == 0 {
+		for _, result := range sorter.held {
+			emit(result)
+		}
+		sorter.held = nil
+		return
+	}
+
+	merge := &runMerge{compare: sorter.compare}
+	for _, file := range sorter.runs {
+		merge.push(&sortRun{decoder: gob.NewDecoder(bufio.NewReader(file)), name: file.Name()}, sorter.stderr)
+	}
+	merge.push(&sortRun{memory: sorter.held}, sorter.stderr)
+	for merge.Len() > 0 {
+		run := merge.runs[0]
+		emit(run.head)
+		if run.next(sorter.stderr) {
+			heap.Fix(merge, 0)
+		} else {
+			heap.Pop(merge)
+		}
+	}
+	sorter.held = nil
+}
+
+// Close removes the runs' files without draining them. Callers reach it on
+// every path out, interrupted searches included, so no run outlives the
+// search.
+func (sorter *SpillSorter) Close() {
+	for _, file := range sorter.runs {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}
+	sorter.runs = nil
+}
+
+func (sorter *SpillSorter) sortHeld() {
+	slices.SortStableFunc(sorter.held, sorter.compare)
+}
+
+// spill writes the held results, sorted, to a new temporary file. On
+// failure the file is removed and the results stay held.
+func (sorter *SpillSorter) spill() error {
+	sorter.sortHeld()
+	file, err := os.CreateTemp("", "gosearch-sort-*")
+	if err != nil {
+		return err
+	}
+	if err := writeSortRun(file, sorter.held); err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return err
+	}
+	sorter.runs = append(sorter.runs, file)
+	clear(sorter.held)
+	sorter.held = sorter.held[:0]
+	return nil
+}
+
+func writeSortRun(file *os.File, results []search.Result) error {
+	buffered := bufio.NewWriter(file)
+	encoder := gob.NewEncoder(buffered)
+	for _, result := range results {
+		if err := encoder.Encode(result); err != nil {
+			return err
+		}
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	_, err := file.Seek(0, io.SeekStart)
+	return err
+}
+
+// sortRun is one sorted run being merged: a spilled file read back one
+// result at a time, or the results still in memory.
+type sortRun struct {
+	decoder *gob.Decoder
+	name    string
+	memory  []search.Result
+	head    search.Result
+	// index orders runs in the order they were written, so equal results
+	// keep the order they arrived in, as the in-memory sort does.
+	index int
+}
+
+// next loads the run's following result into head, reporting false once
+// the run is exhausted. A run that cannot be read is reported and ends.
+func (run *sortRun) next(stderr io.Writer) bool {
+	if run.decoder == nil {
+		if len(run.memory) == 0 {
+			return false
+		}
+		run.head, run.memory = run.memory[0], run.memory[1:]
+		return true
+	}
+	var result search.Result
+	if err := run.decoder.Decode(&result); err != nil {
+		if !errors.Is(err, io.EOF) {
+			fmt.Fprintf(stderr, "sort-spill: %s: %v\n", run.name, err)
+		}
+		return false
+	}
+	run.head = result
+	return true
+}
+
+// runMerge is a heap of runs ordered by their head results.
+type runMerge struct {
+	compare func(a, b search.Result) int
+	runs    []*sortRun
+	added   int
+}
+
+// push adds a run to the merge once it has a first result.
+func (merge *runMerge) push(run *sortRun, stderr io.Writer) {
+	run.index = merge.added
+	merge.added++
+	if run.next(stderr) {
+		heap.Push(merge, run)
+	}
+}
+
+func (merge *runMerge) Len() int { return len(merge.runs) }
+
+func (merge *runMerge) Less(i, j int) bool {
+	if c := merge.compare(merge.runs[i].head, merge.runs[j].head); c != 0 {
+		return c < 0
+	}
+	return merge.runs[i].index < merge.runs[j].index
+}
+
+func (merge *runMerge) Swap(i, j int) { merge.runs[i], merge.runs[j] = merge.runs[j], merge.runs[i] }
+
+func (merge *runMerge) Push(x any) { merge.runs = append(merge.runs, x.(*sortRun)) }
+
+func (merge *runMerge) Pop() any {
+	last := merge.runs[len(merge.runs)-1]
+	merge.runs = merge.runs[:len(merge.runs)-1]
+	return last
+}
@@ -0,0 +1,162 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/vennictus/gosearch/internal/config"
+	"github.com/vennictus/gosearch/internal/search"
+)
+
+// SplitOutput is the -split-output destination: a directory holding one file
+// per pattern, each written like -output and replaced only once the search
+// ends. The printer writes every match to the files of the patterns that
+// matched it, with only those patterns' ranges.
+type SplitOutput struct {
+	files []*splitFile
+}
+
+type splitFile struct {
+	pattern string
+	path    string
+	file    *OutputFile
+	// state formats the file's matches as the printer formats stdout's,
+	// without color or hyperlinks, and buffers them as it does.
+	state   *printState
+	matches int
+	paths   map[string]struct{}
+}
+
+type jsonSplitSummary struct {
+	Schema  int    `json:"schema"`
+	Type    string `json:"type"`
+	Pattern string `json:"pattern"`
+	Path    string `json:"path"`
+	Matches int    `json:"matches"`
+	Files   int    `json:"files"`
+}
+
+// CreateSplitOutput creates the -split-output directory if needed and starts
+// a file in it for each pattern: .jsonl with -format json, .txt otherwise.
+func CreateSplitOutput(cfg config.Config, stderr io.Writer) (*SplitOutput, error) {
+	if err := os.MkdirAll(cfg.SplitOutput, 0o755); err != nil {
+		return nil, fmt.Errorf("split-output %s: %w", cfg.SplitOutput, err)
+	}
+	extension := ".txt"
+	if cfg.OutputFormat == "json" {
+		extension = ".jsonl"
+	}
+	fileCfg := cfg
+	fileCfg.Color, fileCfg.Hyperlink, fileCfg.AutoSpill = false, false, 0
+
+	split := &SplitOutput{}
+	for index, name := range splitFileNames(cfg.Patterns) {
+		path := filepath.Join(cfg.SplitOutput, name+extension)
+		file, err := CreateOutputFile(path)
+		if err != nil {
+			split.Discard()
+			return nil, err
+		}
+		split.files = append(split.files, &splitFile{
+			pattern: cfg.Patterns[index],
+			path:    path,
+			file:    file,
+			state:   newPrintState(fileCfg, file, stderr),
+			paths:   make(map[string]struct{}),
+		})
+	}
+	return split, nil
+}
+
+// splitFileNames derives a file name from each pattern. Anything but ASCII
+// letters, digits, '-', '_', and inner dots becomes '_', so a pattern can
+// neither leave the directory nor name a hidden file, and names that would
+// collide, ignoring case, are numbered.
+func splitFileNames(patterns []string) []string {
+	const maxName = 64
+	seen := make(map[string]bool)
+	names := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		name := []byte(pattern)
+		for i, c := range name {
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+			case c == '.' && i > 0:
+			default:
+				name[i] = '_'
+			}
+		}
+		if len(name) > maxName {
+			name = name[:maxName]
+		}
+		base := string(name)
+		unique := base
+		for n := 2; seen[strings.ToLower(unique)]; n++ {
+			unique = base + "-" + strconv.Itoa(n)
+		}
+		seen[strings.ToLower(unique)] = true
+		names = append(names, unique)
+	}
+	return names
+}
+
+// print writes result to the file of every pattern with a range in it.
+func (split *SplitOutput) print(result search.Result, baselineTag string) {
+	for index, file := range split.files {
+		var ranges []search.MatchRange
+		for _, match := range result.Ranges {
+			if match.Pattern == index {
+				ranges = append(ranges, match)
+			}
+		}
+		if ranges == nil {
+			continue
+		}
+		own := result
+		own.Ranges = ranges
+		file.state.printMatch(own, baselineTag)
+		file.matches++
+		file.paths[result.Path] = struct{}{}
+	}
+}
+
+// printSplitSummary prints where each pattern's matches went.
+func (state *printState) printSplitSummary() {
+	for _, file := range state.split.files {
+		if state.cfg.OutputFormat == "json" {
+			_ = state.jsonEncoder.Encode(jsonSplitSummary{Schema: JSONSchemaVersion, Type: "split", Pattern: file.pattern, Path: file.path, Matches: file.matches, Files: len(file.paths)})
+			continue
+		}
+		state.printRecord("%s: %d matches in %d files (%s)", file.path, file.matches, len(file.paths), file.pattern)
+	}
+}
+
+// Commit flushes every file and replaces its path with it. It tries them
+// all and returns the first error.
+func (split *SplitOutput) Commit() error {
+	var first error
+	for _, file := range split.files {
+		if err := file.state.stdout.Flush(); err != nil {
+			file.file.Discard()
+			if first == nil {
+				first = outputError(file.path, err)
+			}
+			continue
+		}
+		if err := file.file.Commit(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Discard drops every file, leaving the directory as it was.
+func (split *SplitOutput) Discard() {
+	for _, file := range split.files {
+		file.file.Discard()
+	}
+}
@@ -0,0 +1,58 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/vennictus/gosearch/internal/search"
+)
+
+// PrintStats writes the -stats summary of a run to stderr. A run that
+// stopped early is labelled with why, so its counts are not mistaken for the
+// whole tree's.
+func PrintStats(stderr io.Writer, numbers Numbers, metrics *search.Metrics, summary PrintSummary, elapsed time.Duration, stopped *search.StopCause) {
+	readErrors := metrics.FileErrors.Count(search.ErrorPermission) +
+		metrics.FileErrors.Count(search.ErrorNotFound) +
+		metrics.FileErrors.Count(search.ErrorIO)
+	reasons := []struct {
+		name  string
+		count int64
+	}{
+		{"binary", metrics.FileErrors.Count(search.ErrorBinary)},
+		{"too large", metrics.FilesSkippedSize.Load()},
+		{"ignored", metrics.FilesSkippedIgnore.Load()},
+		{"extension", metrics.FilesSkippedExtension.Load()},
+		{"generated", metrics.FilesSkippedGenerated.Load()},
+		{"export-ignore", metrics.FilesSkippedExportIgnore.Load()},
+		{"encoding", metrics.FilesSkippedEncoding.Load()},
+	}
+	var skipped int64
+	var breakdown []string
+	for _, reason := range reasons {
+		if reason.count > 0 {
+			skipped += reason.count
+			breakdown = append(breakdown, reason.name+" "+numbers.Count(reason.count))
+		}
+	}
+
+	title := "stats"
+	if stopped != nil {
+		title = "stats (" + stopped.Error() + ")"
+	}
+	fmt.Fprintf(stderr, "%s\n", title)
+	fmt.Fprintf(stderr, "  files searched  %s\n", numbers.Count(metrics.FilesScanned.Load()))
+	fmt.Fprintf(stderr, "  files matched   %s\n", numbers.Count(int64(summary.MatchedFiles)))
+	fmt.Fprintf(stderr, "  files no match  %s\n", numbers.Count(int64(summary.NoMatchFiles)))
+	if len(breakdown) > 0 {
+		fmt.Fprintf(stderr, "  files skipped   %s (%s)\n", numbers.Count(skipped), strings.Join(breakdown, ", "))
+	} else {
+		fmt.Fprintf(stderr, "  files skipped   0\n")
+	}
+	fmt.Fprintf(stderr, "  files errored   %s\n", numbers.Count(readErrors))
+	fmt.Fprintf(stderr, "  lines scanned   %s\n", numbers.Count(metrics.LinesProcessed.Load()))
+	fmt.Fprintf(stderr, "  matches         %s\n", numbers.Count(int64(summary.MatchCount)))
+	fmt.Fprintf(stderr, "  bytes read      %s\n", numbers.Size(metrics.BytesRead.Load()))
+	fmt.Fprintf(stderr, "  elapsed         %s\n", elapsed.Round(time.Microsecond))
+}
@@ -0,0 +1,207 @@
+// Package output provides the CI stats file writer.
+package output
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/vennictus/gosearch/internal/config"
+	"github.com/vennictus/gosearch/internal/search"
+)
+
+type statsRecord struct {
+	Time     string                 `json:"time"`
+	ExitCode int                    `json:"exit_code"`
+	Host     string                 `json:"host"`
+	GOOS     string                 `json:"goos"`
+	GOARCH   string                 `json:"goarch"`
+	Version  string                 `json:"version"`
+	Config   statsConfig            `json:"config"`
+	Timings  statsTimings           `json:"timings"`
+	Memory   statsMemory            `json:"memory"`
+	Metrics  search.MetricsSnapshot `json:"metrics"`
+	// Matches is the run's match count and CompareKey its CompareKey, for
+	// -compare-last, which skips runs with a StoppedReason.
+	Matches       int    `json:"matches"`
+	CompareKey    string `json:"compare_key"`
+	StoppedReason string `json:"stopped_reason,omitempty"`
+}
+
+type statsConfig struct {
+	PatternHMAC    string `json:"pattern_hmac"`
+	RootPath       string `json:"root"`
+	Regex          bool   `json:"regex"`
+	IgnoreCase     bool   `json:"ignore_case"`
+	WholeWord      bool   `json:"whole_word"`
+	OutputFormat   string `json:"format"`
+	Workers        int    `json:"workers"`
+	IOWorkers      int    `json:"io_workers"`
+	CPUWorkers     int    `json:"cpu_workers"`
+	MaxWorkers     int    `json:"max_workers"`
+	Backpressure   int    `json:"backpressure"`
+	DynamicWorkers bool   `json:"dynamic_workers"`
+}
+
+type statsTimings struct {
+	PreCountMs float64 `json:"precount_ms,omitempty"`
+	WalkMs     float64 `json:"walk_ms"`
+	ScanMs     float64 `json:"scan_ms"`
+	PrintMs    float64 `json:"print_ms"`
+	TotalMs    float64 `json:"total_ms"`
+}
+
+// StatsKeyEnv names the environment variable that supplies the key stats
+// records hash patterns with, so that hashes agree across machines.
+const StatsKeyEnv = "GOSEARCH_STATS_KEY"
+
+// StatsKey returns the key the pattern hash and compare key of stats records
+// are computed with: $GOSEARCH_STATS_KEY, or else the key in stats.key in a
+// gosearch directory of the user config directory, created with 32 random
+// bytes on first use. A plain hash of a short pattern could be reversed by
+// trying candidates; without the key it cannot.
+func StatsKey() ([]byte, error) {
+	if key := os.Getenv(StatsKeyEnv); key != "" {
+		return []byte(key), nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, fmt.Errorf("stats-file: %w", err)
+	}
+	path := filepath.Join(dir, "gosearch", "stats.key")
+	key, err := os.ReadFile(path)
+	if err == nil && len(key) > 0 {
+		return key, nil
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("stats-file: %w", err)
+	}
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("stats-file: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("stats-file: %w", err)
+	}
+	// A concurrent first run may have created the key since; keep theirs.
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if errors.Is(err, fs.ErrExist) {
+		return os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("stats-file: %w", err)
+	}
+	if _, err := file.Write(key); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("stats-file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("stats-file: %w", err)
+	}
+	return key, nil
+}
+
+// keyedHash returns the hex HMAC-SHA256 of data under key.
+func keyedHash(key []byte, data []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// AppendStatsRecord appends one JSON line describing the run to path. The
+// pattern is stored only as an HMAC keyed with key; see StatsKey. The record
+// is written with a single append so concurrent runs never interleave
+// partial lines.
+func AppendStatsRecord(path string, key []byte, cfg config.Config, metrics *search.Metrics, timings search.PhaseTimings, memory search.PhaseMemory, exitCode int, matches int, stopped *search.StopCause) error {
+	host, _ := os.Hostname()
+	record := statsRecord{
+		Time:     time.Now().UTC().Format(time.RFC3339),
+		ExitCode: exitCode,
+		Host:     host,
+		GOOS:     runtime.GOOS,
+		GOARCH:   runtime.GOARCH,
+		Version:  cfg.VersionLabel,
+		Config: statsConfig{
+			PatternHMAC:    keyedHash(key, []byte(cfg.Pattern)),
+			RootPath:       cfg.RootPath,
+			Regex:          cfg.Regex,
+			IgnoreCase:     cfg.IgnoreCase,
+			WholeWord:      cfg.WholeWord,
+			OutputFormat:   cfg.OutputFormat,
+			Workers:        cfg.Workers,
+			IOWorkers:      cfg.IOWorkers,
+			CPUWorkers:     cfg.CPUWorkers,
+			MaxWorkers:     cfg.MaxWorkers,
+			Backpressure:   cfg.Backpressure,
+			DynamicWorkers: cfg.DynamicWorkers,
+		},
+		Timings: statsTimings{
+			PreCountMs: durationMs(timings.PreCount),
+			WalkMs:     durationMs(timings.Walk),
+			ScanMs:     durationMs(timings.Scan),
+			PrintMs:    durationMs(timings.Print),
+			TotalMs:    durationMs(timings.Total),
+		},
+		Memory: statsMemory{
+			Walk:  newStatsPeak(memory.Walk),
+			Scan:  newStatsPeak(memory.Scan),
+			Print: newStatsPeak(memory.Print),
+			Total: newStatsPeak(memory.Total),
+		},
+		Metrics:    metrics.Snapshot(),
+		Matches:    matches,
+		CompareKey: CompareKey(cfg, key),
+	}
+	if stopped != nil {
+		record.StoppedReason = stopped.Reason
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("stats-file: %w", err)
+	}
+	line = append(line, '\n')
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("stats-file: %w", err)
+	}
+	if _, err := file.Write(line); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("stats-file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("stats-file: %w", err)
+	}
+	return nil
+}
+
+type statsMemory struct {
+	Walk  statsPeak `json:"walk"`
+	Scan  statsPeak `json:"scan"`
+	Print statsPeak `json:"print"`
+	Total statsPeak `json:"total"`
+}
+
+type statsPeak struct {
+	PeakHeapBytes uint64 `json:"peak_heap_bytes"`
+	PeakSysBytes  uint64 `json:"peak_sys_bytes"`
+	GCCount       uint32 `json:"gc_count"`
+}
+
+func newStatsPeak(peak search.MemoryPeak) statsPeak {
+	return statsPeak{PeakHeapBytes: peak.HeapAlloc, PeakSysBytes: peak.Sys, GCCount: peak.NumGC}
+}
+
+func durationMs(value time.Duration) float64 {
+	return float64(value) / float64(time.Millisecond)
+}
@@ -0,0 +1,58 @@
+package output
+
+import (
+	"bytes"
+	"io"
+	"text/template"
+
+	"github.com/vennictus/gosearch/internal/search"
+)
+
+// templateRecord is the data -template is executed with for each match.
+type templateRecord struct {
+	Path   string
+	Line   int
+	Offset int64
+	Text   string
+	Ranges []search.MatchRange
+	Before []search.ContextLine
+	After  []search.ContextLine
+}
+
+// Matches returns the matched substrings of Text, in order.
+func (record templateRecord) Matches() []string {
+	matches := make([]string, 0, len(record.Ranges))
+	for _, match := range record.Ranges {
+		matches = append(matches, record.Text[match.Start:match.End])
+	}
+	return matches
+}
+
+// CheckTemplate executes tmpl once against a sample match, so that a
+// template referring to a field or method that does not exist is rejected
+// before the search starts rather than on the first match.
+func CheckTemplate(tmpl *template.Template) error {
+	sample := templateRecord{
+		Path:   "sample.txt",
+		Line:   2,
+		Text:   "sample",
+		Ranges: []search.MatchRange{{Start: 0, End: len("sample")}},
+		Before: []search.ContextLine{{Line: 1, Text: "before"}},
+		After:  []search.ContextLine{{Line: 3, Text: "after"}},
+	}
+	return tmpl.Execute(io.Discard, sample)
+}
+
+// printTemplate renders one match with -template. The first execution error
+// is kept for the summary and stops further template output.
+func (state *printState) printTemplate(record templateRecord) {
+	if state.templateErr != nil {
+		return
+	}
+	var rendered bytes.Buffer
+	if err := state.cfg.Template.Execute(&rendered, record); err != nil {
+		state.templateErr = err
+		return
+	}
+	state.writeRecord(rendered.String())
+}
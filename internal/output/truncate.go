@@ -0,0 +1,59 @@
+package output
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/vennictus/gosearch/internal/search"
+)
+
+// truncatedSuffix marks a line cut short by -max-columns.
+const truncatedSuffix = " ... [truncated]"
+
+// truncateLine cuts line to at most maxColumns bytes, backing off to the
+// start of a UTF-8 sequence so no character is split. Ranges are clipped to
+// the kept text and those past it are dropped, so highlighting never opens an
+// escape sequence it cannot close. A maxColumns of 0 keeps every line whole.
+func truncateLine(line string, ranges []search.MatchRange, maxColumns int) (string, []search.MatchRange, bool) {
+	if maxColumns <= 0 || len(line) <= maxColumns {
+		return line, ranges, false
+	}
+	cut := maxColumns
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	var clipped []search.MatchRange
+	for _, match := range ranges {
+		if match.Start >= cut {
+			break
+		}
+		clipped = append(clipped, search.MatchRange{Start: match.Start, End: min(match.End, cut), Captures: match.Captures})
+	}
+	return line[:cut], clipped, true
+}
+
+// omittedLine replaces a line longer than -max-columns with -max-columns-omit;
+// context lines have no matches.
+func omittedLine(matches int) string {
+	switch matches {
+	case 0:
+		return "[omitted long line]"
+	case 1:
+		return "[omitted long line with 1 match]"
+	}
+	return fmt.Sprintf("[omitted long line with %d matches]", matches)
+}
+
+// limitColumns applies -max-columns to a printed line: it is truncated, or
+// with -max-columns-omit replaced by a notice. The returned ranges index into
+// the returned text, which the caller highlights before appending suffix.
+func (state *printState) limitColumns(text string, ranges []search.MatchRange) (string, []search.MatchRange, string) {
+	if state.cfg.MaxColumns <= 0 || len(text) <= state.cfg.MaxColumns {
+		return text, ranges, ""
+	}
+	if state.cfg.MaxColumnsOmit {
+		return omittedLine(len(ranges)), nil, ""
+	}
+	text, ranges, _ = truncateLine(text, ranges, state.cfg.MaxColumns)
+	return text, ranges, truncatedSuffix
+}
@@ -0,0 +1,100 @@
+package output
+
+import (
+	"encoding/base64"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vennictus/gosearch/internal/config"
+	"github.com/vennictus/gosearch/internal/search"
+)
+
+// admitJSONText reports whether a line is printed in a JSON record. Under
+// -json-invalid-utf8 skip, lines that are not valid UTF-8 are left out and
+// counted.
+func (state *printState) admitJSONText(text string) bool {
+	if state.cfg.JSONInvalidUTF8 != config.InvalidUTF8Skip || utf8.ValidString(text) {
+		return true
+	}
+	state.invalidSkipped++
+	return false
+}
+
+// jsonText returns a line as a JSON record prints it, with ranges moved to
+// match, and under -json-invalid-utf8 base64 the raw line when it is not
+// valid UTF-8.
+func (state *printState) jsonText(text string, ranges []search.MatchRange) (string, []search.MatchRange, string) {
+	if utf8.ValidString(text) {
+		return text, ranges, ""
+	}
+	raw := ""
+	if state.cfg.JSONInvalidUTF8 == config.InvalidUTF8Base64 {
+		raw = base64.StdEncoding.EncodeToString([]byte(text))
+	}
+	text, ranges = replaceInvalidUTF8(text, ranges)
+	return text, ranges, raw
+}
+
+// offsetUnits returns a function that converts byte offsets into text to
+// unit, one of the -offset-unit units. The counts are worked out once for
+// the whole line, so converting each range costs a lookup. A byte that is
+// not UTF-8 counts as one unit, as the one U+FFFD it prints as does; bytes,
+// and lines with no multibyte character, keep their offsets.
+func offsetUnits(text string, unit string) func(int) int {
+	if unit == config.OffsetBytes || utf8.RuneCountInString(text) == len(text) {
+		return func(offset int) int { return offset }
+	}
+	units := make([]int, len(text)+1)
+	count := 0
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		for j := 0; j < size; j++ {
+			units[i+j] = count
+		}
+		count++
+		if unit == config.OffsetUTF16 && r > 0xFFFF {
+			count++
+		}
+		i += size
+	}
+	units[len(text)] = count
+	return func(offset int) int { return units[offset] }
+}
+
+// pathBytes returns path in base64 when it is not valid UTF-8, for the
+// path_bytes field of JSON records: encoding/json replaces the invalid bytes
+// in path with U+FFFD, after which it no longer names the file. Other paths
+// give "", leaving the field out.
+func pathBytes(path string) string {
+	if utf8.ValidString(path) {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString([]byte(path))
+}
+
+// replaceInvalidUTF8 replaces each byte of text that is not part of a valid
+// UTF-8 sequence with U+FFFD, as encoding/json would, and moves byte ranges
+// into text to the same characters of the result.
+func replaceInvalidUTF8(text string, ranges []search.MatchRange) (string, []search.MatchRange) {
+	var out strings.Builder
+	moved := make([]int, len(text)+1)
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		for j := 0; j < size; j++ {
+			moved[i+j] = out.Len() + j
+		}
+		if r == utf8.RuneError && size == 1 {
+			out.WriteRune(utf8.RuneError)
+		} else {
+			out.WriteString(text[i : i+size])
+		}
+		i += size
+	}
+	moved[len(text)] = out.Len()
+
+	var movedRanges []search.MatchRange
+	for _, match := range ranges {
+		movedRanges = append(movedRanges, search.MatchRange{Start: moved[match.Start], End: moved[match.End]})
+	}
+	return out.String(), movedRanges
+}
@@ -0,0 +1,319 @@
+// Package repro records the walk decisions of a run into a bundle (-repro)
+// and replays them offline against an in-memory copy of the tree
+// (-repro-replay), so that a report like "file X should have been searched"
+// can be debugged without the reporter's filesystem.
+package repro
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/vennictus/gosearch/internal/config"
+	"github.com/vennictus/gosearch/internal/fsys"
+	"github.com/vennictus/gosearch/internal/ignore"
+	"github.com/vennictus/gosearch/internal/output"
+	"github.com/vennictus/gosearch/internal/search"
+)
+
+// BundleVersion is written as "version" in every bundle and checked on replay.
+const BundleVersion = 1
+
+// -repro-content keeps at most contentFileBytes of each file the walk decided
+// on and stops once contentTotalBytes are held.
+const (
+	contentFileBytes  = 1 << 10
+	contentTotalBytes = 256 << 10
+)
+
+// ignoreFileNames are the files whose contents the walk's decisions depend on.
+var ignoreFileNames = map[string]struct{}{
+	".gitignore":      {},
+	".gosearchignore": {},
+	".gitattributes":  {},
+}
+
+// Bundle is the file written by -repro.
+type Bundle struct {
+	Version         int          `json:"version"`
+	GosearchVersion string       `json:"gosearch_version"`
+	Args            []string     `json:"args"`
+	Config          BundleConfig `json:"config"`
+	// IgnoreFiles holds every ignore file the walk read, by path.
+	IgnoreFiles map[string]string `json:"ignore_files"`
+	// Entries lists every path the walk looked at, in walk order.
+	Entries []Entry `json:"entries"`
+	// Contents holds the start of each file, with -repro-content, so a
+	// maintainer can see whether a filtered file should have matched.
+	Contents map[string]string `json:"contents,omitempty"`
+}
+
+// BundleConfig is the part of the effective configuration that decides what
+// the walk searches.
+type BundleConfig struct {
+	Pattern              string   `json:"pattern"`
+	Root                 string   `json:"root"`
+	Extensions           []string `json:"extensions,omitempty"`
+	IgnoreDirs           []string `json:"ignore_dirs"`
+	MaxSizeBytes         int64    `json:"max_size_bytes"`
+	MaxDepth             int      `json:"max_depth"`
+	FollowSymlinks       bool     `json:"follow_symlinks"`
+	RespectGitattributes bool     `json:"respect_gitattributes"`
+	WalkOrder            string   `json:"walk_order"`
+}
+
+// Entry is one walk decision.
+type Entry struct {
+	Path     string `json:"path"`
+	Dir      bool   `json:"dir,omitempty"`
+	Symlink  bool   `json:"symlink,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+	Decision string `json:"decision"`
+	Rule     string `json:"rule,omitempty"`
+}
+
+// Recorder collects a bundle during a run. Decide is called by the walk and
+// the wrapped FS by every reader, so it is safe for concurrent use.
+type Recorder struct {
+	inner          fsys.FS
+	includeContent bool
+
+	mu           sync.Mutex
+	bundle       Bundle
+	contentBytes int
+}
+
+// NewRecorder starts a bundle for a run of cfg with the given arguments,
+// reading through cfg.FS. With includeContent, the start of every file the
+// walk decided on is kept as well, searched or filtered.
+func NewRecorder(cfg config.Config, args []string, includeContent bool) *Recorder {
+	extensions := make([]string, 0, len(cfg.Extensions))
+	for ext := range cfg.Extensions {
+		extensions = append(extensions, ext)
+	}
+	sort.Strings(extensions)
+	ignoreDirs := make([]string, 0, len(cfg.DefaultIgnoreDirs))
+	for dir := range cfg.DefaultIgnoreDirs {
+		ignoreDirs = append(ignoreDirs, dir)
+	}
+	sort.Strings(ignoreDirs)
+
+	return &Recorder{
+		inner:          cfg.FS,
+		includeContent: includeContent,
+		bundle: Bundle{
+			Version:         BundleVersion,
+			GosearchVersion: cfg.VersionLabel,
+			Args:            append([]string(nil), args...),
+			Config: BundleConfig{
+				Pattern:              cfg.Pattern,
+				Root:                 cfg.RootPath,
+				Extensions:           extensions,
+				IgnoreDirs:           ignoreDirs,
+				MaxSizeBytes:         cfg.MaxSizeBytes,
+				MaxDepth:             cfg.MaxDepth,
+				FollowSymlinks:       cfg.FollowSymlinks,
+				RespectGitattributes: cfg.RespectGitattributes,
+				WalkOrder:            cfg.WalkOrder,
+			},
+			IgnoreFiles: make(map[string]string),
+		},
+	}
+}
+
+// FS returns the filesystem the run should read through, which records the
+// contents of ignore files as they are loaded.
+func (recorder *Recorder) FS() fsys.FS {
+	return recordingFS{FS: recorder.inner, recorder: recorder}
+}
+
+// Decide records one walk decision; it is the walk's OnDecision hook.
+func (recorder *Recorder) Decide(decision search.WalkDecision) {
+	entry := Entry{Path: decision.Path, Dir: decision.Dir, Symlink: decision.Symlink, Decision: decision.Decision, Rule: decision.Rule}
+	if !decision.Dir {
+		if info, err := recorder.inner.Lstat(decision.Path); err == nil {
+			entry.Size = info.Size()
+		}
+	}
+	var content []byte
+	if recorder.includeContent && !decision.Dir && !decision.Symlink {
+		content = recorder.readStart(decision.Path)
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.bundle.Entries = append(recorder.bundle.Entries, entry)
+	if content != nil && recorder.contentBytes+len(content) <= contentTotalBytes {
+		if recorder.bundle.Contents == nil {
+			recorder.bundle.Contents = make(map[string]string)
+		}
+		recorder.bundle.Contents[decision.Path] = string(content)
+		recorder.contentBytes += len(content)
+	}
+}
+
+func (recorder *Recorder) readStart(path string) []byte {
+	file, err := recorder.inner.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	content, err := io.ReadAll(io.LimitReader(file, contentFileBytes))
+	if err != nil {
+		return nil
+	}
+	return content
+}
+
+// Write saves the bundle as indented JSON, replacing any file at path whole.
+func (recorder *Recorder) Write(path string) error {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	data, err := json.MarshalIndent(recorder.bundle, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := output.ReplaceFile(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("repro: %w", err)
+	}
+	return nil
+}
+
+// recordingFS keeps a copy of every ignore file opened through it.
+type recordingFS struct {
+	fsys.FS
+	recorder *Recorder
+}
+
+func (filesystem recordingFS) Open(name string) (fsys.File, error) {
+	file, err := filesystem.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ignoreFileNames[filepath.Base(name)]; !ok {
+		return file, nil
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	filesystem.recorder.mu.Lock()
+	filesystem.recorder.bundle.IgnoreFiles[name] = string(content)
+	filesystem.recorder.mu.Unlock()
+	return &recordedFile{Reader: bytes.NewReader(content), info: info}, nil
+}
+
+type recordedFile struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (file *recordedFile) Stat() (fs.FileInfo, error) { return file.info, nil }
+
+func (file *recordedFile) Close() error { return nil }
+
+// Load reads a bundle written by -repro.
+func Load(path string) (Bundle, error) {
+	var bundle Bundle
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return bundle, fmt.Errorf("repro: %w", err)
+	}
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return bundle, fmt.Errorf("repro: %s: %w", path, err)
+	}
+	if bundle.Version != BundleVersion {
+		return bundle, fmt.Errorf("repro: %s: unsupported bundle version %d", path, bundle.Version)
+	}
+	return bundle, nil
+}
+
+// Difference is a path whose replayed decision differs from the recorded one.
+// An empty Recorded or Replayed means the path was not seen by that walk.
+type Difference struct {
+	Path     string
+	Recorded Entry
+	Replayed Entry
+}
+
+// Replay rebuilds the bundle's tree in memory, walks it again with the
+// bundle's configuration, and returns the paths decided differently, sorted.
+// Symlinks cannot be rebuilt in memory; they are left out on both sides.
+func Replay(bundle Bundle) ([]Difference, int) {
+	mem := fsys.NewMem()
+	mem.Mkdir(bundle.Config.Root)
+	recorded := make(map[string]Entry, len(bundle.Entries))
+	for _, entry := range bundle.Entries {
+		if entry.Symlink {
+			continue
+		}
+		recorded[entry.Path] = entry
+		if entry.Dir {
+			mem.Mkdir(entry.Path)
+			continue
+		}
+		mem.WriteFile(entry.Path, []byte(bundle.Contents[entry.Path]))
+		mem.SetSize(entry.Path, entry.Size)
+	}
+	for path, content := range bundle.IgnoreFiles {
+		mem.WriteFile(path, []byte(content))
+	}
+
+	cfg := config.Config{
+		RootPath:             bundle.Config.Root,
+		Extensions:           toSet(bundle.Config.Extensions),
+		DefaultIgnoreDirs:    toSet(bundle.Config.IgnoreDirs),
+		MaxSizeBytes:         bundle.Config.MaxSizeBytes,
+		MaxDepth:             bundle.Config.MaxDepth,
+		RespectGitattributes: bundle.Config.RespectGitattributes,
+		WalkOrder:            bundle.Config.WalkOrder,
+		FS:                   mem,
+		IgnoreCache:          ignore.NewCache(),
+	}
+	replayed := make(map[string]Entry)
+	hooks := search.WalkHooks{OnDecision: func(decision search.WalkDecision) {
+		replayed[decision.Path] = Entry{Path: decision.Path, Dir: decision.Dir, Decision: decision.Decision, Rule: decision.Rule}
+	}}
+	jobs := make(chan search.FileJob)
+	go func() {
+		for range jobs {
+		}
+	}()
+	_ = search.WalkFiles(context.Background(), cfg, jobs, io.Discard, &search.Metrics{}, hooks)
+	close(jobs)
+
+	var differences []Difference
+	for path, entry := range recorded {
+		again := replayed[path]
+		if again.Decision != entry.Decision || again.Rule != entry.Rule {
+			differences = append(differences, Difference{Path: path, Recorded: entry, Replayed: again})
+		}
+	}
+	for path, entry := range replayed {
+		if _, ok := recorded[path]; !ok {
+			differences = append(differences, Difference{Path: path, Replayed: entry})
+		}
+	}
+	sort.Slice(differences, func(i, j int) bool { return differences[i].Path < differences[j].Path })
+	return differences, len(recorded)
+}
+
+func toSet(values []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		set[value] = struct{}{}
+	}
+	return set
+}
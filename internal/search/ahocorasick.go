@@ -0,0 +1,133 @@
+package search
+
+// AhoCorasick matches many literal patterns in one pass over a line. It is
+// built once into a DFA over the bytes the patterns use, so a line costs the
+// same however many patterns there are. Its ranges are exactly those of a
+// MultiStrategy of one Matcher per pattern: each pattern's matches are
+// leftmost and non-overlapping, and ranges of different patterns are merged.
+type AhoCorasick struct {
+	lengths []int
+	// classes maps each byte to its column in delta; bytes that occur in no
+	// pattern share column 0.
+	classes [256]int32
+	stride  int32
+	// delta holds the next state for every state and byte class, with
+	// failure links already followed.
+	delta []int32
+	// outputs holds, for every state, the patterns that end there,
+	// including those reached by failure links.
+	outputs    [][]int32
+	ignoreCase bool
+	wholeWord  bool
+	// all requires a range from every pattern, for -match-all.
+	all bool
+}
+
+// NewAhoCorasick builds the automaton for patterns. With ignoreCase the
+// patterns and each line are case-folded first, as Matcher does.
+func NewAhoCorasick(patterns []string, ignoreCase bool, wholeWord bool, all bool) *AhoCorasick {
+	ac := &AhoCorasick{ignoreCase: ignoreCase, wholeWord: wholeWord, all: all}
+	folded := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		if ignoreCase {
+			pattern = foldString(pattern)
+		}
+		folded[i] = pattern
+		ac.lengths = append(ac.lengths, len(pattern))
+		for j := 0; j < len(pattern); j++ {
+			if ac.classes[pattern[j]] == 0 {
+				ac.stride++
+				ac.classes[pattern[j]] = ac.stride
+			}
+		}
+	}
+	ac.stride++
+
+	// Build the trie; 0 in delta means no edge until failures are filled.
+	ac.delta = make([]int32, ac.stride)
+	ac.outputs = make([][]int32, 1)
+	for index, pattern := range folded {
+		state := int32(0)
+		for j := 0; j < len(pattern); j++ {
+			slot := state*ac.stride + ac.classes[pattern[j]]
+			if ac.delta[slot] == 0 {
+				ac.delta[slot] = int32(len(ac.outputs))
+				ac.delta = append(ac.delta, make([]int32, ac.stride)...)
+				ac.outputs = append(ac.outputs, nil)
+			}
+			state = ac.delta[slot]
+		}
+		ac.outputs[state] = append(ac.outputs[state], int32(index))
+	}
+
+	// Breadth first, point missing edges where the failure state's go, and
+	// add the failure state's outputs.
+	fail := make([]int32, len(ac.outputs))
+	var queue []int32
+	for class := int32(0); class < ac.stride; class++ {
+		if next := ac.delta[class]; next != 0 {
+			queue = append(queue, next)
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		ac.outputs[state] = append(ac.outputs[state], ac.outputs[fail[state]]...)
+		for class := int32(0); class < ac.stride; class++ {
+			slot := state*ac.stride + class
+			failNext := ac.delta[fail[state]*ac.stride+class]
+			if next := ac.delta[slot]; next != 0 {
+				fail[next] = failNext
+				queue = append(queue, next)
+			} else {
+				ac.delta[slot] = failNext
+			}
+		}
+	}
+	return ac
+}
+
+// FindRanges returns every pattern's matches in line, merged as MultiStrategy
+// merges them.
+func (ac *AhoCorasick) FindRanges(line string) []MatchRange {
+	haystack := line
+	var bounds []int
+	if ac.ignoreCase {
+		haystack, bounds = foldLine(line)
+	}
+	var ranges []MatchRange
+	// nextStart holds, per pattern, where its next match may start; it is
+	// only allocated once a line has a match.
+	var nextStart []int
+	state := int32(0)
+	for i := 0; i < len(haystack); i++ {
+		state = ac.delta[state*ac.stride+ac.classes[haystack[i]]]
+		for _, index := range ac.outputs[state] {
+			if nextStart == nil {
+				nextStart = make([]int, len(ac.lengths))
+			}
+			end := i + 1
+			start := end - ac.lengths[index]
+			if start < nextStart[index] {
+				continue
+			}
+			lineStart, lineEnd, whole := foldedRange(bounds, start, end)
+			if !whole || (ac.wholeWord && !isWholeWordMatch(line, lineStart, lineEnd)) {
+				continue
+			}
+			nextStart[index] = end
+			ranges = append(ranges, MatchRange{Start: lineStart, End: lineEnd, Pattern: int(index)})
+		}
+	}
+	if ac.all {
+		if nextStart == nil {
+			return nil
+		}
+		for _, next := range nextStart {
+			if next == 0 {
+				return nil
+			}
+		}
+	}
+	return mergeRanges(ranges)
+}
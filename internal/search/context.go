@@ -0,0 +1,332 @@
+package search
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vennictus/gosearch/internal/clock"
+)
+
+// ContextLine is a non-matching line printed around a match for -A/-B/-C.
+type ContextLine struct {
+	Line   int
+	Text   string
+	Offset int64
+}
+
+// FileStats is what -file-stats reports about one scanned file. Duration
+// runs from opening the file to matching its last line.
+type FileStats struct {
+	Lines    int
+	Matches  int
+	Bytes    int64
+	Duration time.Duration
+}
+
+// unitMode selects what a FileUnit reports once its file is done.
+type unitMode int
+
+const (
+	// unitContext reports the file's matches as one group with context.
+	unitContext unitMode = iota
+	// unitWithoutMatch reports the file only if nothing matched (-L).
+	unitWithoutMatch
+	// unitCount reports the number of matching lines (-format grep -count).
+	unitCount
+	// unitCountMatches reports the number of matches (-format grep
+	// -count-matches).
+	unitCountMatches
+	// unitBinary reports that a binary file matched (-format grep).
+	unitBinary
+)
+
+// FileUnit follows one file through the pipeline when the outcome depends on
+// the whole file: context lines, -L, and grep-style per-file counts and
+// binary hits. The reader appends every line and one pending count per
+// queued item; CPU workers record matches, and whichever worker retires the
+// last pending item builds the file's result. A streamed unit, which only
+// keeps a file's matches in order, passes them on as they come instead.
+type FileUnit struct {
+	path string
+	meta *FileMeta
+	// seq is the file's FileJob.Seq in ordered mode, where the unit always
+	// sends a final result, and 0 otherwise.
+	seq    int64
+	mode   unitMode
+	before int
+	after  int
+	// incomplete is set by the reader when the file could not be read to
+	// the end, so -L does not list a file it never fully searched.
+	incomplete bool
+	// events makes the unit report its group even without matches, for
+	// -file-events; skipped is why the file was not searched, if it wasn't.
+	events  bool
+	skipped string
+	// clock is set with -file-stats, which reports the file once it is
+	// retired; the reader sets started, lineCount, and bytes before it
+	// queues the end-of-file item.
+	clock     clock.Clock
+	started   time.Time
+	lineCount int
+	bytes     int64
+	// tracked makes the unit always send a final result carrying its
+	// outcome.
+	tracked bool
+	// limit is -m: the reader stops once the unit has this many matches,
+	// and only the first limit by line are reported. 0 means no limit.
+	limit int
+
+	// lines (and offsets, with -b) are written only by the reader, before it
+	// queues the end-of-file item, and read only by the worker that retires
+	// the unit.
+	lines   []string
+	offsets []int64
+	pending atomic.Int64
+
+	mu sync.Mutex
+	// matches is kept in unitContext mode unless the unit is streamed, and
+	// with only Line and Ranges set in unitCountMatches mode; other modes
+	// need the count.
+	matches []Result
+	matched int
+
+	// stream is set for ordered output without context or -file-events,
+	// where a file's matches need only come out in line order. Workers pass
+	// each line's matches on once every line before it has been: frontier
+	// is the next line to pass on, done holds the matches of lines after it
+	// that finished first, and passed counts the matches passed on, for -m.
+	// streamMu guards them and is held while sending, so lines go out in
+	// order.
+	stream   bool
+	streamMu sync.Mutex
+	frontier int
+	done     map[int][]Result
+	passed   int
+}
+
+// NewFileUnit creates a unit for path with the given context sizes.
+func NewFileUnit(path string, before int, after int) *FileUnit {
+	unit := &FileUnit{path: path, mode: unitContext, before: before, after: after}
+	unit.pending.Store(1)
+	return unit
+}
+
+func newModeFileUnit(path string, mode unitMode) *FileUnit {
+	unit := &FileUnit{path: path, mode: mode}
+	unit.pending.Store(1)
+	return unit
+}
+
+func (unit *FileUnit) addLine(text string, offset int64, trackOffsets bool) {
+	if unit.mode == unitContext && (unit.before > 0 || unit.after > 0) {
+		unit.lines = append(unit.lines, text)
+		if trackOffsets {
+			unit.offsets = append(unit.offsets, offset)
+		}
+	}
+	unit.pending.Add(1)
+}
+
+// addTrailingLine keeps a line read past the last one queued, after the
+// unit reached its limit, as after-context for the matches before it.
+func (unit *FileUnit) addTrailingLine(text string, offset int64, trackOffsets bool) {
+	if unit.mode == unitContext && unit.after > 0 {
+		unit.lines = append(unit.lines, text)
+		if trackOffsets {
+			unit.offsets = append(unit.offsets, offset)
+		}
+	}
+}
+
+// full reports whether the unit has reached its -m limit. Lines are queued
+// in order, so its first limit matching lines are then all queued already.
+func (unit *FileUnit) full() bool {
+	if unit.limit == 0 {
+		return false
+	}
+	unit.mu.Lock()
+	defer unit.mu.Unlock()
+	return unit.matched >= unit.limit
+}
+
+func (unit *FileUnit) addMatch(result Result) {
+	unit.mu.Lock()
+	unit.matched++
+	switch unit.mode {
+	case unitContext:
+		if !unit.stream {
+			unit.matches = append(unit.matches, result)
+		}
+	case unitCountMatches:
+		unit.matches = append(unit.matches, Result{Line: result.Line, Ranges: result.Ranges})
+	}
+	unit.mu.Unlock()
+}
+
+// pass sends the matches of line once every line before it has been passed
+// on, followed by those of the lines after it that finished first; until
+// then it keeps them. It reports false if ctx was cancelled while sending.
+func (unit *FileUnit) pass(ctx context.Context, line int, matches []Result, results chan<- Result) bool {
+	unit.streamMu.Lock()
+	defer unit.streamMu.Unlock()
+	if line != unit.frontier {
+		if unit.done == nil {
+			unit.done = make(map[int][]Result)
+		}
+		unit.done[line] = matches
+		return true
+	}
+	for {
+		for _, result := range matches {
+			// Workers may match lines queued before the reader saw the
+			// limit; only the first limit by line are passed on.
+			if unit.limit > 0 && unit.passed >= unit.limit {
+				break
+			}
+			unit.passed++
+			result.Seq = unit.seq
+			select {
+			case <-ctx.Done():
+				return false
+			case results <- result:
+			}
+		}
+		unit.frontier++
+		next, ok := unit.done[unit.frontier]
+		if !ok {
+			return true
+		}
+		delete(unit.done, unit.frontier)
+		matches = next
+	}
+}
+
+// retire releases one pending item and reports whether it was the last.
+func (unit *FileUnit) retire() bool {
+	return unit.pending.Add(-1) == 0
+}
+
+// finish builds the result for a retired unit and reports whether there is
+// anything to send. In ordered mode, with -file-stats, and when outcomes are
+// tracked there always is: a file with nothing to print ends with
+// KindFileDone.
+func (unit *FileUnit) finish() (Result, bool) {
+	// Workers may match lines queued before the reader saw the limit.
+	if unit.limit > 0 {
+		unit.matched = min(unit.matched, unit.limit)
+	}
+	result, ok := unit.result()
+	if !ok && (unit.seq > 0 || unit.clock != nil || unit.tracked) {
+		result, ok = Result{Kind: KindFileDone, Path: unit.path}, true
+	}
+	result.Seq = unit.seq
+	if unit.tracked {
+		result.Outcome = unit.outcome()
+	}
+	if unit.clock != nil {
+		result.Stats = &FileStats{Lines: unit.lineCount, Matches: unit.matched, Bytes: unit.bytes, Duration: unit.clock.Now().Sub(unit.started)}
+	}
+	return result, ok
+}
+
+// outcome classifies the file once the unit is retired.
+func (unit *FileUnit) outcome() FileOutcome {
+	switch {
+	case unit.skipped != "":
+		return skipOutcome(unit.skipped)
+	case unit.incomplete:
+		return OutcomeError
+	case unit.matched > 0:
+		return OutcomeMatched
+	default:
+		return OutcomeNoMatch
+	}
+}
+
+func (unit *FileUnit) result() (Result, bool) {
+	switch unit.mode {
+	case unitWithoutMatch:
+		if unit.outcome() != OutcomeNoMatch {
+			return Result{}, false
+		}
+		return Result{Kind: KindFileWithoutMatch, Path: unit.path, Meta: unit.meta}, true
+	case unitCount:
+		return Result{Kind: KindFileCount, Path: unit.path, Count: unit.matched, Meta: unit.meta}, true
+	case unitCountMatches:
+		count := 0
+		for _, match := range unit.firstMatches() {
+			count += match.MatchCount()
+		}
+		return Result{Kind: KindFileCount, Path: unit.path, Count: count, Meta: unit.meta}, true
+	case unitBinary:
+		return Result{Kind: KindBinaryMatch, Path: unit.path, Meta: unit.meta}, unit.matched > 0
+	}
+	if unit.stream {
+		// Its matches are already on their way.
+		return Result{}, false
+	}
+	if unit.events && unit.skipped != SkipSize {
+		result := unit.group()
+		result.SkipReason = unit.skipped
+		if unit.incomplete {
+			result.SkipReason = SkipReadError
+		}
+		return result, true
+	}
+	if unit.matched == 0 {
+		return Result{}, false
+	}
+	return unit.group(), true
+}
+
+// group orders the unit's matches by line (or by offset, for -hex-pattern)
+// and attaches context to each, so that a context line shared by
+// neighbouring matches is attached only once.
+func (unit *FileUnit) group() Result {
+	matches := unit.firstMatches()
+	covered := 0
+	for i := range matches {
+		line := matches[i].Line
+		for number := max(covered+1, line-unit.before); number < line; number++ {
+			matches[i].Before = append(matches[i].Before, unit.contextLine(number))
+		}
+		covered = line
+
+		limit := min(line+unit.after, len(unit.lines))
+		if i+1 < len(matches) {
+			limit = min(limit, matches[i+1].Line-1)
+		}
+		for number := line + 1; number <= limit; number++ {
+			matches[i].After = append(matches[i].After, unit.contextLine(number))
+		}
+		covered = max(covered, limit)
+	}
+	return Result{Kind: KindGroup, Path: unit.path, Group: matches}
+}
+
+// firstMatches orders the unit's matches by line (or by offset, for
+// -hex-pattern) and returns the first -m of them.
+func (unit *FileUnit) firstMatches() []Result {
+	matches := unit.matches
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Line != matches[j].Line {
+			return matches[i].Line < matches[j].Line
+		}
+		return matches[i].Offset < matches[j].Offset
+	})
+	if unit.limit > 0 && len(matches) > unit.limit {
+		matches = matches[:unit.limit]
+	}
+	return matches
+}
+
+func (unit *FileUnit) contextLine(number int) ContextLine {
+	line := ContextLine{Line: number, Text: unit.lines[number-1]}
+	if unit.offsets != nil {
+		line.Offset = unit.offsets[number-1]
+	}
+	return line
+}
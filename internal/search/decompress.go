@@ -0,0 +1,267 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+
+	"github.com/vennictus/gosearch/internal/clock"
+	"github.com/vennictus/gosearch/internal/config"
+)
+
+// CompressedJob is a compressed file admitted by an IO worker and queued for
+// decompress workers, which open it and inflate it as they read, so no file
+// is ever held whole in memory, compressed or not.
+type CompressedJob struct {
+	Path string
+	Meta *FileMeta
+	Seq  int64
+}
+
+// Compression formats -z searches.
+const (
+	FormatGzip = "gzip"
+	FormatZstd = "zstd"
+	FormatXz   = "xz"
+)
+
+// CompressionFormats lists the -z formats in the order -metrics prints them.
+var CompressionFormats = [...]string{FormatGzip, FormatZstd, FormatXz}
+
+var compressedExtensions = map[string]string{
+	".gz":   FormatGzip,
+	".zst":  FormatZstd,
+	".zstd": FormatZstd,
+	".xz":   FormatXz,
+}
+
+var compressionMagic = []struct {
+	format string
+	magic  []byte
+}{
+	{FormatGzip, []byte{0x1f, 0x8b}},
+	{FormatZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{FormatXz, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+}
+
+// errDecompressedTooLarge stops a -z file inflating past
+// -max-decompressed-size.
+var errDecompressedTooLarge = errors.New("decompressed size exceeds -max-decompressed-size")
+
+// IsCompressedPath reports whether -z treats path as a compressed file.
+func IsCompressedPath(path string) bool {
+	_, ok := compressedExtensions[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// compressionFormat names the format of a compressed file by its magic
+// bytes, the first bytes of the file in head, falling back to its extension
+// so a corrupt file still fails with the decoder it claims to need.
+func compressionFormat(path string, head []byte) string {
+	for _, candidate := range compressionMagic {
+		if bytes.HasPrefix(head, candidate.magic) {
+			return candidate.format
+		}
+	}
+	return compressedExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// openDecompressor returns a reader of compressed inflated as format.
+func openDecompressor(format string, compressed io.Reader) (io.ReadCloser, error) {
+	switch format {
+	case FormatZstd:
+		decoder, err := zstd.NewReader(compressed, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	case FormatXz:
+		reader, err := xz.NewReader(compressed)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(reader), nil
+	default:
+		return gzip.NewReader(compressed)
+	}
+}
+
+// cappedReader fails with errDecompressedTooLarge once more than remaining
+// bytes have been read; a stream of exactly the cap reads cleanly.
+type cappedReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (capped *cappedReader) Read(p []byte) (int, error) {
+	if capped.remaining <= 0 {
+		var probe [1]byte
+		n, err := capped.reader.Read(probe[:])
+		if n > 0 {
+			return 0, errDecompressedTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > capped.remaining {
+		p = p[:capped.remaining]
+	}
+	n, err := capped.reader.Read(p)
+	capped.remaining -= int64(n)
+	return n, err
+}
+
+// DecompressErrorCounts counts -z files that failed to decode, by format.
+type DecompressErrorCounts struct {
+	counts [len(CompressionFormats)]atomic.Int64
+}
+
+func (counts *DecompressErrorCounts) add(format string) {
+	for i, name := range CompressionFormats {
+		if name == format {
+			counts.counts[i].Add(1)
+			return
+		}
+	}
+}
+
+// Count returns how many files of format failed to decode.
+func (counts *DecompressErrorCounts) Count(format string) int64 {
+	for i, name := range CompressionFormats {
+		if name == format {
+			return counts.counts[i].Load()
+		}
+	}
+	return 0
+}
+
+// DecompressWorker inflates compressed files and sends their lines to CPU
+// workers. Keeping this CPU work out of IOWorker stops archive-heavy trees
+// from starving plain file reads.
+func DecompressWorker(
+	ctx context.Context,
+	cfg config.Config,
+	compressedJobs <-chan CompressedJob,
+	lineJobs chan<- LineItem,
+	stderr io.Writer,
+	wg *sync.WaitGroup,
+	metrics *Metrics,
+) {
+	metrics.DecompressWorkersStarted.Add(1)
+	defer func() {
+		metrics.DecompressWorkersStopped.Add(1)
+		wg.Done()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job, ok := <-compressedJobs:
+			if !ok {
+				return
+			}
+
+			metrics.DecompressActiveWorkers.Add(1)
+			UpdateMaxActive(&metrics.DecompressMaxActive, metrics.DecompressActiveWorkers.Load())
+
+			func() {
+				defer metrics.DecompressActiveWorkers.Add(-1)
+
+				var started time.Time
+				if cfg.CollectsFileStats() {
+					started = cfg.Clock.Now()
+				}
+				file, err := cfg.FS.Open(job.Path)
+				if err != nil {
+					reportFileError(stderr, metrics, job.Path, job.Seq, fmt.Errorf("%s: %w", job.Path, err))
+					skipFile(ctx, cfg, job.Path, job.Seq, SkipReadError, lineJobs)
+					return
+				}
+				defer file.Close()
+				counted := &countingReader{reader: file}
+				defer func() { metrics.BytesRead.Add(counted.count) }()
+				compressed := bufio.NewReader(counted)
+				magic, err := compressed.Peek(8)
+				if err != nil && !errors.Is(err, io.EOF) {
+					reportFileError(stderr, metrics, job.Path, job.Seq, fmt.Errorf("%s: %w", job.Path, err))
+					skipFile(ctx, cfg, job.Path, job.Seq, SkipReadError, lineJobs)
+					return
+				}
+
+				format := compressionFormat(job.Path, magic)
+				fail := func(err error) {
+					if errors.Is(err, errDecompressedTooLarge) {
+						reportFileError(stderr, metrics, job.Path, job.Seq, fmt.Errorf("%s: %w (%d bytes)", job.Path, err, cfg.MaxDecompressedBytes))
+						return
+					}
+					metrics.DecompressErrors.add(format)
+					reportFileError(stderr, metrics, job.Path, job.Seq, fmt.Errorf("%s: corrupt %s stream: %w", job.Path, format, err))
+				}
+
+				inflated, err := openDecompressor(format, compressed)
+				if err != nil {
+					fail(err)
+					skipFile(ctx, cfg, job.Path, job.Seq, SkipReadError, lineJobs)
+					return
+				}
+				defer inflated.Close()
+				metrics.FilesDecompressed.Add(1)
+
+				var stream io.Reader = inflated
+				if cfg.MaxDecompressedBytes > 0 {
+					stream = &cappedReader{reader: inflated, remaining: cfg.MaxDecompressedBytes}
+				}
+				reader := bufio.NewReader(stream)
+				head, err := reader.Peek(512)
+				if err != nil && !errors.Is(err, io.EOF) {
+					fail(err)
+					skipFile(ctx, cfg, job.Path, job.Seq, SkipReadError, lineJobs)
+					return
+				}
+				binary := bytes.IndexByte(head, 0) >= 0
+				if binary && !cfg.BinaryAsText && cfg.OutputFormat != "grep" {
+					metrics.FileErrors.add(ErrorBinary)
+					skipFile(ctx, cfg, job.Path, job.Seq, SkipBinary, lineJobs)
+					return
+				}
+
+				scanner := bufio.NewScanner(reader)
+				if !sendLines(ctx, cfg, scanner, lineSource{path: job.Path, meta: job.Meta, seq: job.Seq, binary: binary, started: started, bytesRead: func() int64 { return counted.count }}, lineJobs, metrics) {
+					return
+				}
+				if err := scanner.Err(); err != nil {
+					fail(err)
+				}
+				metrics.FilesScanned.Add(1)
+			}()
+		}
+	}
+}
+
+// DecompressScaler grows decompress workers while compressed files queue up
+// faster than the running workers inflate them.
+func DecompressScaler(
+	ctx context.Context,
+	clk clock.Clock,
+	compressedJobs <-chan CompressedJob,
+	stop <-chan struct{},
+	decompressWorkers int,
+	maxWorkers int,
+	spawn func(),
+	metrics *Metrics,
+	done chan<- struct{},
+) {
+	scaleOnPressure(ctx, clk, func() int { return len(compressedJobs) }, stop, decompressWorkers, maxWorkers, spawn, &metrics.DecompressScaleUps, done)
+}
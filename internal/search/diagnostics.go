@@ -0,0 +1,50 @@
+// Package search provides diagnostic routing.
+package search
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DiagnosticWriter routes diagnostic lines through the results channel so the
+// printer can interleave them with matches on a shared output stream.
+type DiagnosticWriter struct {
+	ctx      context.Context
+	results  chan<- Result
+	fallback io.Writer
+	// ordered tags per-file errors with the sequence number of the file
+	// they are printed before, so they keep their place in ordered output.
+	ordered bool
+}
+
+// NewDiagnosticWriter creates a writer that forwards each write as a diagnostic
+// result, falling back to the given writer once the context is cancelled.
+func NewDiagnosticWriter(ctx context.Context, results chan<- Result, fallback io.Writer, ordered bool) DiagnosticWriter {
+	return DiagnosticWriter{ctx: ctx, results: results, fallback: fallback, ordered: ordered}
+}
+
+// WriteFileError sends a per-file error to the printer with its category. In
+// ordered mode the printer holds it until the results of file seq are due.
+func (writer DiagnosticWriter) WriteFileError(path string, seq int64, category string, err error) {
+	if !writer.ordered {
+		seq = 0
+	}
+	select {
+	case <-writer.ctx.Done():
+		fmt.Fprintln(writer.fallback, err)
+	case writer.results <- Result{Kind: KindDiagnostic, Path: path, Text: err.Error(), ErrorCategory: category, Seq: seq}:
+	}
+}
+
+// Write sends one diagnostic line to the printer.
+func (writer DiagnosticWriter) Write(data []byte) (int, error) {
+	text := strings.TrimSuffix(string(data), "\n")
+	select {
+	case <-writer.ctx.Done():
+		return writer.fallback.Write(data)
+	case writer.results <- Result{Kind: KindDiagnostic, Text: text}:
+		return len(data), nil
+	}
+}
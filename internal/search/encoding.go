@@ -0,0 +1,80 @@
+package search
+
+import (
+	"bufio"
+	"io"
+	"unicode/utf8"
+)
+
+// Values for -on-bad-encoding.
+const (
+	BadEncodingRaw  = "raw"
+	BadEncodingWarn = "warn"
+	BadEncodingSkip = "skip"
+)
+
+// EncodingLatin1 is the -encoding value that transcodes misencoded files from
+// ISO-8859-1.
+const EncodingLatin1 = "latin1"
+
+// badEncodingThreshold is the share of invalid UTF-8 bytes in a file's sniffed
+// prefix above which the file is treated as misencoded.
+const badEncodingThreshold = 0.001
+
+// looksMisencoded reports whether prefix, a NUL-free start of a file, has
+// enough invalid UTF-8 to be in some other encoding. A rune cut off by the end
+// of the prefix does not count as invalid.
+func looksMisencoded(prefix []byte) bool {
+	if len(prefix) == 0 {
+		return false
+	}
+	invalid := 0
+	for index := 0; index < len(prefix); {
+		char, size := utf8.DecodeRune(prefix[index:])
+		if char == utf8.RuneError && size == 1 {
+			if !utf8.FullRune(prefix[index:]) {
+				break
+			}
+			invalid++
+		}
+		index += size
+	}
+	return float64(invalid)/float64(len(prefix)) > badEncodingThreshold
+}
+
+// latin1Reader transcodes ISO-8859-1 bytes to UTF-8.
+type latin1Reader struct {
+	src     *bufio.Reader
+	pending []byte
+	scratch [utf8.UTFMax]byte
+}
+
+func newLatin1Reader(src io.Reader) *latin1Reader {
+	return &latin1Reader{src: bufio.NewReader(src)}
+}
+
+func (reader *latin1Reader) Read(p []byte) (int, error) {
+	count := 0
+	for count < len(p) {
+		if len(reader.pending) > 0 {
+			copied := copy(p[count:], reader.pending)
+			reader.pending = reader.pending[copied:]
+			count += copied
+			continue
+		}
+		value, err := reader.src.ReadByte()
+		if err != nil {
+			if count > 0 {
+				return count, nil
+			}
+			return 0, err
+		}
+		if value < utf8.RuneSelf {
+			p[count] = value
+			count++
+			continue
+		}
+		reader.pending = utf8.AppendRune(reader.scratch[:0], rune(value))
+	}
+	return count, nil
+}
@@ -0,0 +1,115 @@
+// Package search provides per-file error classification.
+package search
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync/atomic"
+)
+
+// File error categories. The names are stable: they appear in JSON error
+// records, the error summary, metrics, and -errors-exit.
+const (
+	// ErrorPermission is a path that exists but could not be read.
+	ErrorPermission = "permission"
+	// ErrorNotFound is a path that vanished between listing and reading.
+	ErrorNotFound = "not-found"
+	// ErrorIO is any other read failure.
+	ErrorIO = "io"
+	// ErrorTooLarge is a file with a line longer than the scanner accepts.
+	ErrorTooLarge = "too-large"
+	// ErrorBinary is a binary file that was skipped.
+	ErrorBinary = "binary"
+	// ErrorEncoding is a file that is not valid UTF-8, searched raw with a
+	// warning or skipped.
+	ErrorEncoding = "encoding"
+	// ErrorTimeout is a line -engine pcre gave up matching.
+	ErrorTimeout = "timeout"
+)
+
+// ErrorCategories lists every category, in summary order.
+var ErrorCategories = [...]string{ErrorPermission, ErrorNotFound, ErrorIO, ErrorTooLarge, ErrorBinary, ErrorEncoding, ErrorTimeout}
+
+// errBadEncoding is the -on-bad-encoding warn diagnostic.
+var errBadEncoding = errors.New("unknown encoding, searching raw bytes")
+
+// ClassifyError returns the category of a per-file error.
+func ClassifyError(err error) string {
+	switch {
+	case errors.Is(err, fs.ErrPermission):
+		return ErrorPermission
+	case errors.Is(err, fs.ErrNotExist):
+		return ErrorNotFound
+	case errors.Is(err, bufio.ErrTooLong), errors.Is(err, errDecompressedTooLarge):
+		return ErrorTooLarge
+	case errors.Is(err, errBadEncoding):
+		return ErrorEncoding
+	case errors.Is(err, errMatchTimeout):
+		return ErrorTimeout
+	default:
+		return ErrorIO
+	}
+}
+
+// FileErrorCounts counts per-file errors by category.
+type FileErrorCounts struct {
+	counts [len(ErrorCategories)]atomic.Int64
+}
+
+func (counts *FileErrorCounts) add(category string) {
+	for i, name := range ErrorCategories {
+		if name == category {
+			counts.counts[i].Add(1)
+			return
+		}
+	}
+}
+
+// Count returns how many errors of category were counted.
+func (counts *FileErrorCounts) Count(category string) int64 {
+	for i, name := range ErrorCategories {
+		if name == category {
+			return counts.counts[i].Load()
+		}
+	}
+	return 0
+}
+
+// Summary describes the errors counted in the selected categories, e.g.
+// "file errors: permission=1 not-found=2", for -errors-exit.
+func (counts *FileErrorCounts) Summary(selected map[string]struct{}) string {
+	summary := "file errors:"
+	for _, category := range ErrorCategories {
+		if _, ok := selected[category]; !ok {
+			continue
+		}
+		if count := counts.Count(category); count > 0 {
+			summary += fmt.Sprintf(" %s=%d", category, count)
+		}
+	}
+	return summary
+}
+
+// fileErrorWriter is implemented by diagnostic writers that keep the path and
+// category of a per-file error, for JSON error records, and the file it
+// belongs before in ordered output.
+type fileErrorWriter interface {
+	WriteFileError(path string, seq int64, category string, err error)
+}
+
+// reportFileError counts err against its category and prints it as a
+// diagnostic. err is printed as is, so it should already name path. seq is
+// the FileJob.Seq of the file the error is printed before: the file itself,
+// or for the walk the next file it enqueues.
+func reportFileError(stderr io.Writer, metrics *Metrics, path string, seq int64, err error) {
+	category := ClassifyError(err)
+	metrics.FileErrors.add(category)
+	if writer, ok := stderr.(fileErrorWriter); ok {
+		writer.WriteFileError(path, seq, category, err)
+		return
+	}
+	fmt.Fprintln(stderr, err)
+}
@@ -0,0 +1,131 @@
+package search
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/vennictus/gosearch/internal/config"
+)
+
+// lineSink consumes the lines of a file opened by fileScanner. It returns
+// false when the search was cancelled before the file was finished.
+type lineSink func(scanner *bufio.Scanner, source lineSource) bool
+
+// fileScanner reads files the same way for the worker pipeline and for the
+// synchronous ScanFile helpers: -max-size, binary and encoding checks,
+// transcoding, and line scanning all live here, and only what happens to
+// each line differs.
+type fileScanner struct {
+	cfg     config.Config
+	metrics *Metrics
+	// warn reports a problem with a file that is searched anyway; nil
+	// discards it.
+	warn func(path string, seq int64, err error)
+}
+
+// scanOutcome is what happened to one file.
+type scanOutcome struct {
+	// skipped is why the file was not searched: SkipBinary, SkipEncoding,
+	// or SkipReadError with err set.
+	skipped string
+	// err names the file and why it could not be read, or read to the end.
+	err error
+	// cancelled is set when the sink stopped before the end of the file.
+	cancelled bool
+}
+
+// admit applies -max-size to a file and collects the metadata its results
+// carry for -with-metadata and -sort, stating it unless the walk already
+// did. ok is false for a file over the limit.
+func (scanner fileScanner) admit(job FileJob) (meta *FileMeta, ok bool, err error) {
+	cfg := scanner.cfg
+	info := job.Info
+	if info == nil && (cfg.MaxSizeBytes > 0 || cfg.NeedsFileMeta()) {
+		statInfo, statErr := cfg.FS.Stat(job.Path)
+		if statErr != nil && cfg.MaxSizeBytes > 0 {
+			return nil, false, fmt.Errorf("%s: %w", job.Path, statErr)
+		}
+		info = statInfo
+	}
+	if cfg.MaxSizeBytes > 0 && info.Size() > cfg.MaxSizeBytes {
+		scanner.metrics.FilesSkippedSize.Add(1)
+		scanner.metrics.EmptyRun.skippedSize(job.Path)
+		return nil, false, nil
+	}
+	if cfg.NeedsFileMeta() && info != nil {
+		meta = &FileMeta{Size: info.Size(), ModTime: info.ModTime(), Mode: info.Mode()}
+	}
+	return meta, true, nil
+}
+
+// scan opens a file, decides from its first bytes whether and how to search
+// it, and hands its lines to sink.
+func (scanner fileScanner) scan(source lineSource, sink lineSink) scanOutcome {
+	cfg, metrics, path := scanner.cfg, scanner.metrics, source.path
+	if cfg.CollectsFileStats() {
+		source.started = cfg.Clock.Now()
+	}
+	file, err := cfg.FS.Open(path)
+	if err != nil {
+		return scanOutcome{skipped: SkipReadError, err: fmt.Errorf("%s: %w", path, err)}
+	}
+	defer file.Close()
+
+	sniff, err := sniffFile(file)
+	if err != nil {
+		return scanOutcome{skipped: SkipReadError, err: fmt.Errorf("%s: %w", path, err)}
+	}
+	if sniff.binary && !cfg.BinaryAsText && cfg.OutputFormat != "grep" {
+		metrics.FileErrors.add(ErrorBinary)
+		metrics.EmptyRun.skippedBinary(path)
+		return scanOutcome{skipped: SkipBinary}
+	}
+
+	counted := &countingReader{reader: file}
+	defer func() { metrics.BytesRead.Add(counted.count) }()
+	var reader io.Reader = counted
+	transcoded := false
+	if sniff.badEncoding {
+		switch {
+		case cfg.Encoding == EncodingLatin1:
+			reader = newLatin1Reader(counted)
+			transcoded = true
+			sniff.scanBuffer = nil
+			metrics.FilesTranscoded.Add(1)
+		case cfg.OnBadEncoding == BadEncodingSkip:
+			metrics.FilesSkippedEncoding.Add(1)
+			metrics.FileErrors.add(ErrorEncoding)
+			return scanOutcome{skipped: SkipEncoding}
+		case cfg.OnBadEncoding == BadEncodingWarn && scanner.warn != nil:
+			scanner.warn(path, source.seq, fmt.Errorf("%s: %w", path, errBadEncoding))
+		}
+	}
+
+	lines := bufio.NewScanner(reader)
+	if sniff.scanBuffer != nil {
+		lines.Buffer(sniff.scanBuffer, bufio.MaxScanTokenSize)
+	}
+	source.transcoded, source.binary = transcoded, sniff.binary
+	source.bytesRead = func() int64 { return counted.count }
+	if !sink(lines, source) {
+		return scanOutcome{cancelled: true}
+	}
+	metrics.FilesScanned.Add(1)
+	if err := lines.Err(); err != nil {
+		return scanOutcome{err: fmt.Errorf("%s: %w", path, err)}
+	}
+	return scanOutcome{}
+}
+
+// countingReader counts the bytes read through it, for -stats.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (counted *countingReader) Read(data []byte) (int, error) {
+	n, err := counted.reader.Read(data)
+	counted.count += int64(n)
+	return n, err
+}
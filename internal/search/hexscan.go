@@ -0,0 +1,135 @@
+// Package search provides raw byte-sequence search for -hex-pattern.
+package search
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/vennictus/gosearch/internal/config"
+)
+
+// rawChunkSize is how many bytes the raw reader hands to CPU workers at a time.
+const rawChunkSize = 64 << 10
+
+// HexStrategy finds a byte sequence in raw file content. Its "lines" are the
+// chunks produced by sendChunks, and its ranges are byte ranges within them.
+type HexStrategy struct {
+	needle []byte
+}
+
+// NewHexStrategy creates a strategy for the decoded -hex-pattern bytes.
+func NewHexStrategy(needle []byte) *HexStrategy {
+	return &HexStrategy{needle: needle}
+}
+
+// FindRanges returns every non-overlapping occurrence of the byte sequence.
+func (strategy *HexStrategy) FindRanges(chunk string) []MatchRange {
+	var ranges []MatchRange
+	needle := string(strategy.needle)
+	for start := 0; ; {
+		index := strings.Index(chunk[start:], needle)
+		if index < 0 {
+			return ranges
+		}
+		begin := start + index
+		ranges = append(ranges, MatchRange{Start: begin, End: begin + len(needle)})
+		start = begin + len(needle)
+	}
+}
+
+// sendChunks queues a file's raw bytes for CPU workers in chunks of
+// rawChunkSize, ignoring line structure and binary content. Each chunk
+// starts with the last overlap bytes of the one before, so a sequence of
+// overlap+1 bytes split across two reads is still found, and found once: it
+// cannot fit in the overlap alone. Offset is the chunk's position in the
+// file. In ordered mode the chunks share a FileUnit, as lines do. It
+// returns false if ctx was cancelled first, and any read error.
+func sendChunks(ctx context.Context, cfg config.Config, reader io.Reader, source lineSource, lineJobs chan<- LineItem, metrics *Metrics) (bool, error) {
+	var unit *FileUnit
+	if cfg.Ordered || cfg.TracksOutcomes() {
+		unit = NewFileUnit(source.path, 0, 0)
+		unit.meta, unit.tracked = source.meta, cfg.TracksOutcomes()
+		if cfg.Ordered {
+			unit.seq = source.seq
+		}
+	}
+	overlap := len(cfg.HexPattern) - 1
+	buffer := make([]byte, overlap+rawChunkSize)
+	carried := 0
+	var offset int64
+	var readErr error
+	for {
+		count, err := io.ReadFull(reader, buffer[carried:])
+		metrics.BytesRead.Add(int64(count))
+		if count > 0 {
+			chunk := buffer[:carried+count]
+			if unit != nil {
+				unit.addLine("", offset, false)
+			}
+			select {
+			case <-ctx.Done():
+				return false, nil
+			case lineJobs <- LineItem{Path: source.path, Text: string(chunk), Offset: offset, Meta: source.meta, Unit: unit, Raw: true}:
+				metrics.LinesEnqueued.Add(1)
+			}
+			keep := min(overlap, len(chunk))
+			offset += int64(len(chunk) - keep)
+			carried = copy(buffer, chunk[len(chunk)-keep:])
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				readErr = err
+			}
+			break
+		}
+	}
+	if unit != nil {
+		unit.incomplete = readErr != nil
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case lineJobs <- LineItem{Path: source.path, Meta: source.meta, Unit: unit, EndOfFile: true}:
+		}
+	}
+	return true, readErr
+}
+
+// byteMatches returns one KindByteMatch result per occurrence in a raw
+// chunk, with its offset in the file.
+func byteMatches(strategy MatchStrategy, item LineItem) []Result {
+	var matches []Result
+	for _, match := range strategy.FindRanges(item.Text) {
+		matches = append(matches, Result{
+			Kind:   KindByteMatch,
+			Path:   item.Path,
+			Text:   strings.ToUpper(hex.EncodeToString([]byte(item.Text[match.Start:match.End]))),
+			Offset: item.Offset + int64(match.Start),
+			Meta:   item.Meta,
+		})
+	}
+	return matches
+}
+
+// scanRaw sends a file to CPU workers as -hex-pattern chunks. Binary and
+// encoding checks do not apply: the pattern is bytes, not text.
+func scanRaw(ctx context.Context, cfg config.Config, source lineSource, lineJobs chan<- LineItem, stderr io.Writer, metrics *Metrics) {
+	file, err := cfg.FS.Open(source.path)
+	if err != nil {
+		reportFileError(stderr, metrics, source.path, source.seq, fmt.Errorf("%s: %w", source.path, err))
+		skipFile(ctx, cfg, source.path, source.seq, SkipReadError, lineJobs)
+		return
+	}
+	defer file.Close()
+	completed, err := sendChunks(ctx, cfg, file, source, lineJobs, metrics)
+	if !completed {
+		return
+	}
+	metrics.FilesScanned.Add(1)
+	if err != nil {
+		reportFileError(stderr, metrics, source.path, source.seq, fmt.Errorf("%s: %w", source.path, err))
+	}
+}
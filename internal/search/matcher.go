@@ -2,22 +2,119 @@
 package search
 
 import (
+	"math"
 	"regexp"
+	"sort"
 	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ResultKind distinguishes match records from other events sharing the results channel.
+type ResultKind int
+
+const (
+	// KindMatch is a matching line.
+	KindMatch ResultKind = iota
+	// KindDiagnostic is a stderr line routed through the printer. A per-file
+	// error also carries its Path and ErrorCategory.
+	KindDiagnostic
+	// KindFilename is a file whose base name matched the pattern; Ranges index into the base name.
+	KindFilename
+	// KindWalkDone marks the end of traversal.
+	KindWalkDone
+	// KindGroup carries one file's matches, in line order and with context
+	// lines attached, so they print contiguously.
+	KindGroup
+	// KindFileWithoutMatch is a file that was searched to the end with no
+	// matching line, reported by -L.
+	KindFileWithoutMatch
+	// KindFileCount carries a file's number of matching lines in Count, for
+	// -format grep -count.
+	KindFileCount
+	// KindBinaryMatch is a binary file with at least one match, reported
+	// instead of its lines by -format grep.
+	KindBinaryMatch
+	// KindByteMatch is one occurrence of a -hex-pattern byte sequence at
+	// Offset, with Text holding the matched bytes in hex.
+	KindByteMatch
+	// KindFileDone marks the end of a file with nothing more to print, so
+	// ordered output can move on to the next file.
+	KindFileDone
 )
 
 // Result represents a single search match.
 type Result struct {
+	Kind   ResultKind
 	Path   string
 	Line   int
 	Text   string
 	Ranges []MatchRange
+	// Offset is the byte offset of the line within its file, set only with -b.
+	Offset int64
+	// Count is the matching line count of a KindFileCount result, or its
+	// match count with -count-matches.
+	Count int
+	Meta  *FileMeta
+	// Before and After hold -B/-A context lines not already attached to a
+	// neighbouring match in the same group.
+	Before []ContextLine
+	After  []ContextLine
+	// Group holds the matches of a KindGroup result.
+	Group []Result
+	// SkipReason explains why a KindGroup file was not searched, or not to
+	// the end; it is set only with -file-events.
+	SkipReason string
+	// ErrorCategory classifies a KindDiagnostic that reports a per-file error.
+	ErrorCategory string
+	// Seq is the file's FileJob.Seq in ordered mode, and 0 otherwise. It is
+	// set on the last result sent for a file, and on the KindMatch results a
+	// streamed FileUnit sends before it. On a KindDiagnostic it is the Seq of
+	// the file whose results the diagnostic is printed before.
+	Seq int64
+	// Stats is set on the last result sent for a scanned file with
+	// -file-stats.
+	Stats *FileStats
+	// Outcome is set on the last result sent for a file when its outcome is
+	// tracked; see config.Config.TracksOutcomes.
+	Outcome FileOutcome
+}
+
+// MatchCount is how many matches result counts for with -count-matches:
+// one per range, and one for a line with none, as -v prints.
+func (result Result) MatchCount() int {
+	return max(len(result.Ranges), 1)
 }
 
+// Reasons a file was not searched, reported by -file-events. SkipSize is
+// not: files over -max-size are filtered like those the walk skips.
+const (
+	SkipBinary    = "binary"
+	SkipEncoding  = "encoding"
+	SkipReadError = "read_error"
+	SkipSize      = "size"
+)
+
 // MatchRange represents the start and end position of a match within a line.
 type MatchRange struct {
 	Start int
 	End   int
+	// Pattern is the index of the -e pattern that matched; always 0 with a
+	// single pattern.
+	Pattern int
+	// Captures holds what each group of a -regex pattern matched, in group
+	// number order from group 1, when the strategy records them; see
+	// RegexEngine. It is a pointer so that MatchRange stays comparable.
+	Captures *[]Capture
+}
+
+// Capture is the byte range of the line a group matched, with Start and End
+// -1 when the group took no part in the match. Name is "" for a group
+// without one.
+type Capture struct {
+	Name  string
+	Start int
+	End   int
 }
 
 // MatchStrategy defines the interface for pattern matching strategies.
@@ -29,31 +126,63 @@ type MatchStrategy interface {
 type Matcher struct {
 	pattern     string
 	patternFold string
+	// asciiFold searches ASCII lines for an ASCII patternFold; see
+	// asciiFoldSearcher.
+	asciiFold   *asciiFoldSearcher
 	ignoreCase  bool
 	wholeWord   bool
+	overlapping bool
 }
 
 // RegexStrategy implements regex-based matching.
 type RegexStrategy struct {
 	expression *regexp.Regexp
+	// With -w, words finds the pattern after a non-word rune and before a
+	// non-word rune or the end of the line, and lineStartWord finds it at the
+	// start of the line; see findWords.
+	words         *regexp.Regexp
+	lineStartWord *regexp.Regexp
+	// captures records the groups of each match; see withCaptures.
+	captures bool
 }
 
 // NewMatcher creates a new substring matcher.
 func NewMatcher(pattern string, ignoreCase bool, wholeWord bool) Matcher {
 	matcher := Matcher{pattern: pattern, ignoreCase: ignoreCase, wholeWord: wholeWord}
 	if ignoreCase {
-		matcher.patternFold = strings.ToLower(pattern)
+		matcher.patternFold = foldString(pattern)
+		matcher.asciiFold = newASCIIFoldSearcher(matcher.patternFold)
 	}
 	return matcher
 }
 
-// FindRanges finds all substring matches in a line.
+// NewOverlappingMatcher creates a substring matcher for -overlapping, which
+// reports a match at every starting position instead of resuming after
+// each one.
+func NewOverlappingMatcher(pattern string, ignoreCase bool, wholeWord bool) Matcher {
+	matcher := NewMatcher(pattern, ignoreCase, wholeWord)
+	matcher.overlapping = true
+	return matcher
+}
+
+// FindRanges finds all substring matches in a line: leftmost first and,
+// like RegexStrategy, non-overlapping unless the matcher is overlapping.
+// Ignoring case, it searches the line's case folding; see foldLine. Case
+// is folded as the search goes when line and pattern are both ASCII, and
+// otherwise strings.Index, which already picks a vectorized or
+// Rabin-Karp search by the needle's length, does the scanning.
 func (matcher Matcher) FindRanges(line string) []MatchRange {
 	needle := matcher.pattern
 	haystack := line
+	var bounds []int
+	var ascii *asciiFoldSearcher
 	if matcher.ignoreCase {
 		needle = matcher.patternFold
-		haystack = strings.ToLower(line)
+		if matcher.asciiFold != nil && isASCII(line) {
+			ascii = matcher.asciiFold
+		} else {
+			haystack, bounds = foldLine(line)
+		}
 	}
 
 	if needle == "" {
@@ -63,17 +192,25 @@ func (matcher Matcher) FindRanges(line string) []MatchRange {
 	ranges := make([]MatchRange, 0)
 	searchFrom := 0
 	for {
-		index := strings.Index(haystack[searchFrom:], needle)
+		var index int
+		if ascii != nil {
+			index = ascii.index(haystack[searchFrom:])
+		} else {
+			index = strings.Index(haystack[searchFrom:], needle)
+		}
 		if index < 0 {
 			break
 		}
 
 		start := searchFrom + index
 		end := start + len(needle)
-		if !matcher.wholeWord || isWholeWordMatch(line, start, end) {
-			ranges = append(ranges, MatchRange{Start: start, End: end})
-			searchFrom = end
-			continue
+		lineStart, lineEnd, whole := foldedRange(bounds, start, end)
+		if whole && (!matcher.wholeWord || isWholeWordMatch(line, lineStart, lineEnd)) {
+			ranges = append(ranges, MatchRange{Start: lineStart, End: lineEnd})
+			if !matcher.overlapping {
+				searchFrom = end
+				continue
+			}
 		}
 		searchFrom = start + 1
 	}
@@ -84,9 +221,6 @@ func (matcher Matcher) FindRanges(line string) []MatchRange {
 // NewRegexStrategy creates a new regex-based strategy.
 func NewRegexStrategy(pattern string, ignoreCase bool, wholeWord bool) (RegexStrategy, error) {
 	p := pattern
-	if wholeWord {
-		p = "\\b(?:" + p + ")\\b"
-	}
 	if ignoreCase {
 		p = "(?i)" + p
 	}
@@ -95,39 +229,372 @@ func NewRegexStrategy(pattern string, ignoreCase bool, wholeWord bool) (RegexStr
 	if err != nil {
 		return RegexStrategy{}, err
 	}
-	return RegexStrategy{expression: re}, nil
+	strategy := RegexStrategy{expression: re}
+	if wholeWord {
+		// Go's \b only knows ASCII word characters, so the boundaries are
+		// spelled out as the runes isWordRune rejects. The pattern compiled
+		// on its own above, so it cannot close the group around it.
+		const nonWord = `(?:[^\pL\pM\p{Nd}_]|$)`
+		strategy.words = regexp.MustCompile(`[^\pL\pM\p{Nd}_](` + p + `)` + nonWord)
+		strategy.lineStartWord = regexp.MustCompile(`^(` + p + `)` + nonWord)
+	}
+	return strategy, nil
+}
+
+// withCaptures returns strategy recording in MatchRange.Captures what the
+// pattern's groups matched, if it has any.
+func (strategy RegexStrategy) withCaptures() RegexStrategy {
+	strategy.captures = strategy.expression.NumSubexp() > 0
+	return strategy
 }
 
 // FindRanges finds all regex matches in a line.
 func (strategy RegexStrategy) FindRanges(line string) []MatchRange {
-	indices := strategy.expression.FindAllStringIndex(line, -1)
+	if strategy.words != nil {
+		return strategy.findWords(line)
+	}
+	var indices [][]int
+	if strategy.captures {
+		indices = strategy.expression.FindAllStringSubmatchIndex(line, -1)
+	} else {
+		indices = strategy.expression.FindAllStringIndex(line, -1)
+	}
 	if len(indices) == 0 {
 		return nil
 	}
 	ranges := make([]MatchRange, 0, len(indices))
 	for _, match := range indices {
-		ranges = append(ranges, MatchRange{Start: match[0], End: match[1]})
+		found := MatchRange{Start: match[0], End: match[1]}
+		if strategy.captures {
+			found.Captures = groupCaptures(strategy.expression.SubexpNames(), match, 1, 0)
+		}
+		ranges = append(ranges, found)
 	}
 	return ranges
 }
 
+// groupCaptures returns the groups of a submatch index slice from group
+// first on, which is the pattern's group 1, moved by from.
+func groupCaptures(names []string, match []int, first int, from int) *[]Capture {
+	captures := make([]Capture, 0, len(names)-first)
+	for group := first; group < len(names); group++ {
+		capture := Capture{Name: names[group], Start: -1, End: -1}
+		if match[2*group] >= 0 {
+			capture.Start, capture.End = from+match[2*group], from+match[2*group+1]
+		}
+		captures = append(captures, capture)
+	}
+	return &captures
+}
+
+// findWords finds the -w matches in line: leftmost, non-overlapping, and
+// non-empty, each with a non-word rune or the line's edge on either side.
+// The boundary runes are part of what words matches, so each search starts
+// at the rune before where the last match ended, letting that rune be the
+// next match's left boundary. As with \b, an alternative of the pattern
+// that is no whole word gives way to one that is.
+func (strategy RegexStrategy) findWords(line string) []MatchRange {
+	var ranges []MatchRange
+	pos := 0
+	for pos < len(line) {
+		var match []int
+		from := 0
+		if pos == 0 {
+			match = strategy.lineStartWord.FindStringSubmatchIndex(line)
+		}
+		if match == nil || match[2] == match[3] {
+			if pos > 0 {
+				_, size := utf8.DecodeLastRuneInString(line[:pos])
+				from = pos - size
+			}
+			match = strategy.words.FindStringSubmatchIndex(line[from:])
+			if match == nil {
+				break
+			}
+		}
+		start, end := from+match[2], from+match[3]
+		if start == end {
+			// An empty match is no word; look again past it.
+			_, size := utf8.DecodeRuneInString(line[start:])
+			pos = start + size
+			continue
+		}
+		found := MatchRange{Start: start, End: end}
+		if strategy.captures {
+			// Both word expressions wrap the pattern in group 1, so its
+			// own groups start at 2.
+			found.Captures = groupCaptures(strategy.words.SubexpNames(), match, 2, from)
+		}
+		ranges = append(ranges, found)
+		pos = end
+	}
+	return ranges
+}
+
+// isWholeWordMatch reports whether line[start:end] has no word rune
+// directly before or after it.
 func isWholeWordMatch(line string, start int, end int) bool {
-	leftBoundary := start == 0 || !isWordByte(line[start-1])
-	rightBoundary := end == len(line) || !isWordByte(line[end])
+	leftBoundary := start == 0
+	if !leftBoundary {
+		r, _ := utf8.DecodeLastRuneInString(line[:start])
+		leftBoundary = !isWordRune(r)
+	}
+	rightBoundary := end == len(line)
+	if !rightBoundary {
+		r, _ := utf8.DecodeRuneInString(line[end:])
+		rightBoundary = !isWordRune(r)
+	}
 	return leftBoundary && rightBoundary
 }
 
-func isWordByte(value byte) bool {
-	return (value >= 'a' && value <= 'z') ||
-		(value >= 'A' && value <= 'Z') ||
-		(value >= '0' && value <= '9') ||
-		value == '_'
+// isWordRune reports whether r is part of a word for -w: a letter, a
+// combining mark, a decimal digit, or an underscore. Bytes that are not
+// valid UTF-8 decode to utf8.RuneError, which is not.
+func isWordRune(r rune) bool {
+	if r < utf8.RuneSelf {
+		return (r >= 'a' && r <= 'z') ||
+			(r >= 'A' && r <= 'Z') ||
+			(r >= '0' && r <= '9') ||
+			r == '_'
+	}
+	return unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r)
+}
+
+// FilteredStrategy keeps only the ranges of an inner strategy whose matched
+// text also satisfies a second regex, as set by -match-filter.
+type FilteredStrategy struct {
+	inner  MatchStrategy
+	filter *regexp.Regexp
+}
+
+// NewFilteredStrategy wraps inner so that ranges failing filter are dropped.
+func NewFilteredStrategy(inner MatchStrategy, filter *regexp.Regexp) FilteredStrategy {
+	return FilteredStrategy{inner: inner, filter: filter}
+}
+
+// FindRanges returns the inner strategy's ranges whose text matches the filter.
+func (strategy FilteredStrategy) FindRanges(line string) []MatchRange {
+	ranges, _ := strategy.findRangesErr(line)
+	return ranges
+}
+
+// findRangesErr is FindRanges with the inner strategy's error.
+func (strategy FilteredStrategy) findRangesErr(line string) ([]MatchRange, error) {
+	ranges, err := findRanges(strategy.inner, line)
+	kept := ranges[:0]
+	for _, match := range ranges {
+		if strategy.filter.MatchString(line[match.Start:match.End]) {
+			kept = append(kept, match)
+		}
+	}
+	if len(kept) == 0 {
+		return nil, err
+	}
+	return kept, err
+}
+
+// ExcludingStrategy drops the lines of an inner strategy that a second
+// strategy also matches, as set by -not. The ranges kept are the inner
+// strategy's alone.
+type ExcludingStrategy struct {
+	inner   MatchStrategy
+	exclude MatchStrategy
+}
+
+// NewExcludingStrategy wraps inner so that lines exclude matches have no
+// ranges.
+func NewExcludingStrategy(inner MatchStrategy, exclude MatchStrategy) ExcludingStrategy {
+	return ExcludingStrategy{inner: inner, exclude: exclude}
+}
+
+// FindRanges returns the inner strategy's ranges unless exclude matches line.
+func (strategy ExcludingStrategy) FindRanges(line string) []MatchRange {
+	ranges, _ := strategy.findRangesErr(line)
+	return ranges
+}
+
+// findRangesErr is FindRanges with either strategy's error. exclude only
+// runs on lines inner matched; a line it fails on is not reported.
+func (strategy ExcludingStrategy) findRangesErr(line string) ([]MatchRange, error) {
+	ranges, err := findRanges(strategy.inner, line)
+	if len(ranges) == 0 {
+		return nil, err
+	}
+	excluded, excludeErr := findRanges(strategy.exclude, line)
+	if excludeErr != nil {
+		return nil, excludeErr
+	}
+	if len(excluded) > 0 {
+		return nil, err
+	}
+	return ranges, err
+}
+
+// EntropyStrategy keeps only the ranges of an inner strategy whose matched
+// text has at least a minimum Shannon entropy, as set by -min-entropy.
+type EntropyStrategy struct {
+	inner   MatchStrategy
+	minBits float64
+}
+
+// NewEntropyStrategy wraps inner so that ranges below minBits per character are dropped.
+func NewEntropyStrategy(inner MatchStrategy, minBits float64) EntropyStrategy {
+	return EntropyStrategy{inner: inner, minBits: minBits}
+}
+
+// FindRanges returns the inner strategy's ranges that meet the entropy threshold.
+func (strategy EntropyStrategy) FindRanges(line string) []MatchRange {
+	ranges, _ := strategy.findRangesErr(line)
+	return ranges
+}
+
+// findRangesErr is FindRanges with the inner strategy's error.
+func (strategy EntropyStrategy) findRangesErr(line string) ([]MatchRange, error) {
+	ranges, err := findRanges(strategy.inner, line)
+	kept := ranges[:0]
+	for _, match := range ranges {
+		if ShannonEntropy(line[match.Start:match.End]) >= strategy.minBits {
+			kept = append(kept, match)
+		}
+	}
+	if len(kept) == 0 {
+		return nil, err
+	}
+	return kept, err
+}
+
+// ShannonEntropy returns the Shannon entropy of text in bits per character.
+func ShannonEntropy(text string) float64 {
+	counts := make(map[rune]int)
+	total := 0
+	for _, char := range text {
+		counts[char]++
+		total++
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		probability := float64(count) / float64(total)
+		entropy -= probability * math.Log2(probability)
+	}
+	return entropy
 }
 
 // BuildStrategy creates the appropriate match strategy based on config.
-func BuildStrategy(pattern string, useRegex bool, ignoreCase bool, wholeWord bool) (MatchStrategy, error) {
+func BuildStrategy(pattern string, useRegex bool, engine RegexEngine, ignoreCase bool, wholeWord bool) (MatchStrategy, error) {
 	if !useRegex {
 		return NewMatcher(pattern, ignoreCase, wholeWord), nil
 	}
-	return NewRegexStrategy(pattern, ignoreCase, wholeWord)
+	if engine.PCRE {
+		strategy, err := NewPCREStrategy(pattern, ignoreCase, wholeWord, engine.Timeout)
+		if err != nil || !engine.Captures {
+			return strategy, err
+		}
+		return strategy.withCaptures(), nil
+	}
+	strategy, err := NewRegexStrategy(pattern, ignoreCase, wholeWord)
+	if err != nil || !engine.Captures {
+		return strategy, err
+	}
+	return strategy.withCaptures(), nil
+}
+
+// BuildStrategies creates the strategy for the -e patterns: a line matches
+// when any of them does, or with matchAll when every one does. Several
+// literals share one Aho-Corasick automaton.
+func BuildStrategies(patterns []string, useRegex bool, engine RegexEngine, ignoreCase bool, wholeWord bool, matchAll bool) (MatchStrategy, error) {
+	if len(patterns) == 1 {
+		return BuildStrategy(patterns[0], useRegex, engine, ignoreCase, wholeWord)
+	}
+	if !useRegex {
+		return NewAhoCorasick(patterns, ignoreCase, wholeWord, matchAll), nil
+	}
+	strategies := make([]MatchStrategy, 0, len(patterns))
+	for _, pattern := range patterns {
+		strategy, err := BuildStrategy(pattern, useRegex, engine, ignoreCase, wholeWord)
+		if err != nil {
+			return nil, err
+		}
+		strategies = append(strategies, strategy)
+	}
+	if matchAll {
+		return NewAllOfStrategy(strategies), nil
+	}
+	return NewMultiStrategy(strategies), nil
+}
+
+// MultiStrategy matches a line against several strategies, one per -e
+// pattern. Their ranges are merged in order and overlapping ones coalesced,
+// so highlights never nest; a coalesced range keeps the pattern of the one
+// that starts first.
+type MultiStrategy struct {
+	strategies []MatchStrategy
+	// all requires a range from every strategy, for -match-all.
+	all bool
+}
+
+// NewMultiStrategy combines strategies so that a line matches when any does.
+func NewMultiStrategy(strategies []MatchStrategy) MultiStrategy {
+	return MultiStrategy{strategies: strategies}
+}
+
+// NewAllOfStrategy combines strategies so that a line matches only when
+// every one does.
+func NewAllOfStrategy(strategies []MatchStrategy) MultiStrategy {
+	return MultiStrategy{strategies: strategies, all: true}
+}
+
+// FindRanges returns the union of every strategy's ranges, ordered by start.
+// When every strategy must match, the first that does not ends the search
+// without trying the rest.
+func (strategy MultiStrategy) FindRanges(line string) []MatchRange {
+	ranges, _ := strategy.findRangesErr(line)
+	return ranges
+}
+
+// findRangesErr is FindRanges with the first error of a strategy that
+// failed on line, which counts as finding nothing.
+func (strategy MultiStrategy) findRangesErr(line string) ([]MatchRange, error) {
+	var ranges []MatchRange
+	var firstErr error
+	for index, inner := range strategy.strategies {
+		found, err := findRanges(inner, line)
+		if firstErr == nil {
+			firstErr = err
+		}
+		if strategy.all && len(found) == 0 {
+			return nil, firstErr
+		}
+		for _, match := range found {
+			match.Pattern = index
+			ranges = append(ranges, match)
+		}
+	}
+	return mergeRanges(ranges), firstErr
+}
+
+// mergeRanges orders the ranges of several patterns by start, longest and
+// then lowest pattern first, and coalesces overlapping ones.
+func mergeRanges(ranges []MatchRange) []MatchRange {
+	if len(ranges) == 0 {
+		return nil
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		if ranges[i].Start != ranges[j].Start {
+			return ranges[i].Start < ranges[j].Start
+		}
+		if ranges[i].End != ranges[j].End {
+			return ranges[i].End > ranges[j].End
+		}
+		return ranges[i].Pattern < ranges[j].Pattern
+	})
+	merged := ranges[:1]
+	for _, match := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if match.Start < last.End || match == *last {
+			last.End = max(last.End, match.End)
+			continue
+		}
+		merged = append(merged, match)
+	}
+	return merged
 }
@@ -0,0 +1,141 @@
+package search
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// MemSampleInterval is how often memory is sampled between phase
+// boundaries. runtime.ReadMemStats briefly stops the world, so a few samples
+// a second keep its cost negligible.
+const MemSampleInterval = 250 * time.Millisecond
+
+// MemSample is one reading of the runtime's memory statistics.
+type MemSample struct {
+	HeapAlloc uint64
+	Sys       uint64
+	NumGC     uint32
+}
+
+// ReadMemSample reads the current memory statistics.
+func ReadMemSample() MemSample {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return MemSample{HeapAlloc: stats.HeapAlloc, Sys: stats.Sys, NumGC: stats.NumGC}
+}
+
+// MemoryPeak is the peak heap and memory obtained from the OS over a span of
+// the run, and the number of garbage collections during it.
+type MemoryPeak struct {
+	HeapAlloc uint64
+	Sys       uint64
+	NumGC     uint32
+}
+
+// PhaseMemory is the memory counterpart of PhaseTimings.
+type PhaseMemory struct {
+	Walk  MemoryPeak
+	Scan  MemoryPeak
+	Print MemoryPeak
+	Total MemoryPeak
+}
+
+// Memory phases, entered in this order.
+const (
+	PhaseWalk = iota
+	PhaseScan
+	PhasePrint
+)
+
+// MemoryTracker aggregates memory samples into per-phase peaks. Samples
+// arrive from the phase boundaries and from a ticker, so it is safe for
+// concurrent use.
+type MemoryTracker struct {
+	mu      sync.Mutex
+	read    func() MemSample
+	phase   *MemoryPeak
+	phaseGC uint32
+	firstGC uint32
+	started bool
+	memory  PhaseMemory
+}
+
+// NewMemoryTracker returns a tracker that takes samples with read, normally
+// ReadMemSample.
+func NewMemoryTracker(read func() MemSample) *MemoryTracker {
+	return &MemoryTracker{read: read}
+}
+
+// Enter takes a sample that ends the current phase and starts phase. Like
+// every method, it does nothing on a nil tracker, so memory tracking can be
+// left off.
+func (tracker *MemoryTracker) Enter(phase int) {
+	if tracker == nil {
+		return
+	}
+	sample := tracker.read()
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	tracker.record(sample)
+	switch phase {
+	case PhaseWalk:
+		tracker.phase = &tracker.memory.Walk
+	case PhaseScan:
+		tracker.phase = &tracker.memory.Scan
+	case PhasePrint:
+		tracker.phase = &tracker.memory.Print
+	}
+	tracker.phaseGC = sample.NumGC
+	tracker.record(sample)
+}
+
+// Sample takes a sample within the current phase.
+func (tracker *MemoryTracker) Sample() {
+	if tracker == nil {
+		return
+	}
+	tracker.Record(tracker.read())
+}
+
+// Record adds a sample taken within the current phase.
+func (tracker *MemoryTracker) Record(sample MemSample) {
+	if tracker == nil {
+		return
+	}
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	tracker.record(sample)
+}
+
+// Finish takes a sample that ends the last phase and returns the peaks.
+func (tracker *MemoryTracker) Finish() PhaseMemory {
+	if tracker == nil {
+		return PhaseMemory{}
+	}
+	sample := tracker.read()
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	tracker.record(sample)
+	tracker.phase = nil
+	return tracker.memory
+}
+
+func (tracker *MemoryTracker) record(sample MemSample) {
+	if !tracker.started {
+		tracker.started = true
+		tracker.firstGC = sample.NumGC
+	}
+	raisePeak(&tracker.memory.Total, sample, tracker.firstGC)
+	if tracker.phase != nil {
+		raisePeak(tracker.phase, sample, tracker.phaseGC)
+	}
+}
+
+// raisePeak folds sample into peak; the GC count is collections since
+// startGC.
+func raisePeak(peak *MemoryPeak, sample MemSample, startGC uint32) {
+	peak.HeapAlloc = max(peak.HeapAlloc, sample.HeapAlloc)
+	peak.Sys = max(peak.Sys, sample.Sys)
+	peak.NumGC = max(peak.NumGC, sample.NumGC-startGC)
+}
@@ -2,41 +2,228 @@
 package search
 
 import (
+	"os"
 	"sync/atomic"
 	"time"
 )
 
+// FileJob is a file discovered by the walk and queued for IO workers.
+type FileJob struct {
+	Path string
+	// Info is the walk's stat result, or nil when the walk did not need one.
+	Info os.FileInfo
+	// Seq numbers files from 1 in the order the walk enqueued them, for
+	// ordered output.
+	Seq int64
+}
+
+// FileMeta is per-file metadata attached to results with -with-metadata.
+// One value is shared by every line of a file.
+type FileMeta struct {
+	Size    int64
+	ModTime time.Time
+	Mode    os.FileMode
+}
+
 // LineItem represents a line to be processed by CPU workers.
 type LineItem struct {
 	Path string
 	Line int
 	Text string
+	// Offset is the line's byte offset in the file, set only with -b.
+	Offset int64
+	Meta   *FileMeta
+	// Unit is set when context lines are requested. The reader's final item
+	// for a file has EndOfFile set and carries no line.
+	Unit      *FileUnit
+	EndOfFile bool
+	// Raw marks a -hex-pattern chunk of file bytes rather than a line;
+	// Offset is then the chunk's position in the file.
+	Raw bool
+}
+
+// seq is the FileJob.Seq of the item's file in ordered mode, and 0 otherwise.
+func (item LineItem) seq() int64 {
+	if item.Unit == nil {
+		return 0
+	}
+	return item.Unit.seq
 }
 
 // Metrics tracks worker lifecycle and throughput metrics.
 type Metrics struct {
-	IOWorkersStarted  atomic.Int64
-	IOWorkersStopped  atomic.Int64
-	CPUWorkersStarted atomic.Int64
-	CPUWorkersStopped atomic.Int64
-	IOActiveWorkers   atomic.Int64
-	CPUActiveWorkers  atomic.Int64
-	IOMaxActive       atomic.Int64
-	CPUMaxActive      atomic.Int64
-	FilesEnqueued     atomic.Int64
-	FilesScanned      atomic.Int64
-	LinesEnqueued     atomic.Int64
-	LinesProcessed    atomic.Int64
-	MatchesProduced   atomic.Int64
-	ScaleUps          atomic.Int64
+	IOWorkersStarted         atomic.Int64
+	IOWorkersStopped         atomic.Int64
+	CPUWorkersStarted        atomic.Int64
+	CPUWorkersStopped        atomic.Int64
+	IOActiveWorkers          atomic.Int64
+	CPUActiveWorkers         atomic.Int64
+	IOMaxActive              atomic.Int64
+	CPUMaxActive             atomic.Int64
+	FilesEnqueued            atomic.Int64
+	FilesScanned             atomic.Int64
+	FilesSkippedGenerated    atomic.Int64
+	FilesSkippedExportIgnore atomic.Int64
+	FilesSkippedEncoding     atomic.Int64
+	FilesSkippedIgnore       atomic.Int64
+	FilesSkippedSize         atomic.Int64
+	FilesSkippedExtension    atomic.Int64
+	FilesTranscoded          atomic.Int64
+	BytesRead                atomic.Int64
+	LinesEnqueued            atomic.Int64
+	LinesProcessed           atomic.Int64
+	MatchesProduced          atomic.Int64
+	ScaleUps                 atomic.Int64
+	DecompressWorkersStarted atomic.Int64
+	DecompressWorkersStopped atomic.Int64
+	DecompressActiveWorkers  atomic.Int64
+	DecompressMaxActive      atomic.Int64
+	DecompressScaleUps       atomic.Int64
+	FilesDecompressed        atomic.Int64
+	DecompressErrors         DecompressErrorCounts
+	DirsEntered              atomic.Int64
+	DirsPrunedIgnore         atomic.Int64
+	DirsPrunedDefault        atomic.Int64
+	DirsPrunedDepth          atomic.Int64
+	DirsPrunedMarker         atomic.Int64
+	DirReadErrors            atomic.Int64
+	MaxDepth                 atomic.Int64
+	IgnoreCacheHits          atomic.Int64
+	IgnoreCacheMisses        atomic.Int64
+	FileErrors               FileErrorCounts
+	Symlinks                 SymlinkCounts
+	// EmptyRun collects samples for -why-empty; nil otherwise.
+	EmptyRun *EmptyRunProbe
+	// Order holds back readers that get too far ahead of the printer in
+	// ordered mode; nil otherwise.
+	Order *OrderWindow
+}
+
+// MetricsSnapshot is a point-in-time copy of Metrics for serialization.
+type MetricsSnapshot struct {
+	IOWorkersStarted         int64 `json:"io_workers_started"`
+	IOWorkersStopped         int64 `json:"io_workers_stopped"`
+	CPUWorkersStarted        int64 `json:"cpu_workers_started"`
+	CPUWorkersStopped        int64 `json:"cpu_workers_stopped"`
+	IOMaxActive              int64 `json:"io_max_active"`
+	CPUMaxActive             int64 `json:"cpu_max_active"`
+	FilesEnqueued            int64 `json:"files_enqueued"`
+	FilesScanned             int64 `json:"files_scanned"`
+	FilesSkippedGenerated    int64 `json:"files_skipped_generated"`
+	FilesSkippedExportIgnore int64 `json:"files_skipped_export_ignore"`
+	FilesSkippedEncoding     int64 `json:"files_skipped_encoding"`
+	FilesSkippedIgnore       int64 `json:"files_skipped_ignore"`
+	FilesSkippedSize         int64 `json:"files_skipped_size"`
+	FilesSkippedExtension    int64 `json:"files_skipped_extension"`
+	FilesTranscoded          int64 `json:"files_transcoded"`
+	BytesRead                int64 `json:"bytes_read"`
+	LinesEnqueued            int64 `json:"lines_enqueued"`
+	LinesProcessed           int64 `json:"lines_processed"`
+	MatchesProduced          int64 `json:"matches_produced"`
+	ScaleUps                 int64 `json:"scale_ups"`
+	DecompressWorkersStarted int64 `json:"decompress_workers_started"`
+	DecompressWorkersStopped int64 `json:"decompress_workers_stopped"`
+	DecompressMaxActive      int64 `json:"decompress_max_active"`
+	DecompressScaleUps       int64 `json:"decompress_scale_ups"`
+	FilesDecompressed        int64 `json:"files_decompressed"`
+	DecompressErrorsGzip     int64 `json:"decompress_errors_gzip"`
+	DecompressErrorsZstd     int64 `json:"decompress_errors_zstd"`
+	DecompressErrorsXz       int64 `json:"decompress_errors_xz"`
+	DirsEntered              int64 `json:"dirs_entered"`
+	DirsPrunedIgnore         int64 `json:"dirs_pruned_ignore"`
+	DirsPrunedDefault        int64 `json:"dirs_pruned_default"`
+	DirsPrunedDepth          int64 `json:"dirs_pruned_depth"`
+	DirsPrunedMarker         int64 `json:"dirs_pruned_marker"`
+	DirReadErrors            int64 `json:"dir_read_errors"`
+	MaxDepth                 int64 `json:"max_depth"`
+	IgnoreCacheHits          int64 `json:"ignore_cache_hits"`
+	IgnoreCacheMisses        int64 `json:"ignore_cache_misses"`
+	ErrorsPermission         int64 `json:"errors_permission"`
+	ErrorsNotFound           int64 `json:"errors_not_found"`
+	ErrorsIO                 int64 `json:"errors_io"`
+	ErrorsTooLarge           int64 `json:"errors_too_large"`
+	ErrorsBinary             int64 `json:"errors_binary"`
+	ErrorsEncoding           int64 `json:"errors_encoding"`
+	ErrorsTimeout            int64 `json:"errors_timeout"`
+	SymlinksNotFollowed      int64 `json:"symlinks_not_followed"`
+	SymlinksIgnored          int64 `json:"symlinks_ignored"`
+	SymlinksFollowedFile     int64 `json:"symlinks_followed_file"`
+	SymlinksFollowedDir      int64 `json:"symlinks_followed_dir"`
+	SymlinksLoop             int64 `json:"symlinks_loop_skipped"`
+	SymlinksDangling         int64 `json:"symlinks_dangling"`
+	SymlinksError            int64 `json:"symlinks_error"`
+	SymlinksReparseSkipped   int64 `json:"symlinks_reparse_skipped"`
+	SymlinksOutsideRoot      int64 `json:"symlinks_outside_root"`
+}
+
+// Snapshot copies the current counter values.
+func (metrics *Metrics) Snapshot() MetricsSnapshot {
+	return MetricsSnapshot{
+		IOWorkersStarted:         metrics.IOWorkersStarted.Load(),
+		IOWorkersStopped:         metrics.IOWorkersStopped.Load(),
+		CPUWorkersStarted:        metrics.CPUWorkersStarted.Load(),
+		CPUWorkersStopped:        metrics.CPUWorkersStopped.Load(),
+		IOMaxActive:              metrics.IOMaxActive.Load(),
+		CPUMaxActive:             metrics.CPUMaxActive.Load(),
+		FilesEnqueued:            metrics.FilesEnqueued.Load(),
+		FilesScanned:             metrics.FilesScanned.Load(),
+		FilesSkippedGenerated:    metrics.FilesSkippedGenerated.Load(),
+		FilesSkippedExportIgnore: metrics.FilesSkippedExportIgnore.Load(),
+		FilesSkippedEncoding:     metrics.FilesSkippedEncoding.Load(),
+		FilesSkippedIgnore:       metrics.FilesSkippedIgnore.Load(),
+		FilesSkippedSize:         metrics.FilesSkippedSize.Load(),
+		FilesSkippedExtension:    metrics.FilesSkippedExtension.Load(),
+		FilesTranscoded:          metrics.FilesTranscoded.Load(),
+		BytesRead:                metrics.BytesRead.Load(),
+		LinesEnqueued:            metrics.LinesEnqueued.Load(),
+		LinesProcessed:           metrics.LinesProcessed.Load(),
+		MatchesProduced:          metrics.MatchesProduced.Load(),
+		ScaleUps:                 metrics.ScaleUps.Load(),
+		DecompressWorkersStarted: metrics.DecompressWorkersStarted.Load(),
+		DecompressWorkersStopped: metrics.DecompressWorkersStopped.Load(),
+		DecompressMaxActive:      metrics.DecompressMaxActive.Load(),
+		DecompressScaleUps:       metrics.DecompressScaleUps.Load(),
+		FilesDecompressed:        metrics.FilesDecompressed.Load(),
+		DecompressErrorsGzip:     metrics.DecompressErrors.Count(FormatGzip),
+		DecompressErrorsZstd:     metrics.DecompressErrors.Count(FormatZstd),
+		DecompressErrorsXz:       metrics.DecompressErrors.Count(FormatXz),
+		DirsEntered:              metrics.DirsEntered.Load(),
+		DirsPrunedIgnore:         metrics.DirsPrunedIgnore.Load(),
+		DirsPrunedDefault:        metrics.DirsPrunedDefault.Load(),
+		DirsPrunedDepth:          metrics.DirsPrunedDepth.Load(),
+		DirsPrunedMarker:         metrics.DirsPrunedMarker.Load(),
+		DirReadErrors:            metrics.DirReadErrors.Load(),
+		MaxDepth:                 metrics.MaxDepth.Load(),
+		IgnoreCacheHits:          metrics.IgnoreCacheHits.Load(),
+		IgnoreCacheMisses:        metrics.IgnoreCacheMisses.Load(),
+		ErrorsPermission:         metrics.FileErrors.Count(ErrorPermission),
+		ErrorsNotFound:           metrics.FileErrors.Count(ErrorNotFound),
+		ErrorsIO:                 metrics.FileErrors.Count(ErrorIO),
+		ErrorsTooLarge:           metrics.FileErrors.Count(ErrorTooLarge),
+		ErrorsBinary:             metrics.FileErrors.Count(ErrorBinary),
+		ErrorsEncoding:           metrics.FileErrors.Count(ErrorEncoding),
+		ErrorsTimeout:            metrics.FileErrors.Count(ErrorTimeout),
+		SymlinksNotFollowed:      metrics.Symlinks.Count(SymlinkNotFollowed),
+		SymlinksIgnored:          metrics.Symlinks.Count(SymlinkIgnored),
+		SymlinksFollowedFile:     metrics.Symlinks.Count(SymlinkFollowedFile),
+		SymlinksFollowedDir:      metrics.Symlinks.Count(SymlinkFollowedDir),
+		SymlinksLoop:             metrics.Symlinks.Count(SymlinkLoop),
+		SymlinksDangling:         metrics.Symlinks.Count(SymlinkDangling),
+		SymlinksError:            metrics.Symlinks.Count(SymlinkError),
+		SymlinksReparseSkipped:   metrics.Symlinks.Count(SymlinkReparseSkipped),
+		SymlinksOutsideRoot:      metrics.Symlinks.OutsideRoot(),
+	}
 }
 
 // PhaseTimings tracks timing for each phase of the search.
 type PhaseTimings struct {
-	Walk  time.Duration
-	Scan  time.Duration
-	Print time.Duration
-	Total time.Duration
+	// PreCount is the -progress=full or estimate pre-count, before the
+	// walk; 0 without one.
+	PreCount time.Duration
+	Walk     time.Duration
+	Scan     time.Duration
+	Print    time.Duration
+	Total    time.Duration
 }
 
 // UpdateMaxActive atomically updates the max active counter.
@@ -0,0 +1,79 @@
+package search
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// OrderWindowResults is how many results the printer holds, in ordered
+// mode, for files after the one it is printing before their readers wait.
+const OrderWindowResults = 4096
+
+// OrderWindow bounds how far ahead of the printer an ordered search reads.
+// The printer streams the file it is printing and holds the results of later
+// files until their turn, reporting how many it holds; readers of those later
+// files wait while that is at the limit. The reader of the file being
+// printed never waits, so the search always moves on.
+type OrderWindow struct {
+	limit int64
+	head  atomic.Int64
+	held  atomic.Int64
+
+	mu sync.Mutex
+	// changed is closed and replaced when waiting readers may go on.
+	changed chan struct{}
+}
+
+// NewOrderWindow returns a window that lets the printer hold limit results.
+func NewOrderWindow(limit int) *OrderWindow {
+	window := &OrderWindow{limit: int64(limit), changed: make(chan struct{})}
+	window.head.Store(1)
+	return window
+}
+
+// Wait blocks until the reader of file seq may queue another line: it is the
+// file being printed, or the printer holds fewer results than the limit. It
+// returns false if ctx was cancelled first. A nil window never waits.
+func (window *OrderWindow) Wait(ctx context.Context, seq int64) bool {
+	if window == nil {
+		return true
+	}
+	for !window.open(seq) {
+		window.mu.Lock()
+		changed := window.changed
+		window.mu.Unlock()
+		// An Update between the check and taking changed closes a channel
+		// this reader never sees, so check again before waiting on it.
+		if window.open(seq) {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-changed:
+		}
+	}
+	return true
+}
+
+func (window *OrderWindow) open(seq int64) bool {
+	return seq <= window.head.Load() || window.held.Load() < window.limit
+}
+
+// Update records the file the printer is on and how many results it holds,
+// waking waiting readers when either lets them go on.
+func (window *OrderWindow) Update(head int64, held int) {
+	if window == nil {
+		return
+	}
+	previousHead := window.head.Swap(head)
+	previousHeld := window.held.Swap(int64(held))
+	if head == previousHead && (int64(held) >= window.limit || previousHeld < window.limit) {
+		return
+	}
+	window.mu.Lock()
+	close(window.changed)
+	window.changed = make(chan struct{})
+	window.mu.Unlock()
+}
@@ -0,0 +1,66 @@
+package search
+
+// FileOutcome is what became of one file handed to IO workers. Aggregates
+// that count files (-L, -stats, baseline resolution, -file-events) use it so
+// a file that was skipped or could not be read is never mistaken for one
+// searched without a match.
+type FileOutcome int
+
+const (
+	// OutcomeUnknown is the zero value: the file's outcome was not tracked.
+	OutcomeUnknown FileOutcome = iota
+	// OutcomeMatched is a file searched to the end with at least one match.
+	OutcomeMatched
+	// OutcomeNoMatch is a file searched to the end without a match.
+	OutcomeNoMatch
+	// OutcomeSkippedBinary is a binary file that was not searched.
+	OutcomeSkippedBinary
+	// OutcomeSkippedSize is a file over -max-size.
+	OutcomeSkippedSize
+	// OutcomeSkippedIgnored is a file excluded by ignore rules or filters.
+	// The walk decides these, so they are only ever counted, never sent.
+	OutcomeSkippedIgnored
+	// OutcomeSkippedEncoding is a file skipped by -on-bad-encoding skip.
+	OutcomeSkippedEncoding
+	// OutcomeError is a file that could not be opened or read to the end.
+	OutcomeError
+)
+
+var outcomeNames = [...]string{
+	OutcomeUnknown:         "",
+	OutcomeMatched:         "matched",
+	OutcomeNoMatch:         "no_match",
+	OutcomeSkippedBinary:   "skipped_binary",
+	OutcomeSkippedSize:     "skipped_size",
+	OutcomeSkippedIgnored:  "skipped_ignored",
+	OutcomeSkippedEncoding: "skipped_encoding",
+	OutcomeError:           "error",
+}
+
+// String returns the outcome's name in JSON records, e.g. "no_match".
+func (outcome FileOutcome) String() string {
+	if outcome < 0 || int(outcome) >= len(outcomeNames) {
+		return ""
+	}
+	return outcomeNames[outcome]
+}
+
+// Searched reports whether the file was read to the end, so its lack of a
+// match means something.
+func (outcome FileOutcome) Searched() bool {
+	return outcome == OutcomeMatched || outcome == OutcomeNoMatch
+}
+
+// skipOutcome maps a skip reason to the outcome it records.
+func skipOutcome(reason string) FileOutcome {
+	switch reason {
+	case SkipBinary:
+		return OutcomeSkippedBinary
+	case SkipEncoding:
+		return OutcomeSkippedEncoding
+	case SkipSize:
+		return OutcomeSkippedSize
+	default:
+		return OutcomeError
+	}
+}
@@ -0,0 +1,183 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dlclark/regexp2"
+)
+
+// RegexEngine selects how -regex patterns are compiled.
+type RegexEngine struct {
+	// PCRE selects the backtracking engine of -engine pcre, which adds
+	// backreferences and lookarounds, over Go's regexp.
+	PCRE bool
+	// Timeout caps the time spent matching one line with PCRE.
+	Timeout time.Duration
+	// Captures records what groups matched, for JSON output and -replace.
+	Captures bool
+}
+
+// GroupNames returns the names of pattern's groups as engine numbers them,
+// from group 1, with "" for a group without one.
+func (engine RegexEngine) GroupNames(pattern string) ([]string, error) {
+	if !engine.PCRE {
+		expression, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return expression.SubexpNames()[1:], nil
+	}
+	expression, err := regexp2.Compile(pattern, regexp2.None)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for number := 1; number < len(expression.GetGroupNumbers()); number++ {
+		names = append(names, groupName(expression.GroupNameFromNumber(number)))
+	}
+	return names, nil
+}
+
+// errMatchTimeout is the error of a line PCRE gave up matching.
+var errMatchTimeout = errors.New("pcre match timed out")
+
+// PCREStrategy implements regex matching with a backtracking engine, for
+// -engine pcre. Backtracking can take exponential time on some patterns,
+// so each line gets at most the engine's timeout; a line that runs out is
+// treated as not matching and reported as a timeout error.
+type PCREStrategy struct {
+	expression *regexp2.Regexp
+	timeout    time.Duration
+	wholeWord  bool
+	// captures records the groups of each match; see withCaptures.
+	captures bool
+}
+
+// NewPCREStrategy compiles pattern for the PCRE engine. With wholeWord the
+// pattern is wrapped in lookarounds that reject a word rune, as isWordRune
+// defines it, on either side.
+func NewPCREStrategy(pattern string, ignoreCase bool, wholeWord bool, timeout time.Duration) (PCREStrategy, error) {
+	options := regexp2.RegexOptions(regexp2.None)
+	if ignoreCase {
+		options |= regexp2.IgnoreCase
+	}
+	// The pattern compiles on its own first, so it cannot close the group
+	// around it.
+	expression, err := regexp2.Compile(pattern, options)
+	if err != nil {
+		return PCREStrategy{}, err
+	}
+	if wholeWord {
+		const word = `[\p{L}\p{M}\p{Nd}_]`
+		expression = regexp2.MustCompile(`(?<!`+word+`)(?:`+pattern+`)(?!`+word+`)`, options)
+	}
+	expression.MatchTimeout = timeout
+	return PCREStrategy{expression: expression, timeout: timeout, wholeWord: wholeWord}, nil
+}
+
+// withCaptures returns strategy recording in MatchRange.Captures what the
+// pattern's groups matched, if it has any.
+func (strategy PCREStrategy) withCaptures() PCREStrategy {
+	strategy.captures = len(strategy.expression.GetGroupNumbers()) > 1
+	return strategy
+}
+
+// groupName returns the name of a group the engine calls name: "" for an
+// unnamed group, which it calls by its number.
+func groupName(name string) string {
+	if _, err := strconv.Atoi(name); err == nil {
+		return ""
+	}
+	return name
+}
+
+// FindRanges finds all PCRE matches in a line; a line that timed out has
+// none.
+func (strategy PCREStrategy) FindRanges(line string) []MatchRange {
+	ranges, _ := strategy.findRangesErr(line)
+	return ranges
+}
+
+// findRangesErr finds all PCRE matches in a line, leftmost first and
+// non-overlapping, and the timeout error if matching it took too long.
+// With -w, empty matches are dropped as findWords drops them.
+func (strategy PCREStrategy) findRangesErr(line string) ([]MatchRange, error) {
+	runes := []rune(line)
+	match, err := strategy.expression.FindRunesMatch(runes)
+	// The engine counts in runes: walk the line once, alongside the
+	// matches, to turn their rune indexes into byte offsets. A byte that is
+	// not UTF-8 is one utf8.RuneError rune, as []rune decodes it.
+	runeIndex, byteIndex := 0, 0
+	offset := func(index int) int {
+		for ; runeIndex < index; runeIndex++ {
+			_, size := utf8.DecodeRuneInString(line[byteIndex:])
+			byteIndex += size
+		}
+		return byteIndex
+	}
+	var ranges []MatchRange
+	for err == nil && match != nil {
+		if match.Length > 0 || !strategy.wholeWord {
+			start := offset(match.Index)
+			found := MatchRange{Start: start, End: offset(match.Index + match.Length)}
+			if strategy.captures {
+				found.Captures = pcreCaptures(line, match)
+			}
+			ranges = append(ranges, found)
+		}
+		match, err = strategy.expression.FindNextMatch(match)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w after %s; the pattern may backtrack catastrophically, so simplify it or raise -pcre-timeout-ms", errMatchTimeout, strategy.timeout)
+	}
+	return ranges, nil
+}
+
+// pcreCaptures returns the groups of match. Lookarounds can capture
+// outside the match, so each group's rune indexes are counted from the
+// start of line. The engine numbers named groups after unnamed ones.
+func pcreCaptures(line string, match *regexp2.Match) *[]Capture {
+	groups := match.Groups()[1:]
+	captures := make([]Capture, 0, len(groups))
+	for _, group := range groups {
+		capture := Capture{Name: groupName(group.Name), Start: -1, End: -1}
+		if len(group.Captures) > 0 {
+			capture.Start = runeOffset(line, group.Index)
+			capture.End = capture.Start + runeOffset(line[capture.Start:], group.Length)
+		}
+		captures = append(captures, capture)
+	}
+	return &captures
+}
+
+// runeOffset returns the byte offset in s of its rune at index, counting a
+// byte that is not UTF-8 as one rune, as []rune does.
+func runeOffset(s string, index int) int {
+	offset := 0
+	for ; index > 0; index-- {
+		_, size := utf8.DecodeRuneInString(s[offset:])
+		offset += size
+	}
+	return offset
+}
+
+// fallibleStrategy is implemented by strategies whose matching can fail on
+// a line, as PCRE's does when it times out, and by the strategies that
+// wrap others, to pass such failures on.
+type fallibleStrategy interface {
+	findRangesErr(line string) ([]MatchRange, error)
+}
+
+// findRanges returns strategy's ranges in line and, when strategy can
+// fail, why it failed on line.
+func findRanges(strategy MatchStrategy, line string) ([]MatchRange, error) {
+	if fallible, ok := strategy.(fallibleStrategy); ok {
+		return fallible.findRangesErr(line)
+	}
+	return strategy.FindRanges(line), nil
+}
@@ -0,0 +1,69 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/vennictus/gosearch/internal/config"
+)
+
+// EstimateBudget caps the pre-count of -progress=estimate.
+const EstimateBudget = time.Second
+
+// WorkTotal is how much a search has to read, for -progress.
+type WorkTotal struct {
+	Files int64
+	Bytes int64
+	// Approximate marks totals extrapolated from a pre-count that ran out
+	// of time.
+	Approximate bool
+}
+
+// CountWork walks the tree cfg searches, as the search will, and totals the
+// files it would enqueue and their sizes. Files are only statted, and only
+// when the walk has not already. With a budget the walk goes breadth first
+// and stops once budget has passed; the totals are then scaled by the
+// directories it did not reach, taking the ones it walked as typical.
+func CountWork(ctx context.Context, cfg config.Config, budget time.Duration) (WorkTotal, error) {
+	if budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, budget)
+		defer cancel()
+		cfg.WalkOrder = "breadth"
+	}
+	metrics := &Metrics{}
+	jobs := make(chan FileJob)
+	counted := make(chan WorkTotal)
+	go func() {
+		var total WorkTotal
+		for job := range jobs {
+			total.Files++
+			info := job.Info
+			if info == nil {
+				info, _ = cfg.FS.Stat(job.Path)
+			}
+			if info != nil {
+				total.Bytes += info.Size()
+			}
+		}
+		counted <- total
+	}()
+	w, finish := newWalker(cfg, jobs, io.Discard, metrics, WalkHooks{})
+	err := w.run(ctx)
+	finish()
+	close(jobs)
+	total := <-counted
+
+	if budget > 0 && errors.Is(err, context.DeadlineExceeded) {
+		if entered := metrics.DirsEntered.Load(); entered > 0 {
+			scale := float64(entered+int64(w.unvisited)) / float64(entered)
+			total.Files = int64(float64(total.Files) * scale)
+			total.Bytes = int64(float64(total.Bytes) * scale)
+		}
+		total.Approximate = true
+		err = nil
+	}
+	return total, err
+}
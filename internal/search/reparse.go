@@ -0,0 +1,99 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReparseKind classifies a Windows reparse point. os.ModeSymlink marks some
+// reparse points and not others, depending on the Go version, so the walk
+// classifies them itself: links of every kind are followed, and checked for
+// loops, the way symlinks are, and kinds it cannot search are skipped.
+type ReparseKind int
+
+const (
+	// ReparseNone is not a reparse point, or is one that keeps a file's
+	// data elsewhere (a deduplicated or cloud file) and reads like a file.
+	ReparseNone ReparseKind = iota
+	ReparseSymlink
+	ReparseJunction
+	// ReparseMountPoint is a volume mounted on a directory.
+	ReparseMountPoint
+	// ReparseAppExecLink is an app execution alias: a stub only the Windows
+	// loader can resolve.
+	ReparseAppExecLink
+	// ReparseOther is any other reparse point that names something else.
+	ReparseOther
+)
+
+// Reparse tags from winnt.h.
+const (
+	reparseTagMountPoint  = 0xA0000003
+	reparseTagSymlink     = 0xA000000C
+	reparseTagAppExecLink = 0x8000001B
+	// reparseTagNameSurrogate is set in the tag of every reparse point that
+	// stands for another file or directory.
+	reparseTagNameSurrogate = 0x20000000
+)
+
+func (kind ReparseKind) String() string {
+	switch kind {
+	case ReparseSymlink:
+		return "symlink"
+	case ReparseJunction:
+		return "junction"
+	case ReparseMountPoint:
+		return "mount_point"
+	case ReparseAppExecLink:
+		return "app_exec_link"
+	case ReparseOther:
+		return "other"
+	}
+	return "none"
+}
+
+// IsLink reports whether the walk treats kind as a symlink.
+func (kind ReparseKind) IsLink() bool {
+	return kind == ReparseSymlink || kind == ReparseJunction || kind == ReparseMountPoint
+}
+
+// ClassifyReparsePoint returns the kind of a reparse point with tag. A mount
+// point tag is shared by junctions and volume mount points, told apart by
+// target: a volume's is a \\?\Volume{GUID}\ path.
+func ClassifyReparsePoint(tag uint32, target string) ReparseKind {
+	switch tag {
+	case reparseTagSymlink:
+		return ReparseSymlink
+	case reparseTagMountPoint:
+		volume := strings.TrimPrefix(strings.TrimPrefix(target, `\\?\`), `\??\`)
+		if strings.HasPrefix(volume, "Volume{") {
+			return ReparseMountPoint
+		}
+		return ReparseJunction
+	case reparseTagAppExecLink:
+		return ReparseAppExecLink
+	}
+	if tag&reparseTagNameSurrogate != 0 {
+		return ReparseOther
+	}
+	return ReparseNone
+}
+
+// linkRealPath resolves a link the walk may follow to the real path its
+// loop check compares. filepath.EvalSymlinks does not go through junctions
+// and mount points on every Go version, so their target is read first; a
+// volume's GUID path, which does not resolve further, is its own identity.
+func linkRealPath(path string, kind ReparseKind) (string, error) {
+	if kind != ReparseJunction && kind != ReparseMountPoint {
+		return realPath(path)
+	}
+	target, err := os.Readlink(path)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := realPath(target); err == nil {
+		return resolved, nil
+	}
+	return filepath.Clean(target), nil
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package search
+
+import "io/fs"
+
+// reparseKind reports that entry is not a reparse point: only Windows has
+// them, and os.ModeSymlink marks every link elsewhere.
+func reparseKind(path string, entry fs.DirEntry) ReparseKind {
+	return ReparseNone
+}
@@ -0,0 +1,39 @@
+//go:build windows
+
+package search
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// reparseKind classifies entry if it is a reparse point. Its attributes come
+// with the directory listing; the tag costs one more lookup, made only for
+// reparse points.
+func reparseKind(path string, entry fs.DirEntry) ReparseKind {
+	info, err := entry.Info()
+	if err != nil {
+		return ReparseNone
+	}
+	attrs, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok || attrs.FileAttributes&syscall.FILE_ATTRIBUTE_REPARSE_POINT == 0 {
+		return ReparseNone
+	}
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return ReparseNone
+	}
+	var data syscall.Win32finddata
+	handle, err := syscall.FindFirstFile(name, &data)
+	if err != nil {
+		return ReparseNone
+	}
+	_ = syscall.FindClose(handle)
+	// For a reparse point, Reserved0 holds its tag.
+	target := ""
+	if data.Reserved0 == reparseTagMountPoint {
+		target, _ = os.Readlink(path)
+	}
+	return ClassifyReparsePoint(data.Reserved0, target)
+}
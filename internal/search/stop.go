@@ -0,0 +1,42 @@
+package search
+
+import (
+	"context"
+	"errors"
+)
+
+// StopCause says why a run ended before searching everything. Whichever
+// component stops the run cancels its context with one as the cause.
+type StopCause struct {
+	// Reason is the stable name printed as "stopped_reason" in JSON.
+	Reason string
+	// Message describes the cause on stderr.
+	Message string
+}
+
+func (cause *StopCause) Error() string {
+	return "stopped early: " + cause.Message
+}
+
+// Causes of an early stop.
+var (
+	StopInterrupted = &StopCause{Reason: "interrupted", Message: "interrupted"}
+	StopQuiet       = &StopCause{Reason: "quiet", Message: "match found with -quiet"}
+	StopFirstMatch  = &StopCause{Reason: "first_match", Message: "first match printed with -1"}
+	StopMaxResults  = &StopCause{Reason: "max_results", Message: "result limit reached with -max-results"}
+	StopBrokenPipe  = &StopCause{Reason: "broken_pipe", Message: "output closed"}
+	StopWriteError  = &StopCause{Reason: "write_error", Message: "output write failed"}
+)
+
+// StopCauseOf returns why ctx was cancelled, or nil if it was not. A context
+// cancelled without a StopCause, as by the interrupt signal, was interrupted.
+func StopCauseOf(ctx context.Context) *StopCause {
+	if ctx.Err() == nil {
+		return nil
+	}
+	var cause *StopCause
+	if errors.As(context.Cause(ctx), &cause) {
+		return cause
+	}
+	return StopInterrupted
+}
@@ -0,0 +1,104 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// Symlink decisions, logged at debug level and counted in -metrics.
+const (
+	SymlinkNotFollowed  = "not_followed"
+	SymlinkIgnored      = "ignored"
+	SymlinkFollowedFile = "followed_file"
+	SymlinkFollowedDir  = "followed_dir"
+	SymlinkLoop         = "loop_skipped"
+	SymlinkDangling     = "dangling"
+	SymlinkError        = "error"
+	// SymlinkReparseSkipped is a Windows reparse point that is not a link.
+	SymlinkReparseSkipped = "reparse_skipped"
+)
+
+// SymlinkDecisions lists the symlink decisions in the order -metrics prints
+// them.
+var SymlinkDecisions = [...]string{SymlinkNotFollowed, SymlinkIgnored, SymlinkFollowedFile, SymlinkFollowedDir, SymlinkLoop, SymlinkDangling, SymlinkError, SymlinkReparseSkipped}
+
+// SymlinkResolution records what the walk did with one symlink and where it
+// leads.
+type SymlinkResolution struct {
+	Path string
+	// Target is the link as written, or "" if it could not be read.
+	Target string
+	// Resolved is the real path at the end of the link chain, or "" if it
+	// does not resolve.
+	Resolved string
+	Decision string
+	// Reparse is the kind of Windows reparse point the link is, if any.
+	Reparse ReparseKind
+	// OutsideRoot marks a followed link whose real path lies outside the
+	// search root.
+	OutsideRoot bool
+}
+
+// SymlinkCounts counts symlinks by decision.
+type SymlinkCounts struct {
+	counts      [len(SymlinkDecisions)]atomic.Int64
+	outsideRoot atomic.Int64
+}
+
+func (counts *SymlinkCounts) add(link SymlinkResolution) {
+	for i, name := range SymlinkDecisions {
+		if name == link.Decision {
+			counts.counts[i].Add(1)
+		}
+	}
+	if link.OutsideRoot {
+		counts.outsideRoot.Add(1)
+	}
+}
+
+// Count returns how many symlinks were given decision.
+func (counts *SymlinkCounts) Count(decision string) int64 {
+	for i, name := range SymlinkDecisions {
+		if name == decision {
+			return counts.counts[i].Load()
+		}
+	}
+	return 0
+}
+
+// OutsideRoot returns how many followed symlinks led outside the root.
+func (counts *SymlinkCounts) OutsideRoot() int64 {
+	return counts.outsideRoot.Load()
+}
+
+// decideSymlink counts a symlink decision and reports it to the OnSymlink
+// hook. resolved is the link's real path when the walk already has it; the
+// link is only read and resolved here when something needs the answer.
+func (w *walker) decideSymlink(path string, kind ReparseKind, decision string, resolved string) {
+	followed := decision == SymlinkFollowedFile || decision == SymlinkFollowedDir
+	if resolved == "" && (followed || w.hooks.OnSymlink != nil) {
+		resolved, _ = linkRealPath(path, kind)
+	}
+	link := SymlinkResolution{Path: path, Resolved: resolved, Decision: decision, Reparse: kind}
+	if followed && resolved != "" && w.rootReal != "" {
+		rel, err := filepath.Rel(w.rootReal, resolved)
+		link.OutsideRoot = err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+	}
+	w.metrics.Symlinks.add(link)
+	if w.hooks.OnSymlink != nil {
+		link.Target, _ = os.Readlink(path)
+		w.hooks.OnSymlink(link)
+	}
+}
+
+// realPath resolves every symlink in path to an absolute path, so it can be
+// compared with the root's real path.
+func realPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
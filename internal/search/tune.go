@@ -0,0 +1,129 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+
+	"github.com/vennictus/gosearch/internal/config"
+)
+
+// CalibrationFiles is how many files -tune samples before the search starts.
+const CalibrationFiles = 300
+
+// Calibration reads at most calibrationFileBytes of each sampled file and
+// stops reading once calibrationBytes have been read, so that calibrating a
+// tree of large files with an expensive pattern costs a fraction of the search.
+const (
+	calibrationFileBytes = 64 << 10
+	calibrationBytes     = 1 << 20
+)
+
+// Calibration summarises a sample of the files a search will read.
+type Calibration struct {
+	// Files counts the files the walk produced, up to the sampling limit;
+	// Sampled counts those that were read and matched.
+	Files   int
+	Sampled int
+	Bytes   int64
+	Lines   int
+	Matches int
+	// Read is the time spent reading the sampled files and Match the time
+	// spent matching their lines.
+	Read  time.Duration
+	Match time.Duration
+}
+
+// Calibrate walks up to limit files of the tree cfg searches, reading and
+// matching the start of as many as the byte budget allows. The sample is
+// walked in interleave order so one large directory cannot stand in for the
+// whole tree. Unreadable files are skipped silently; the search proper
+// reports them.
+func Calibrate(ctx context.Context, cfg config.Config, strategy MatchStrategy, limit int) Calibration {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cfg.WalkOrder = "interleave"
+	jobs := make(chan FileJob)
+	go func() {
+		_ = WalkFiles(ctx, cfg, jobs, io.Discard, &Metrics{}, WalkHooks{})
+		close(jobs)
+	}()
+
+	var calibration Calibration
+	for job := range jobs {
+		if calibration.Files == limit {
+			cancel()
+			continue
+		}
+		calibration.Files++
+		if calibration.Bytes >= calibrationBytes {
+			continue
+		}
+		start := time.Now()
+		file, err := cfg.FS.Open(job.Path)
+		if err != nil {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(file, calibrationFileBytes))
+		_ = file.Close()
+		if err != nil {
+			continue
+		}
+		calibration.Read += time.Since(start)
+		calibration.Sampled++
+		calibration.Bytes += int64(len(data))
+
+		start = time.Now()
+		for _, line := range bytes.Split(data, []byte{'\n'}) {
+			calibration.Lines++
+			if len(strategy.FindRanges(string(line))) > 0 {
+				calibration.Matches++
+			}
+		}
+		calibration.Match += time.Since(start)
+	}
+	return calibration
+}
+
+// Apply replaces the worker counts and backpressure that cfg derived from
+// -workers with values fitted to the sample. Explicitly set values are kept.
+//
+// A sample smaller than smallTree files means the whole tree is tiny: one
+// worker of each kind and no dynamic scaling. Otherwise the -workers budget is
+// split by the share of sampled time spent reading versus matching; IO
+// workers may oversubscribe up to twice the budget because they mostly wait,
+// while CPU workers stay within it. Small files get deeper channels, since
+// each one is a short burst of work.
+func (calibration Calibration) Apply(cfg *config.Config, smallTree int) {
+	if calibration.Files < smallTree {
+		if cfg.AutoIOWorkers {
+			cfg.IOWorkers = 1
+		}
+		if cfg.AutoCPUWorkers {
+			cfg.CPUWorkers = 1
+		}
+		cfg.DynamicWorkers = false
+		return
+	}
+
+	readShare := 0.5
+	if total := calibration.Read + calibration.Match; total > 0 {
+		readShare = float64(calibration.Read) / float64(total)
+	}
+	budget := float64(cfg.Workers)
+	if cfg.AutoIOWorkers {
+		cfg.IOWorkers = clampWorkers(int(2*budget*readShare+0.5), 1, 2*cfg.Workers)
+	}
+	if cfg.AutoCPUWorkers {
+		cfg.CPUWorkers = clampWorkers(int(2*budget*(1-readShare)+0.5), 1, cfg.Workers)
+		cfg.MaxWorkers = max(cfg.MaxWorkers, cfg.CPUWorkers)
+	}
+	if cfg.AutoBackpressure && calibration.Sampled > 0 && calibration.Bytes/int64(calibration.Sampled) < 4096 {
+		cfg.Backpressure = cfg.Workers * 32
+	}
+}
+
+func clampWorkers(value, low, high int) int {
+	return min(max(value, low), high)
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -14,130 +15,517 @@ import (
 	"github.com/vennictus/gosearch/internal/ignore"
 )
 
+// WalkHooks lets callers observe the walk without owning the jobs channel.
+// Nil hooks are skipped.
+type WalkHooks struct {
+	// OnEnqueue is called with the running file count after each enqueue.
+	OnEnqueue func(enqueued int64)
+	// OnCandidate is called for every file that passes ignore and extension
+	// filters, before any size check.
+	OnCandidate func(path string)
+	// OnDecision is called once for every path the walk looks at, with what
+	// it did about it.
+	OnDecision func(decision WalkDecision)
+	// OnSymlink is called once for every symlink the walk meets, with where
+	// it leads and what the walk did about it.
+	OnSymlink func(link SymlinkResolution)
+}
+
+// WalkDecision records what the walk did with one path, for -repro.
+type WalkDecision struct {
+	Path     string
+	Dir      bool
+	Symlink  bool
+	Decision string
+	// Rule names what decided an ignored or skipped path: an ignore rule's
+	// source and pattern, the default ignore list, or a .gitattributes
+	// attribute.
+	Rule string
+}
+
+// Walk decisions. Directories are decided when the walk opens them, files
+// when it enqueues or skips them.
+const (
+	DecisionEntered     = "entered"
+	DecisionEnqueued    = "enqueued"
+	DecisionIgnored     = "ignored"
+	DecisionMaxDepth    = "max_depth"
+	DecisionPruneMarker = "prune_marker"
+	DecisionReadError   = "read_error"
+	DecisionSymlink     = "symlink_not_followed"
+	DecisionSymlinkLoop = "symlink_loop"
+	DecisionReparse     = "reparse_skipped"
+	DecisionStatError   = "stat_error"
+	DecisionAttribute   = "attribute"
+	DecisionExtension   = "extension"
+	DecisionSize        = "size"
+	DecisionOutput      = "output"
+)
+
+// defaultIgnoreListTag is the Rule of paths ignored by the default ignore list.
+const defaultIgnoreListTag = "default ignore list"
+
+// walkBatch is how many entries -walk-order interleave takes from one
+// directory before moving on to the next.
+const walkBatch = 32
+
+// walkDir is a directory on the walk's work list. It is opened (ignore files
+// loaded and entries read) the first time it is visited.
+type walkDir struct {
+	path           string
+	depth          int
+	symlink        bool
+	inheritedRules []ignore.Rule
+	inheritedAttrs []ignore.AttrRule
+	parentRules    *ignore.RuleSet
+
+	opened  bool
+	rules   []ignore.Rule
+	ruleSet *ignore.RuleSet
+	attrs   []ignore.AttrRule
+	entries []os.DirEntry
+	next    int
+}
+
+// walker holds the state shared by every directory of one walk.
+type walker struct {
+	cfg     config.Config
+	visited map[string]struct{}
+	jobs    chan<- FileJob
+	stderr  io.Writer
+	metrics *Metrics
+	hooks   WalkHooks
+	// rootReal is the root's real path when following symlinks, so links
+	// that lead outside it can be told apart.
+	rootReal string
+	// seq is the number of the last file enqueued.
+	seq int64
+	// unvisited is how many directories were left to walk, counting the
+	// one being walked, for CountWork's estimate.
+	unvisited int
+	// outputDir and outputName locate -output, so the walk can pass over
+	// the file results are being written to.
+	outputDir  string
+	outputName string
+}
+
 // WalkFiles walks the filesystem and sends file paths to the jobs channel.
-func WalkFiles(ctx context.Context, cfg config.Config, jobs chan<- string, stderr io.Writer, metrics *Metrics) error {
+//
+// cfg.WalkOrder picks the order directories are visited in: depth finishes
+// each subdirectory before the rest of its parent, breadth finishes each
+// directory before any of its subdirectories, and interleave takes walkBatch
+// entries from each open directory in turn, so one huge directory cannot hold
+// back the rest of the tree.
+func WalkFiles(ctx context.Context, cfg config.Config, jobs chan<- FileJob, stderr io.Writer, metrics *Metrics, hooks WalkHooks) error {
+	w, finish := newWalker(cfg, jobs, stderr, metrics, hooks)
+	defer finish()
+	return w.run(ctx)
+}
+
+// newWalker sets up a walk of cfg's root. finish credits the walk's ignore
+// cache use to metrics once it is over.
+func newWalker(cfg config.Config, jobs chan<- FileJob, stderr io.Writer, metrics *Metrics, hooks WalkHooks) (*walker, func()) {
 	visited := make(map[string]struct{})
 	rootAbs, _ := filepath.Abs(cfg.RootPath)
+	var rootReal string
 	if cfg.FollowSymlinks {
 		if resolved, err := filepath.EvalSymlinks(rootAbs); err == nil {
 			visited[resolved] = struct{}{}
+			rootReal = resolved
 		}
 	}
-	return walkDirectory(ctx, cfg, cfg.RootPath, 0, nil, visited, jobs, stderr, metrics)
-}
-
-func walkDirectory(
-	ctx context.Context,
-	cfg config.Config,
-	currentDir string,
-	depth int,
-	inheritedRules []ignore.Rule,
-	visited map[string]struct{},
-	jobs chan<- string,
-	stderr io.Writer,
-	metrics *Metrics,
-) error {
-	if cfg.MaxDepth >= 0 && depth > cfg.MaxDepth {
-		return nil
+	finish := func() {}
+	if cfg.IgnoreCache != nil {
+		hits, misses := cfg.IgnoreCache.Hits.Load(), cfg.IgnoreCache.Misses.Load()
+		finish = func() {
+			metrics.IgnoreCacheHits.Add(cfg.IgnoreCache.Hits.Load() - hits)
+			metrics.IgnoreCacheMisses.Add(cfg.IgnoreCache.Misses.Load() - misses)
+		}
 	}
-
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	default:
+	w := &walker{cfg: cfg, visited: visited, jobs: jobs, stderr: stderr, metrics: metrics, hooks: hooks, rootReal: rootReal}
+	if cfg.OutputPath != "" {
+		if outputAbs, err := filepath.Abs(cfg.OutputPath); err == nil {
+			w.outputDir, w.outputName = filepath.Split(outputAbs)
+		}
 	}
+	return w, finish
+}
 
-	rules, err := ignore.LoadRules(currentDir, inheritedRules)
-	if err != nil {
-		fmt.Fprintln(stderr, err)
+// run walks the root, or lists -files-from in its place.
+func (w *walker) run(ctx context.Context) error {
+	if w.cfg.FilesFrom != nil {
+		return w.list(ctx)
 	}
+	return w.walk(ctx, &walkDir{path: w.cfg.RootPath})
+}
 
-	entries, err := os.ReadDir(currentDir)
-	if err != nil {
-		fmt.Fprintln(stderr, err)
-		return nil
+// list enqueues the files named by -files-from lists in place of a walk.
+// The lists say exactly what to search, so ignore rules and .gitattributes
+// do not apply; -extensions still does, and IO workers check -max-size.
+func (w *walker) list(ctx context.Context) error {
+	for _, path := range w.cfg.FilesFrom.Paths {
+		if w.isOutput(filepath.Dir(path), filepath.Base(path)) {
+			w.decide(path, false, false, DecisionOutput, "")
+			continue
+		}
+		if len(w.cfg.Extensions) > 0 {
+			if _, ok := w.cfg.Extensions[strings.ToLower(filepath.Ext(path))]; !ok {
+				w.metrics.FilesSkippedExtension.Add(1)
+				w.decide(path, false, false, DecisionExtension, "")
+				continue
+			}
+		}
+		if w.hooks.OnCandidate != nil {
+			w.hooks.OnCandidate(path)
+		}
+		w.seq++
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case w.jobs <- FileJob{Path: path, Seq: w.seq}:
+			enqueued := w.metrics.FilesEnqueued.Add(1)
+			w.decide(path, false, false, DecisionEnqueued, "")
+			if w.hooks.OnEnqueue != nil {
+				w.hooks.OnEnqueue(enqueued)
+			}
+		}
 	}
+	return nil
+}
 
-	for _, entry := range entries {
+// walk visits directories from a work list until it is empty. Depth order
+// uses it as a stack, the other orders as a queue.
+func (w *walker) walk(ctx context.Context, root *walkDir) error {
+	depthFirst := w.cfg.WalkOrder != "breadth" && w.cfg.WalkOrder != "interleave"
+	pending := []*walkDir{root}
+	for len(pending) > 0 {
+		w.unvisited = len(pending)
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
 		}
 
-		fullPath := filepath.Join(currentDir, entry.Name())
-		entryType := entry.Type()
-		isSymlink := entryType&os.ModeSymlink != 0
-		isDir := entry.IsDir()
-
-		if ignore.ShouldIgnore(cfg.DefaultIgnoreDirs, rules, fullPath, isDir) {
+		var dir *walkDir
+		if depthFirst {
+			dir, pending = pending[len(pending)-1], pending[:len(pending)-1]
+		} else {
+			dir, pending = pending[0], pending[1:]
+		}
+		if !dir.opened && !w.open(dir) {
 			continue
 		}
 
-		if isSymlink {
-			if !cfg.FollowSymlinks {
-				continue
+		limit := len(dir.entries)
+		if w.cfg.WalkOrder == "interleave" {
+			limit = min(dir.next+walkBatch, limit)
+		}
+		var children []*walkDir
+		for dir.next < limit {
+			entry := dir.entries[dir.next]
+			dir.next++
+			child, err := w.visit(ctx, dir, entry)
+			if err != nil {
+				return err
 			}
-			targetInfo, statErr := os.Stat(fullPath)
-			if statErr != nil {
-				fmt.Fprintln(stderr, statErr)
-				continue
+			if child != nil {
+				children = append(children, child)
+				if depthFirst {
+					break
+				}
 			}
-			isDir = targetInfo.IsDir()
+		}
+		if dir.next < len(dir.entries) {
+			pending = append(pending, dir)
+		}
+		pending = append(pending, children...)
+	}
+	return nil
+}
 
-			if ignore.ShouldIgnore(cfg.DefaultIgnoreDirs, rules, fullPath, isDir) {
-				continue
-			}
+// open loads dir's ignore files and entries. It reports false when dir is
+// pruned or unreadable and should not be walked.
+func (w *walker) open(dir *walkDir) bool {
+	cfg, metrics, stderr := w.cfg, w.metrics, w.stderr
+	dir.opened = true
+	if cfg.MaxDepth >= 0 && dir.depth > cfg.MaxDepth {
+		metrics.DirsPrunedDepth.Add(1)
+		w.decide(dir.path, true, dir.symlink, DecisionMaxDepth, "")
+		return false
+	}
+
+	// The root was named on the command line, so neither the default ignore
+	// list nor its own prune marker keeps it from being searched, unless
+	// -strict-ignore asks for it to be treated like any other directory.
+	// Either way they still apply to the directories below it.
+	root := dir.depth == 0
+	if root && cfg.StrictIgnore {
+		abs, _ := filepath.Abs(dir.path)
+		if _, blocked := cfg.DefaultIgnoreDirs[strings.ToLower(filepath.Base(abs))]; blocked {
+			metrics.DirsPrunedDefault.Add(1)
+			w.decideIgnored(dir.path, true, false, nil)
+			fmt.Fprintf(stderr, "%s: root is on the default ignore list, not searched (-strict-ignore)\n", dir.path)
+			return false
 		}
+	}
+	checkPrune := !root || cfg.StrictIgnore
+
+	// A !!prune line is found while the .gosearchignore is parsed and a
+	// .gosearchprune file among the entries read below, so neither marker
+	// costs a read of its own.
+	rules, prune, err := ignore.LoadRules(cfg.FS, cfg.IgnoreCache, dir.path, dir.inheritedRules)
+	if err != nil {
+		reportFileError(stderr, metrics, dir.path, w.seq+1, err)
+	}
+	if checkPrune && prune {
+		w.pruneMarked(dir)
+		return false
+	}
+
+	dir.entries, err = cfg.FS.ReadDir(dir.path)
+	if err != nil {
+		metrics.DirReadErrors.Add(1)
+		reportFileError(stderr, metrics, dir.path, w.seq+1, err)
+		w.decide(dir.path, true, dir.symlink, DecisionReadError, "")
+		return false
+	}
+	if checkPrune && ignore.HasPruneMarkerFile(dir.entries) {
+		dir.entries = nil
+		w.pruneMarked(dir)
+		return false
+	}
+
+	dir.rules = rules
+	dir.ruleSet = ignore.NewRuleSet(dir.rules, dir.path, dir.parentRules)
+
+	dir.attrs = dir.inheritedAttrs
+	if cfg.RespectGitattributes {
+		dir.attrs, err = ignore.LoadAttributes(cfg.FS, cfg.IgnoreCache, dir.path, dir.inheritedAttrs)
+		if err != nil {
+			reportFileError(stderr, metrics, dir.path, w.seq+1, err)
+		}
+	}
+
+	metrics.DirsEntered.Add(1)
+	w.decide(dir.path, true, dir.symlink, DecisionEntered, "")
+	UpdateMaxActive(&metrics.MaxDepth, int64(dir.depth))
+	return true
+}
 
+// pruneMarked records that dir has a prune marker and is not walked.
+func (w *walker) pruneMarked(dir *walkDir) {
+	w.metrics.DirsPrunedMarker.Add(1)
+	w.decide(dir.path, true, dir.symlink, DecisionPruneMarker, "")
+	if dir.depth == 0 {
+		fmt.Fprintf(w.stderr, "%s: root has a prune marker, not searched (-strict-ignore)\n", dir.path)
+	}
+}
+
+// visit handles one entry of dir: a file is filtered and enqueued, and a
+// directory to descend into is returned for the work list.
+func (w *walker) visit(ctx context.Context, dir *walkDir, entry os.DirEntry) (*walkDir, error) {
+	cfg, metrics, stderr, hooks := w.cfg, w.metrics, w.stderr, w.hooks
+	rules, attrs := dir.rules, dir.attrs
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	fullPath := filepath.Join(dir.path, entry.Name())
+	entryType := entry.Type()
+	kind := reparseKind(fullPath, entry)
+	isSymlink := entryType&os.ModeSymlink != 0 || kind.IsLink()
+	isDir := entry.IsDir()
+	var info os.FileInfo
+
+	if ignored, rule := dir.ruleSet.Match(cfg.DefaultIgnoreDirs, entry.Name(), isDir); ignored {
 		if isDir {
-			if _, blocked := cfg.DefaultIgnoreDirs[strings.ToLower(entry.Name())]; blocked {
-				continue
-			}
-			if isSymlink {
-				resolved, resolveErr := filepath.EvalSymlinks(fullPath)
-				if resolveErr != nil {
-					fmt.Fprintln(stderr, resolveErr)
-					continue
-				}
-				if _, seen := visited[resolved]; seen {
-					continue
-				}
-				visited[resolved] = struct{}{}
-			}
-			if err := walkDirectory(ctx, cfg, fullPath, depth+1, rules, visited, jobs, stderr, metrics); err != nil {
-				if errors.Is(err, context.Canceled) {
-					return err
-				}
+			countPrunedDir(cfg, metrics, entry.Name())
+		}
+		w.decideIgnored(fullPath, isDir, isSymlink, rule)
+		if isSymlink {
+			w.decideSymlink(fullPath, kind, SymlinkIgnored, "")
+		}
+		return nil, nil
+	}
+
+	// A reparse point that is not a link, such as an app execution alias,
+	// has nothing the walk can search.
+	if kind != ReparseNone && !kind.IsLink() {
+		w.decide(fullPath, isDir, true, DecisionReparse, kind.String())
+		w.decideSymlink(fullPath, kind, SymlinkReparseSkipped, "")
+		return nil, nil
+	}
+
+	if isSymlink {
+		if !cfg.FollowSymlinks {
+			w.decide(fullPath, isDir, true, DecisionSymlink, "")
+			w.decideSymlink(fullPath, kind, SymlinkNotFollowed, "")
+			return nil, nil
+		}
+		targetInfo, statErr := cfg.FS.Stat(fullPath)
+		if statErr != nil {
+			reportFileError(stderr, metrics, fullPath, w.seq+1, statErr)
+			w.decide(fullPath, isDir, true, DecisionStatError, "")
+			if errors.Is(statErr, fs.ErrNotExist) {
+				w.decideSymlink(fullPath, kind, SymlinkDangling, "")
+			} else {
+				w.decideSymlink(fullPath, kind, SymlinkError, "")
 			}
-			continue
+			return nil, nil
 		}
+		isDir = targetInfo.IsDir()
+		info = targetInfo
 
-		if len(cfg.Extensions) > 0 {
-			ext := strings.ToLower(filepath.Ext(entry.Name()))
-			if _, ok := cfg.Extensions[ext]; !ok {
-				continue
+		if ignored, rule := dir.ruleSet.Match(cfg.DefaultIgnoreDirs, entry.Name(), isDir); ignored {
+			if isDir {
+				countPrunedDir(cfg, metrics, entry.Name())
 			}
+			w.decideIgnored(fullPath, isDir, true, rule)
+			w.decideSymlink(fullPath, kind, SymlinkIgnored, "")
+			return nil, nil
 		}
+	}
 
-		if cfg.MaxSizeBytes > 0 {
-			entryInfo, infoErr := entry.Info()
-			if infoErr != nil {
-				fmt.Fprintln(stderr, infoErr)
-				continue
+	if isDir {
+		if _, blocked := cfg.DefaultIgnoreDirs[strings.ToLower(entry.Name())]; blocked {
+			metrics.DirsPrunedDefault.Add(1)
+			w.decideIgnored(fullPath, true, isSymlink, nil)
+			if isSymlink {
+				w.decideSymlink(fullPath, kind, SymlinkIgnored, "")
 			}
-			if entryInfo.Size() > cfg.MaxSizeBytes {
-				continue
+			return nil, nil
+		}
+		if isSymlink {
+			resolved, resolveErr := linkRealPath(fullPath, kind)
+			if resolveErr != nil {
+				reportFileError(stderr, metrics, fullPath, w.seq+1, resolveErr)
+				w.decide(fullPath, true, true, DecisionStatError, "")
+				w.decideSymlink(fullPath, kind, SymlinkError, "")
+				return nil, nil
+			}
+			if _, seen := w.visited[resolved]; seen {
+				w.decide(fullPath, true, true, DecisionSymlinkLoop, "")
+				w.decideSymlink(fullPath, kind, SymlinkLoop, resolved)
+				return nil, nil
 			}
+			w.visited[resolved] = struct{}{}
+			w.decideSymlink(fullPath, kind, SymlinkFollowedDir, resolved)
+		}
+		return &walkDir{path: fullPath, depth: dir.depth + 1, symlink: isSymlink, inheritedRules: rules, inheritedAttrs: attrs, parentRules: dir.ruleSet}, nil
+	}
+	if isSymlink {
+		w.decideSymlink(fullPath, kind, SymlinkFollowedFile, "")
+	}
+
+	if w.isOutput(dir.path, entry.Name()) {
+		w.decide(fullPath, false, isSymlink, DecisionOutput, "")
+		return nil, nil
+	}
+
+	switch attr := ignore.AttributeSkip(attrs, fullPath); attr {
+	case ignore.AttrLinguistGenerated:
+		metrics.FilesSkippedGenerated.Add(1)
+		w.decide(fullPath, false, isSymlink, DecisionAttribute, attr)
+		return nil, nil
+	case ignore.AttrExportIgnore:
+		metrics.FilesSkippedExportIgnore.Add(1)
+		w.decide(fullPath, false, isSymlink, DecisionAttribute, attr)
+		return nil, nil
+	}
+
+	if len(cfg.Extensions) > 0 {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if _, ok := cfg.Extensions[ext]; !ok {
+			metrics.FilesSkippedExtension.Add(1)
+			w.decide(fullPath, false, isSymlink, DecisionExtension, "")
+			return nil, nil
 		}
+	}
 
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case jobs <- fullPath:
-			metrics.FilesEnqueued.Add(1)
+	if hooks.OnCandidate != nil {
+		hooks.OnCandidate(fullPath)
+	}
+
+	// Only -max-size needs the size to decide whether to search a file; a
+	// file that cannot be stated for its metadata alone is still searched,
+	// and its results carry none.
+	if info == nil && (cfg.MaxSizeBytes > 0 || cfg.NeedsFileMeta()) {
+		entryInfo, infoErr := entry.Info()
+		if infoErr != nil && cfg.MaxSizeBytes > 0 {
+			reportFileError(stderr, metrics, fullPath, w.seq+1, infoErr)
+			w.decide(fullPath, false, isSymlink, DecisionStatError, "")
+			return nil, nil
+		}
+		if infoErr == nil {
+			info = entryInfo
 		}
 	}
 
-	return nil
+	if cfg.MaxSizeBytes > 0 && info.Size() > cfg.MaxSizeBytes {
+		metrics.FilesSkippedSize.Add(1)
+		metrics.EmptyRun.skippedSize(fullPath)
+		w.decide(fullPath, false, isSymlink, DecisionSize, "")
+		return nil, nil
+	}
+
+	w.seq++
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case w.jobs <- FileJob{Path: fullPath, Info: info, Seq: w.seq}:
+		enqueued := metrics.FilesEnqueued.Add(1)
+		w.decide(fullPath, false, isSymlink, DecisionEnqueued, "")
+		if hooks.OnEnqueue != nil {
+			hooks.OnEnqueue(enqueued)
+		}
+	}
+	return nil, nil
+}
+
+// isOutput reports whether name in dir is the -output file, as a previous
+// run left it, or the temporary file this run writes in its place, so that
+// a search never reads its own results. Names are compared byte for byte.
+func (w *walker) isOutput(dir string, name string) bool {
+	if w.outputName == "" {
+		return false
+	}
+	if name != w.outputName && !(strings.HasPrefix(name, "."+w.outputName+".") && strings.HasSuffix(name, ".tmp")) {
+		return false
+	}
+	dirAbs, err := filepath.Abs(dir)
+	return err == nil && filepath.Join(dirAbs, name) == filepath.Join(w.outputDir, name)
+}
+
+// decide reports a walk decision to the OnDecision hook, if any.
+func (w *walker) decide(path string, isDir bool, isSymlink bool, decision string, rule string) {
+	if w.hooks.OnDecision != nil {
+		w.hooks.OnDecision(WalkDecision{Path: path, Dir: isDir, Symlink: isSymlink, Decision: decision, Rule: rule})
+	}
+}
+
+// decideIgnored counts an ignored file and reports an ignored path and the
+// rule responsible; a nil rule means the default ignore list.
+func (w *walker) decideIgnored(path string, isDir bool, isSymlink bool, rule *ignore.Rule) {
+	if !isDir {
+		w.metrics.FilesSkippedIgnore.Add(1)
+	}
+	if w.hooks.OnDecision == nil {
+		return
+	}
+	provenance := defaultIgnoreListTag
+	if rule != nil {
+		provenance = rule.String()
+	}
+	w.decide(path, isDir, isSymlink, DecisionIgnored, provenance)
+}
+
+// countPrunedDir attributes a skipped directory to the default ignore list or to ignore rules.
+func countPrunedDir(cfg config.Config, metrics *Metrics, name string) {
+	if _, blocked := cfg.DefaultIgnoreDirs[strings.ToLower(name)]; blocked {
+		metrics.DirsPrunedDefault.Add(1)
+		return
+	}
+	metrics.DirsPrunedIgnore.Add(1)
 }
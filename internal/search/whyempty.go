@@ -0,0 +1,212 @@
+package search
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/vennictus/gosearch/internal/config"
+)
+
+// Bounds on what -why-empty keeps and reads, so the probes stay cheap.
+const (
+	// emptyLineRing is how many scanned lines are kept for re-checking.
+	emptyLineRing = 256
+	// emptyLineEvery keeps one scanned line in this many.
+	emptyLineEvery = 8
+	// emptyPathLimit is how many paths are kept per kind of skip.
+	emptyPathLimit = 16
+	// emptyRawLimit is how much of a skipped file is read for the pattern.
+	emptyRawLimit = 1 << 20
+)
+
+// EmptyRunProbe collects what -why-empty needs to explain a run without
+// matches: a sample of scanned lines and a few of the files that were not
+// searched. Its methods do nothing on a nil probe, so the pipeline records
+// unconditionally.
+type EmptyRunProbe struct {
+	offered atomic.Int64
+
+	mu        sync.Mutex
+	lines     []sampledLine
+	next      int
+	binary    []string
+	oversized []string
+	ignored   []ignoredName
+}
+
+type sampledLine struct {
+	path string
+	line int
+	text string
+}
+
+type ignoredName struct {
+	path string
+	rule string
+}
+
+// NewEmptyRunProbe returns an empty probe.
+func NewEmptyRunProbe() *EmptyRunProbe {
+	return &EmptyRunProbe{}
+}
+
+// offerLine keeps every emptyLineEvery-th non-matching line in a ring.
+func (probe *EmptyRunProbe) offerLine(item LineItem) {
+	if probe == nil || probe.offered.Add(1)%emptyLineEvery != 1 {
+		return
+	}
+	probe.mu.Lock()
+	defer probe.mu.Unlock()
+	line := sampledLine{path: item.Path, line: item.Line, text: item.Text}
+	if len(probe.lines) < emptyLineRing {
+		probe.lines = append(probe.lines, line)
+		return
+	}
+	probe.lines[probe.next] = line
+	probe.next = (probe.next + 1) % emptyLineRing
+}
+
+// skippedBinary records a binary file that was not searched.
+func (probe *EmptyRunProbe) skippedBinary(path string) {
+	if probe == nil {
+		return
+	}
+	probe.mu.Lock()
+	defer probe.mu.Unlock()
+	if len(probe.binary) < emptyPathLimit {
+		probe.binary = append(probe.binary, path)
+	}
+}
+
+// skippedSize records a file over -max-size.
+func (probe *EmptyRunProbe) skippedSize(path string) {
+	if probe == nil {
+		return
+	}
+	probe.mu.Lock()
+	defer probe.mu.Unlock()
+	if len(probe.oversized) < emptyPathLimit {
+		probe.oversized = append(probe.oversized, path)
+	}
+}
+
+// IgnoredName records an ignored path whose name contains the pattern and
+// the rule that excluded it.
+func (probe *EmptyRunProbe) IgnoredName(path string, rule string) {
+	if probe == nil {
+		return
+	}
+	probe.mu.Lock()
+	defer probe.mu.Unlock()
+	if len(probe.ignored) < emptyPathLimit {
+		probe.ignored = append(probe.ignored, ignoredName{path: path, rule: rule})
+	}
+}
+
+// Explain returns the -why-empty diagnosis of a run with no matches, one
+// line per finding. relaxed is the pattern's strategy without -i and -w
+// restrictions, or nil if there are none to relax.
+func (probe *EmptyRunProbe) Explain(cfg config.Config, strategy MatchStrategy, relaxed MatchStrategy, metrics *Metrics) []string {
+	probe.mu.Lock()
+	defer probe.mu.Unlock()
+
+	skips := []struct {
+		name  string
+		count int64
+	}{
+		{"ignored", metrics.FilesSkippedIgnore.Load()},
+		{"extension", metrics.FilesSkippedExtension.Load()},
+		{"binary", metrics.FileErrors.Count(ErrorBinary)},
+		{"too large", metrics.FilesSkippedSize.Load()},
+		{"generated", metrics.FilesSkippedGenerated.Load()},
+		{"export-ignore", metrics.FilesSkippedExportIgnore.Load()},
+		{"encoding", metrics.FilesSkippedEncoding.Load()},
+	}
+	searched := metrics.FilesScanned.Load()
+	considered := searched
+	var breakdown []string
+	for _, skip := range skips {
+		if skip.count > 0 {
+			considered += skip.count
+			breakdown = append(breakdown, fmt.Sprintf("%s %d", skip.name, skip.count))
+		}
+	}
+	summary := fmt.Sprintf("%d files considered, %d searched", considered, searched)
+	if len(breakdown) > 0 {
+		summary += ", skipped: " + strings.Join(breakdown, ", ")
+	}
+	findings := []string{summary}
+
+	if relaxed != nil {
+		var near []sampledLine
+		for _, line := range probe.lines {
+			if len(relaxed.FindRanges(line.text)) > 0 {
+				near = append(near, line)
+			}
+		}
+		if len(near) > 0 {
+			sort.Slice(near, func(i, j int) bool {
+				if near[i].path != near[j].path {
+					return near[i].path < near[j].path
+				}
+				return near[i].line < near[j].line
+			})
+			findings = append(findings, fmt.Sprintf("%d of %d sampled lines match %s, e.g. %s:%d", len(near), len(probe.lines), relaxedHint(cfg), near[0].path, near[0].line))
+		}
+	}
+
+	for _, path := range sortedCopy(probe.binary) {
+		if rawContains(cfg, strategy, path) {
+			findings = append(findings, fmt.Sprintf("binary file %s contains the pattern; -format grep searches binary files", path))
+		}
+	}
+	for _, path := range sortedCopy(probe.oversized) {
+		if rawContains(cfg, strategy, path) {
+			findings = append(findings, fmt.Sprintf("%s is over -max-size and contains the pattern", path))
+		}
+	}
+	for _, ignored := range probe.ignored {
+		findings = append(findings, fmt.Sprintf("%s has the pattern in its name but was excluded by %s", ignored.path, ignored.rule))
+	}
+	if len(findings) == 1 {
+		findings = append(findings, "no near misses found: the pattern does not occur in the sampled lines or skipped files")
+	}
+	return findings
+}
+
+// relaxedHint names what the relaxed strategy dropped.
+func relaxedHint(cfg config.Config) string {
+	switch {
+	case !cfg.IgnoreCase && cfg.WholeWord:
+		return "case-insensitively without -w"
+	case cfg.WholeWord:
+		return "without -w"
+	default:
+		return "case-insensitively (try -i)"
+	}
+}
+
+// rawContains reports whether the first emptyRawLimit bytes of path contain
+// the pattern, ignoring lines and encoding.
+func rawContains(cfg config.Config, strategy MatchStrategy, path string) bool {
+	file, err := cfg.FS.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, emptyRawLimit))
+	if err != nil {
+		return false
+	}
+	return len(strategy.FindRanges(string(data))) > 0
+}
+
+func sortedCopy(paths []string) []string {
+	sorted := append([]string(nil), paths...)
+	sort.Strings(sorted)
+	return sorted
+}
@@ -10,19 +10,25 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
+	"github.com/vennictus/gosearch/internal/clock"
 	"github.com/vennictus/gosearch/internal/config"
+	"github.com/vennictus/gosearch/internal/fsys"
 )
 
-// IOWorker reads files and sends lines to CPU workers.
+// IOWorker reads files and sends lines to CPU workers. With -z, compressed
+// files are handed to decompress workers instead; with -hex-pattern every
+// file is sent as raw chunks.
 func IOWorker(
 	ctx context.Context,
 	cfg config.Config,
-	pathJobs <-chan string,
+	pathJobs <-chan FileJob,
 	lineJobs chan<- LineItem,
+	compressedJobs chan<- CompressedJob,
 	stderr io.Writer,
 	wg *sync.WaitGroup,
 	metrics *Metrics,
@@ -33,14 +39,18 @@ func IOWorker(
 		wg.Done()
 	}()
 
+	scanner := fileScanner{cfg: cfg, metrics: metrics, warn: func(path string, seq int64, err error) {
+		reportFileError(stderr, metrics, path, seq, err)
+	}}
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case filePath, ok := <-pathJobs:
+		case job, ok := <-pathJobs:
 			if !ok {
 				return
 			}
+			filePath := job.Path
 
 			metrics.IOActiveWorkers.Add(1)
 			UpdateMaxActive(&metrics.IOMaxActive, metrics.IOActiveWorkers.Load())
@@ -48,63 +58,206 @@ func IOWorker(
 			func() {
 				defer metrics.IOActiveWorkers.Add(-1)
 
-				if cfg.MaxSizeBytes > 0 {
-					info, statErr := os.Stat(filePath)
-					if statErr != nil {
-						fmt.Fprintln(stderr, statErr)
-						return
-					}
-					if info.Size() > cfg.MaxSizeBytes {
-						return
+				meta, ok, err := scanner.admit(job)
+				if err != nil {
+					reportFileError(stderr, metrics, filePath, job.Seq, err)
+				}
+				if !ok {
+					reason := SkipSize
+					if err != nil {
+						reason = SkipReadError
 					}
+					skipFile(ctx, cfg, filePath, job.Seq, reason, lineJobs)
+					return
 				}
 
-				binary, err := IsBinaryFile(filePath)
-				if err != nil {
-					fmt.Fprintln(stderr, fmt.Errorf("%s: %w", filePath, err))
+				if cfg.SearchCompressed && IsCompressedPath(filePath) {
+					select {
+					case <-ctx.Done():
+					case compressedJobs <- CompressedJob{Path: filePath, Meta: meta, Seq: job.Seq}:
+					}
 					return
 				}
-				if binary {
+
+				if len(cfg.HexPattern) > 0 {
+					scanRaw(ctx, cfg, lineSource{path: filePath, meta: meta, seq: job.Seq}, lineJobs, stderr, metrics)
 					return
 				}
 
-				file, err := os.Open(filePath)
-				if err != nil {
-					fmt.Fprintln(stderr, fmt.Errorf("%s: %w", filePath, err))
-					return
+				outcome := scanner.scan(lineSource{path: filePath, meta: meta, seq: job.Seq, window: metrics.Order}, func(lines *bufio.Scanner, source lineSource) bool {
+					return sendLines(ctx, cfg, lines, source, lineJobs, metrics)
+				})
+				if outcome.err != nil {
+					reportFileError(stderr, metrics, filePath, job.Seq, outcome.err)
+				}
+				if outcome.skipped != "" {
+					skipFile(ctx, cfg, filePath, job.Seq, outcome.skipped, lineJobs)
 				}
+			}()
+		}
+	}
+}
 
-				scanner := bufio.NewScanner(file)
-				lineNumber := 0
-				for scanner.Scan() {
-					lineNumber++
-					lineText := scanner.Text()
+// lineSource describes the file whose lines sendLines queues.
+type lineSource struct {
+	path string
+	meta *FileMeta
+	seq  int64
+	// transcoded marks latin1 input, whose original bytes each became one rune.
+	transcoded bool
+	// binary marks a file with NUL bytes, searched only for -format grep
+	// (which reports whether it matches) or a NUL pattern.
+	binary bool
+	// started and bytesRead feed -file-stats: when the file was opened, and
+	// how much of it has been read so far.
+	started   time.Time
+	bytesRead func() int64
+	// window, in ordered mode, holds the reader back while the printer
+	// holds too many results of files after the one it is printing.
+	// Decompress workers go without: they take files as IO workers hand
+	// them over, so all of them could wait on later files while the one
+	// being printed queues behind.
+	window *OrderWindow
+}
 
-					select {
-					case <-ctx.Done():
-						_ = file.Close()
-						return
-					case lineJobs <- LineItem{Path: filePath, Line: lineNumber, Text: lineText}:
-						metrics.LinesEnqueued.Add(1)
-					}
-				}
+// sendLines queues every line the scanner yields for CPU workers. When the
+// result depends on the whole file (context lines, -L, grep-style counts and
+// binary hits, -file-events, -file-stats, ordered output) the lines share a
+// FileUnit closed by a final end-of-file item.
+// In ordered mode the unit streams plain matches, and the reader waits on
+// source.window before each line.
+// With -b it tracks each line's byte offset, counting the terminator bytes
+// the scanner strips. It returns false if ctx was cancelled first.
+func sendLines(
+	ctx context.Context,
+	cfg config.Config,
+	scanner *bufio.Scanner,
+	source lineSource,
+	lineJobs chan<- LineItem,
+	metrics *Metrics,
+) bool {
+	path, meta, transcoded := source.path, source.meta, source.transcoded
+	grep := cfg.OutputFormat == "grep"
+	var unit *FileUnit
+	switch {
+	case cfg.FilesWithoutMatch:
+		unit = newModeFileUnit(path, unitWithoutMatch)
+	case grep && cfg.CountMatches:
+		unit = newModeFileUnit(path, unitCountMatches)
+	case grep && cfg.CountOnly:
+		unit = newModeFileUnit(path, unitCount)
+	case grep && source.binary:
+		unit = newModeFileUnit(path, unitBinary)
+	case cfg.ContextBefore > 0 || cfg.ContextAfter > 0 || cfg.FileEvents || cfg.CollectsFileStats() || cfg.Ordered || cfg.TracksOutcomes() || cfg.MaxCount > 0:
+		unit = NewFileUnit(path, cfg.ContextBefore, cfg.ContextAfter)
+		unit.events = cfg.FileEvents
+	}
+	if unit != nil {
+		unit.meta = meta
+		unit.tracked = cfg.TracksOutcomes()
+		unit.limit = cfg.MaxCount
+		if cfg.Ordered {
+			unit.seq = source.seq
+			unit.stream = unit.mode == unitContext && unit.before == 0 && unit.after == 0 && !unit.events
+			unit.frontier = 1
+		}
+		if cfg.CollectsFileStats() {
+			unit.clock, unit.started = cfg.Clock, source.started
+		}
+	}
 
-				if err := scanner.Err(); err != nil {
-					fmt.Fprintln(stderr, fmt.Errorf("%s: %w", filePath, err))
+	var nextOffset int64
+	var advance int
+	if cfg.ByteOffset {
+		scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+			n, token, err := bufio.ScanLines(data, atEOF)
+			if token != nil {
+				advance = n
+				if transcoded {
+					advance = utf8.RuneCount(data[:n])
 				}
-				_ = file.Close()
-				metrics.FilesScanned.Add(1)
-			}()
+			}
+			return n, token, err
+		})
+	}
+
+	lineNumber := 0
+	for (unit == nil || !unit.full()) && scanner.Scan() {
+		lineNumber++
+		text := scanner.Text()
+		offset := nextOffset
+		nextOffset += int64(advance)
+		if unit != nil {
+			unit.addLine(text, offset, cfg.ByteOffset)
+		}
+		if !source.window.Wait(ctx, source.seq) {
+			return false
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case lineJobs <- LineItem{Path: path, Line: lineNumber, Text: text, Offset: offset, Meta: meta, Unit: unit}:
+			metrics.LinesEnqueued.Add(1)
+		}
+	}
+
+	// With -m the rest of the file is left unread, but for the lines the
+	// last reported match may need as after-context.
+	if unit != nil && unit.limit > 0 && unit.after > 0 && unit.full() {
+		for trailing := 0; trailing < unit.after && scanner.Scan(); trailing++ {
+			lineNumber++
+			unit.addTrailingLine(scanner.Text(), nextOffset, cfg.ByteOffset)
+			nextOffset += int64(advance)
+		}
+	}
+
+	if unit != nil {
+		unit.incomplete = scanner.Err() != nil
+		unit.lineCount = lineNumber
+		if source.bytesRead != nil {
+			unit.bytes = source.bytesRead()
 		}
+		select {
+		case <-ctx.Done():
+			return false
+		case lineJobs <- LineItem{Path: path, Meta: meta, Unit: unit, EndOfFile: true}:
+		}
+	}
+	return true
+}
+
+// skipFile reports a file that was not searched with -file-events, and ends
+// it in ordered mode, by sending an empty unit through the CPU workers so
+// that it is ordered like searched files. A file dropped by -max-size has no
+// reason and no event.
+func skipFile(ctx context.Context, cfg config.Config, path string, seq int64, reason string, lineJobs chan<- LineItem) {
+	if !cfg.FileEvents && !cfg.Ordered && !cfg.TracksOutcomes() {
+		return
+	}
+	unit := NewFileUnit(path, 0, 0)
+	unit.events = cfg.FileEvents
+	unit.skipped = reason
+	unit.tracked = cfg.TracksOutcomes()
+	if cfg.Ordered {
+		unit.seq = seq
+	}
+	select {
+	case <-ctx.Done():
+	case lineJobs <- LineItem{Path: path, Unit: unit, EndOfFile: true}:
 	}
 }
 
-// CPUWorker matches lines against the pattern and sends results.
+// CPUWorker matches lines against the pattern and sends results. With invert
+// set it sends the lines that do not match instead, without ranges. A line
+// the strategy fails on, such as one -engine pcre timed out on, is reported
+// on stderr, and with invert not sent.
 func CPUWorker(
 	ctx context.Context,
 	strategy MatchStrategy,
+	invert bool,
 	lineJobs <-chan LineItem,
 	results chan<- Result,
+	stderr io.Writer,
 	wg *sync.WaitGroup,
 	metrics *Metrics,
 ) {
@@ -127,28 +280,96 @@ func CPUWorker(
 
 			func() {
 				defer metrics.CPUActiveWorkers.Add(-1)
-				metrics.LinesProcessed.Add(1)
 
-				ranges := strategy.FindRanges(item.Text)
-				if len(ranges) == 0 {
+				var matches []Result
+				if item.Raw {
+					metrics.LinesProcessed.Add(1)
+					matches = byteMatches(strategy, item)
+				} else if !item.EndOfFile {
+					metrics.LinesProcessed.Add(1)
+					ranges, err := findRanges(strategy, item.Text)
+					if err != nil {
+						reportFileError(stderr, metrics, item.Path, item.seq(), fmt.Errorf("%s:%d: %w", item.Path, item.Line, err))
+					}
+					matched := len(ranges) > 0
+					if invert {
+						// A line the strategy failed on may well match.
+						matched = !matched && err == nil
+						ranges = nil
+					} else if !matched {
+						metrics.EmptyRun.offerLine(item)
+					}
+					if matched {
+						matches = []Result{{Path: item.Path, Line: item.Line, Text: item.Text, Ranges: ranges, Offset: item.Offset, Meta: item.Meta}}
+					}
+				}
+
+				if item.Unit == nil {
+					for _, result := range matches {
+						select {
+						case <-ctx.Done():
+							return
+						case results <- result:
+							metrics.MatchesProduced.Add(1)
+						}
+					}
 					return
 				}
 
-				result := Result{Path: item.Path, Line: item.Line, Text: item.Text, Ranges: ranges}
+				for _, result := range matches {
+					item.Unit.addMatch(result)
+					metrics.MatchesProduced.Add(1)
+				}
+				if item.Unit.stream && !item.EndOfFile && !item.Unit.pass(ctx, item.Line, matches, results) {
+					return
+				}
+				if !item.Unit.retire() {
+					return
+				}
+				result, ok := item.Unit.finish()
+				if !ok {
+					return
+				}
 				select {
 				case <-ctx.Done():
-					return
 				case results <- result:
-					metrics.MatchesProduced.Add(1)
 				}
 			}()
 		}
 	}
 }
 
+// WorkerPool starts workers on demand up to a fixed limit, so tiny searches
+// do not pay for goroutines they never use. It is not safe for concurrent use.
+type WorkerPool struct {
+	limit   int
+	started int
+	start   func()
+}
+
+// NewWorkerPool creates a pool that calls start once per worker it launches.
+func NewWorkerPool(limit int, start func()) *WorkerPool {
+	return &WorkerPool{limit: limit, start: start}
+}
+
+// Grow starts workers until want of them (capped at the limit) are running.
+func (pool *WorkerPool) Grow(want int) {
+	if want > pool.limit {
+		want = pool.limit
+	}
+	for pool.started < want {
+		pool.start()
+		pool.started++
+	}
+}
+
+// ScaleInterval is how often the scalers check queue pressure.
+const ScaleInterval = 200 * time.Millisecond
+
 // CPUScaler dynamically scales CPU workers based on queue pressure.
 func CPUScaler(
 	ctx context.Context,
+	clk clock.Clock,
 	lineJobs <-chan LineItem,
 	stop <-chan struct{},
 	cpuWorkers int,
@@ -156,10 +377,26 @@ func CPUScaler(
 	spawn func(),
 	metrics *Metrics,
 	done chan<- struct{},
+) {
+	scaleOnPressure(ctx, clk, func() int { return len(lineJobs) }, stop, cpuWorkers, maxWorkers, spawn, &metrics.ScaleUps, done)
+}
+
+// scaleOnPressure spawns a worker whenever more than two jobs per running
+// worker are pending, up to maxWorkers, until ctx or stop ends it.
+func scaleOnPressure(
+	ctx context.Context,
+	clk clock.Clock,
+	pending func() int,
+	stop <-chan struct{},
+	workers int,
+	maxWorkers int,
+	spawn func(),
+	scaleUps *atomic.Int64,
+	done chan<- struct{},
 ) {
 	defer close(done)
-	active := cpuWorkers
-	ticker := time.NewTicker(200 * time.Millisecond)
+	active := workers
+	ticker := clk.NewTicker(ScaleInterval)
 	defer ticker.Stop()
 
 	for {
@@ -168,12 +405,11 @@ func CPUScaler(
 			return
 		case <-stop:
 			return
-		case <-ticker.C:
-			pending := len(lineJobs)
-			if pending > active*2 && active < maxWorkers {
+		case <-ticker.C():
+			if pending() > active*2 && active < maxWorkers {
 				spawn()
 				active++
-				metrics.ScaleUps.Add(1)
+				scaleUps.Add(1)
 			}
 		}
 	}
@@ -181,24 +417,64 @@ func CPUScaler(
 
 // IsBinaryFile checks if a file contains binary content.
 func IsBinaryFile(path string) (bool, error) {
-	file, err := os.Open(path)
+	return IsBinaryFileIn(fsys.OS{}, path)
+}
+
+// IsBinaryFileIn checks if a file in filesystem contains binary content.
+func IsBinaryFileIn(filesystem fsys.FS, path string) (bool, error) {
+	file, err := filesystem.Open(path)
 	if err != nil {
 		return false, err
 	}
 	defer file.Close()
 
+	binary, _, err := detectBinary(file)
+	return binary, err
+}
+
+// fileSniff is what the first bytes of a file reveal before it is scanned.
+type fileSniff struct {
+	binary      bool
+	badEncoding bool
+	// scanBuffer is the sniff buffer, reusable for scanning when it held the
+	// whole file, or nil.
+	scanBuffer []byte
+}
+
+// sniffFile checks an open file for binary content and probable non-UTF-8
+// text, then rewinds it so the caller can scan it without reopening.
+func sniffFile(file fsys.File) (fileSniff, error) {
+	binary, buffer, err := detectBinary(file)
+	if err != nil {
+		return fileSniff{}, err
+	}
+	// Rewind binary files too, for a NUL pattern's binary-as-text search.
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fileSniff{}, err
+	}
+	if binary {
+		return fileSniff{binary: true}, nil
+	}
+	sniff := fileSniff{badEncoding: looksMisencoded(buffer)}
+	if len(buffer) < cap(buffer) {
+		sniff.scanBuffer = buffer[:0]
+	}
+	return sniff, nil
+}
+
+func detectBinary(reader io.Reader) (bool, []byte, error) {
 	buffer := make([]byte, 512)
-	count, readErr := file.Read(buffer)
+	count, readErr := reader.Read(buffer)
 	if readErr != nil && !errors.Is(readErr, io.EOF) {
-		return false, readErr
+		return false, nil, readErr
 	}
 
 	for _, b := range buffer[:count] {
 		if b == 0 {
-			return true, nil
+			return true, nil, nil
 		}
 	}
-	return false, nil
+	return false, buffer[:count], nil
 }
 
 // ScanFile is a convenience function for scanning a single file.
@@ -206,47 +482,33 @@ func ScanFile(path string, pattern string) ([]Result, error) {
 	return ScanFileWithMatcher(path, NewMatcher(pattern, false, false), 0)
 }
 
-// ScanFileWithMatcher scans a file with a specific matcher.
+// ScanFileWithMatcher scans a file with a specific matcher, reading it the
+// way the search pipeline does. A binary file or one over maxSizeBytes (when
+// positive) has no matches.
 func ScanFileWithMatcher(path string, matcher Matcher, maxSizeBytes int64) ([]Result, error) {
-	binary, err := IsBinaryFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("%s: %w", path, err)
-	}
-	if binary {
-		return nil, nil
+	scanner := fileScanner{cfg: config.Config{FS: fsys.OS{}, MaxSizeBytes: maxSizeBytes}, metrics: &Metrics{}}
+	_, ok, err := scanner.admit(FileJob{Path: path})
+	if err != nil || !ok {
+		return nil, err
 	}
 
-	if maxSizeBytes > 0 {
-		info, statErr := os.Stat(path)
-		if statErr != nil {
-			return nil, fmt.Errorf("%s: %w", path, statErr)
-		}
-		if info.Size() > maxSizeBytes {
-			return nil, nil
-		}
-	}
-
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, fmt.Errorf("%s: %w", path, err)
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	lineNumber := 0
 	matches := make([]Result, 0)
-
-	for scanner.Scan() {
-		lineNumber++
-		line := scanner.Text()
-		ranges := matcher.FindRanges(line)
-		if len(ranges) > 0 {
-			matches = append(matches, Result{Path: path, Line: lineNumber, Text: line, Ranges: ranges})
+	outcome := scanner.scan(lineSource{path: path}, func(lines *bufio.Scanner, source lineSource) bool {
+		lineNumber := 0
+		for lines.Scan() {
+			lineNumber++
+			line := lines.Text()
+			if ranges := matcher.FindRanges(line); len(ranges) > 0 {
+				matches = append(matches, Result{Path: path, Line: lineNumber, Text: line, Ranges: ranges})
+			}
 		}
+		return true
+	})
+	if outcome.err != nil {
+		return nil, outcome.err
 	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("%s: %w", path, err)
+	if outcome.skipped != "" {
+		return nil, nil
 	}
 	return matches, nil
 }
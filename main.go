@@ -11,13 +11,18 @@ import (
 	"io"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"regexp"
 	"runtime"
 	"runtime/pprof"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/vennictus/gosearch/internal/config"
+	"github.com/vennictus/gosearch/internal/fsys"
 	"github.com/vennictus/gosearch/internal/output"
+	"github.com/vennictus/gosearch/internal/repro"
 	"github.com/vennictus/gosearch/internal/search"
 )
 
@@ -25,27 +30,98 @@ const (
 	exitCodeMatchFound = 0
 	exitCodeNoMatches  = 1
 	exitCodeUsageError = 2
+	exitCodeThreshold  = 3
 )
 
+// smallSearchFiles is the file count below which the pipeline keeps reduced
+// worker pools and skips dynamic scaling.
+const smallSearchFiles = 32
+
 func main() {
+	// Report a closed stdout as EPIPE write errors instead of dying by
+	// SIGPIPE, so the printer can stop the search and exit cleanly.
+	signal.Ignore(syscall.SIGPIPE)
 	exitCode := run(os.Args[1:], os.Stdout, os.Stderr)
 	os.Exit(exitCode)
 }
 
+// isTerminal reports whether w is a terminal, which turns on -color=auto.
+// Tests replace it to exercise auto detection.
+var isTerminal = func(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// patternInput supplies a pattern that is not an argument: standard input
+// for -stdin-pattern, and a prompt on the terminal when standard input is
+// one. Tests replace it.
+var patternInput = func() config.PatternInput {
+	input := config.PatternInput{Stdin: os.Stdin}
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		input.Prompt = config.PromptPattern
+	}
+	return input
+}
+
 func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	return runWithFS(args, stdout, stderr, fsys.OS{})
+}
+
+// runWithFS is run with the searched filesystem injected, so tests can use an
+// in-memory or fault-injecting tree.
+func runWithFS(args []string, stdout io.Writer, stderr io.Writer, filesystem fsys.FS) (exitCode int) {
 	startTotal := time.Now()
-	cfg, err := config.Parse(args)
+	cfg, err := config.ParseWithInput(args, patternInput())
 	if err != nil {
 		fmt.Fprintln(stderr, config.UsageText)
 		fmt.Fprintln(stderr, err)
+		if statsPath := config.StatsFileArg(args); statsPath != "" {
+			recordUsageError(statsPath, cfg, startTotal, stderr)
+		}
 		return exitCodeUsageError
 	}
+	cfg.FS = filesystem
+	if cfg.ColorMode == config.ColorAuto {
+		cfg.Color = cfg.OutputPath == "" && isTerminal(stdout)
+	}
+	if cfg.HyperlinkMode == config.ColorAuto {
+		cfg.Hyperlink = cfg.OutputPath == "" && isTerminal(stdout)
+	}
+	if cfg.OutputPath != "" || cfg.SplitOutput != "" || !isTerminal(stdout) {
+		cfg.AutoSpill = 0
+	}
+	// A terminal gets control characters stripped, so matched text cannot
+	// drive it; pipes and files get them escaped, so nothing is lost.
+	if cfg.Escape == config.EscapeAuto {
+		cfg.Escape = config.EscapeEscape
+		if cfg.OutputPath == "" && cfg.SplitOutput == "" && isTerminal(stdout) {
+			cfg.Escape = config.EscapeStrip
+		}
+	}
 
 	if cfg.ShowVersion {
 		fmt.Fprintln(stdout, cfg.VersionLabel)
 		return exitCodeMatchFound
 	}
 
+	if cfg.ShowJSONSchema {
+		schema, err := output.JSONSchema()
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitCodeUsageError
+		}
+		fmt.Fprintf(stdout, "%s\n", schema)
+		return exitCodeMatchFound
+	}
+
+	if cfg.ReproReplay != "" {
+		return replayRepro(cfg.ReproReplay, stdout, stderr)
+	}
+
 	if cfg.CompletionTarget != "" {
 		if !config.ValidCompletionTarget(cfg.CompletionTarget) {
 			fmt.Fprintln(stderr, config.UsageText)
@@ -57,6 +133,21 @@ func run(args []string, stdout io.Writer, stderr io.Writer) int {
 		return exitCodeMatchFound
 	}
 
+	// Every return from here until the search has run is a usage error,
+	// which -stats-file records too.
+	recorded := false
+	defer func() {
+		if !recorded && cfg.StatsFile != "" {
+			recordUsageError(cfg.StatsFile, cfg, startTotal, stderr)
+		}
+	}()
+
+	if err := cfg.CheckRoot(); err != nil {
+		fmt.Fprintln(stderr, config.UsageText)
+		fmt.Fprintln(stderr, err)
+		return exitCodeUsageError
+	}
+
 	cleanupProfile, profileErr := setupProfiling(cfg)
 	if profileErr != nil {
 		fmt.Fprintln(stderr, config.UsageText)
@@ -65,23 +156,139 @@ func run(args []string, stdout io.Writer, stderr io.Writer) int {
 	}
 	defer cleanupProfile()
 
-	strategy, err := search.BuildStrategy(cfg.Pattern, cfg.Regex, cfg.IgnoreCase, cfg.WholeWord)
+	var strategy search.MatchStrategy
+	if len(cfg.HexPattern) > 0 {
+		strategy = search.NewHexStrategy(cfg.HexPattern)
+	} else if cfg.Overlapping {
+		strategy = search.NewOverlappingMatcher(cfg.Pattern, cfg.IgnoreCase, cfg.WholeWord)
+	} else {
+		strategy, err = search.BuildStrategies(cfg.Patterns, cfg.Regex, regexEngine(cfg), cfg.IgnoreCase, cfg.WholeWord, cfg.MatchAll)
+	}
 	if err != nil {
 		fmt.Fprintln(stderr, config.UsageText)
 		fmt.Fprintln(stderr, "invalid regex pattern:", err)
 		return exitCodeUsageError
 	}
+	if cfg.Replace && cfg.Regex {
+		if err := checkReplacement(cfg); err != nil {
+			fmt.Fprintln(stderr, config.UsageText)
+			fmt.Fprintln(stderr, err)
+			return exitCodeUsageError
+		}
+	}
+	if len(cfg.NotPatterns) > 0 {
+		// -not patterns only decide whether a line is reported, so they
+		// record no captures.
+		engine := regexEngine(cfg)
+		engine.Captures = false
+		exclude, err := search.BuildStrategies(cfg.NotPatterns, cfg.Regex, engine, cfg.IgnoreCase, cfg.WholeWord, false)
+		if err != nil {
+			fmt.Fprintln(stderr, config.UsageText)
+			fmt.Fprintln(stderr, "invalid not pattern:", err)
+			return exitCodeUsageError
+		}
+		strategy = search.NewExcludingStrategy(strategy, exclude)
+	}
+	if cfg.MatchFilter != "" {
+		filter, err := regexp.Compile(cfg.MatchFilter)
+		if err != nil {
+			fmt.Fprintln(stderr, config.UsageText)
+			fmt.Fprintln(stderr, "invalid match-filter pattern:", err)
+			return exitCodeUsageError
+		}
+		strategy = search.NewFilteredStrategy(strategy, filter)
+	}
+	if cfg.MinEntropy > 0 {
+		strategy = search.NewEntropyStrategy(strategy, cfg.MinEntropy)
+	}
+	if cfg.Template != nil {
+		if err := output.CheckTemplate(cfg.Template); err != nil {
+			fmt.Fprintln(stderr, config.UsageText)
+			fmt.Fprintln(stderr, err)
+			return exitCodeUsageError
+		}
+	}
+	var recorder *repro.Recorder
+	if cfg.ReproPath != "" {
+		recorder = repro.NewRecorder(cfg, args, cfg.ReproContent)
+		cfg.FS = recorder.FS()
+	}
+	if cfg.Tune {
+		calibration := search.Calibrate(context.Background(), cfg, strategy, search.CalibrationFiles)
+		calibration.Apply(&cfg, smallSearchFiles)
+		tracef(cfg, stderr, "tuned: sampled %d files, read %d (%d bytes, %d/%d lines matched, read %s, match %s): io-workers=%d cpu-workers=%d backpressure=%d dynamic-workers=%t",
+			calibration.Files, calibration.Sampled, calibration.Bytes, calibration.Matches, calibration.Lines, calibration.Read, calibration.Match,
+			cfg.IOWorkers, cfg.CPUWorkers, cfg.Backpressure, cfg.DynamicWorkers)
+	}
+
+	var baseline *output.Baseline
+	if cfg.BaselinePath != "" {
+		if cfg.BaselineWrite {
+			baseline = output.NewBaselineRecorder(cfg.RootPath)
+		} else {
+			baseline, err = output.LoadBaseline(cfg.BaselinePath, cfg.RootPath)
+			if err != nil {
+				fmt.Fprintln(stderr, config.UsageText)
+				fmt.Fprintln(stderr, err)
+				return exitCodeUsageError
+			}
+		}
+	}
+
+	var outputFile *output.OutputFile
+	if cfg.OutputPath != "" {
+		outputFile, err = output.CreateOutputFile(cfg.OutputPath)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitCodeUsageError
+		}
+		stdout = outputFile
+	}
+	var splitOutput *output.SplitOutput
+	if cfg.SplitOutput != "" {
+		splitOutput, err = output.CreateSplitOutput(cfg, stderr)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitCodeUsageError
+		}
+	}
 
 	signalCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
-	ctx, cancel := context.WithCancel(signalCtx)
-	defer cancel()
+	// Whatever stops the search early cancels ctx with a search.StopCause;
+	// an interrupt cancels it through signalCtx.
+	ctx, cancel := context.WithCancelCause(signalCtx)
+	defer cancel(nil)
 
 	metrics := &search.Metrics{}
+	if cfg.WhyEmpty {
+		metrics.EmptyRun = search.NewEmptyRunProbe()
+	}
+	if cfg.Ordered {
+		metrics.Order = search.NewOrderWindow(search.OrderWindowResults)
+	}
 	timings := search.PhaseTimings{}
 
 	tracef(cfg, stderr, "runtime start")
 
+	// -progress=full and estimate count the tree before searching it, so
+	// the progress line can show percent complete and an ETA. Should the
+	// count fail, the search reports why and progress shows counts only.
+	var workTotal *search.WorkTotal
+	if cfg.Progress == config.ProgressFull || cfg.Progress == config.ProgressEstimate {
+		budget := time.Duration(0)
+		if cfg.Progress == config.ProgressEstimate {
+			budget = search.EstimateBudget
+		}
+		startPreCount := time.Now()
+		total, err := search.CountWork(ctx, cfg, budget)
+		timings.PreCount = time.Since(startPreCount)
+		tracef(cfg, stderr, "phase precount finished in %s: files=%d bytes=%d approximate=%t", timings.PreCount, total.Files, total.Bytes, total.Approximate)
+		if err == nil {
+			workTotal = &total
+		}
+	}
+
 	monitorDone := make(chan struct{})
 	if cfg.MonitorGoroutine {
 		go monitorGoroutines(ctx, cfg, stderr, monitorDone)
@@ -89,75 +296,356 @@ func run(args []string, stdout io.Writer, stderr io.Writer) int {
 		close(monitorDone)
 	}
 
-	pathJobs := make(chan string, cfg.Backpressure)
+	progressStop := make(chan struct{})
+	progressDone := make(chan struct{})
+	if cfg.Progress != "" {
+		go output.ReportProgress(cfg, stderr, metrics, workTotal, progressStop, progressDone)
+	} else {
+		close(progressDone)
+	}
+
+	pathJobs := make(chan search.FileJob, cfg.Backpressure)
+	compressedJobs := make(chan search.CompressedJob, cfg.Backpressure)
 	lineJobs := make(chan search.LineItem, cfg.Backpressure)
 	results := make(chan search.Result, cfg.Backpressure)
 
 	printerDone := make(chan output.PrintSummary)
-	go output.Printer(ctx, results, stdout, cfg, cancel, printerDone)
+	go output.Printer(ctx, results, stdout, stderr, cfg, baseline, splitOutput, metrics, cancel, printerDone)
+
+	// Diagnostics go through the printer to interleave with matches, and in
+	// -format json so per-file errors also become error records.
+	diagnostics := stderr
+	if cfg.CombinedOutput || cfg.OutputFormat == "json" {
+		diagnostics = search.NewDiagnosticWriter(ctx, results, stderr, cfg.Ordered)
+	}
 
 	var cpuWG sync.WaitGroup
 	startCPUWorker := func() {
 		cpuWG.Add(1)
-		go search.CPUWorker(ctx, strategy, lineJobs, results, &cpuWG, metrics)
+		go search.CPUWorker(ctx, strategy, cfg.Invert, lineJobs, results, diagnostics, &cpuWG, metrics)
+	}
+
+	var ioWG sync.WaitGroup
+	startIOWorker := func() {
+		ioWG.Add(1)
+		go search.IOWorker(ctx, cfg, pathJobs, lineJobs, compressedJobs, diagnostics, &ioWG, metrics)
+	}
+
+	var decompressWG sync.WaitGroup
+	startDecompressWorker := func() {
+		decompressWG.Add(1)
+		go search.DecompressWorker(ctx, cfg, compressedJobs, lineJobs, diagnostics, &decompressWG, metrics)
 	}
 
-	for i := 0; i < cfg.CPUWorkers; i++ {
-		startCPUWorker()
+	// Pools start with one worker each and grow with the number of files the
+	// walk enqueues; only searches past smallSearchFiles get full pools and
+	// dynamic scaling. Decompress workers only exist with -z.
+	ioPool := search.NewWorkerPool(cfg.IOWorkers, startIOWorker)
+	cpuPool := search.NewWorkerPool(cfg.CPUWorkers, startCPUWorker)
+	decompressLimit := 0
+	if cfg.SearchCompressed {
+		decompressLimit = cfg.DecompressWorkers
 	}
+	decompressPool := search.NewWorkerPool(decompressLimit, startDecompressWorker)
+	ioPool.Grow(1)
+	cpuPool.Grow(1)
+	decompressPool.Grow(1)
 
 	scaleStop := make(chan struct{})
 	scaleDone := make(chan struct{})
-	if cfg.DynamicWorkers {
-		go search.CPUScaler(ctx, lineJobs, scaleStop, cfg.CPUWorkers, cfg.MaxWorkers, startCPUWorker, metrics, scaleDone)
-	} else {
-		close(scaleDone)
+	decompressScaleStop := make(chan struct{})
+	decompressScaleDone := make(chan struct{})
+	scalerStarted := false
+	decompressScalerStarted := false
+	onEnqueue := func(enqueued int64) {
+		if enqueued < smallSearchFiles {
+			ioPool.Grow(int(enqueued))
+			cpuPool.Grow(int(enqueued))
+			decompressPool.Grow(int(enqueued))
+			return
+		}
+		ioPool.Grow(cfg.IOWorkers)
+		cpuPool.Grow(cfg.CPUWorkers)
+		decompressPool.Grow(decompressLimit)
+		if cfg.DynamicWorkers && !scalerStarted {
+			scalerStarted = true
+			go search.CPUScaler(ctx, cfg.Clock, lineJobs, scaleStop, cfg.CPUWorkers, cfg.MaxWorkers, startCPUWorker, metrics, scaleDone)
+		}
+		if cfg.DynamicWorkers && cfg.SearchCompressed && !decompressScalerStarted {
+			decompressScalerStarted = true
+			go search.DecompressScaler(ctx, cfg.Clock, compressedJobs, decompressScaleStop, cfg.DecompressWorkers, cfg.DecompressWorkers*2, startDecompressWorker, metrics, decompressScaleDone)
+		}
 	}
 
-	var ioWG sync.WaitGroup
-	for i := 0; i < cfg.IOWorkers; i++ {
-		ioWG.Add(1)
-		go search.IOWorker(ctx, cfg, pathJobs, lineJobs, stderr, &ioWG, metrics)
+	hooks := search.WalkHooks{OnEnqueue: onEnqueue}
+	if cfg.Debug || cfg.Trace {
+		hooks.OnSymlink = func(link search.SymlinkResolution) {
+			reparse := ""
+			if link.Reparse != search.ReparseNone {
+				reparse = " reparse=" + link.Reparse.String()
+			}
+			tracef(cfg, stderr, "symlink path=%q target=%q resolved=%q decision=%s outside_root=%t%s", link.Path, link.Target, link.Resolved, link.Decision, link.OutsideRoot, reparse)
+		}
+	}
+	if recorder != nil {
+		hooks.OnDecision = recorder.Decide
+	}
+	if cfg.WhyEmpty {
+		record := hooks.OnDecision
+		hooks.OnDecision = func(decision search.WalkDecision) {
+			if record != nil {
+				record(decision)
+			}
+			if decision.Decision == search.DecisionIgnored && len(strategy.FindRanges(filepath.Base(decision.Path))) > 0 {
+				metrics.EmptyRun.IgnoredName(decision.Path, decision.Rule)
+			}
+		}
+	}
+	if cfg.AlsoFilenames {
+		hooks.OnCandidate = func(path string) {
+			ranges := strategy.FindRanges(filepath.Base(path))
+			if len(ranges) == 0 {
+				return
+			}
+			select {
+			case <-ctx.Done():
+			case results <- search.Result{Kind: search.KindFilename, Path: path, Ranges: ranges}:
+			}
+		}
+	}
+
+	// Memory is sampled at phase boundaries and a few times a second in
+	// between, only when something reports it.
+	var memory *search.MemoryTracker
+	memorySamplerStop := make(chan struct{})
+	memorySamplerDone := make(chan struct{})
+	if cfg.Metrics || cfg.StatsFile != "" || cfg.MemLimitBytes > 0 {
+		memory = search.NewMemoryTracker(search.ReadMemSample)
+		go sampleMemory(cfg, memory, memorySamplerStop, memorySamplerDone)
+	} else {
+		close(memorySamplerDone)
 	}
 
 	startWalk := time.Now()
-	walkErr := search.WalkFiles(ctx, cfg, pathJobs, stderr, metrics)
+	memory.Enter(search.PhaseWalk)
+	walkErr := search.WalkFiles(ctx, cfg, pathJobs, diagnostics, metrics, hooks)
 	timings.Walk = time.Since(startWalk)
 	tracef(cfg, stderr, "phase walk finished in %s", timings.Walk)
 	close(pathJobs)
+	if cfg.AlsoFilenames {
+		select {
+		case <-ctx.Done():
+		case results <- search.Result{Kind: search.KindWalkDone}:
+		}
+	}
+	if !scalerStarted {
+		close(scaleDone)
+	}
+	if !decompressScalerStarted {
+		close(decompressScaleDone)
+	}
 
+	// Each stage's input closes only once every producer for it has exited,
+	// and each scaler stops before the pool it grows is waited on, so no
+	// worker is spawned after its WaitGroup drains.
 	startScan := time.Now()
+	memory.Enter(search.PhaseScan)
 	ioWG.Wait()
+	close(compressedJobs)
+	close(decompressScaleStop)
+	<-decompressScaleDone
+	decompressWG.Wait()
 	close(lineJobs)
 	close(scaleStop)
 	<-scaleDone
 
 	cpuWG.Wait()
 	timings.Scan = time.Since(startScan)
+	close(progressStop)
+	<-progressDone
 	tracef(cfg, stderr, "phase scan finished in %s", timings.Scan)
 
 	startPrint := time.Now()
+	memory.Enter(search.PhasePrint)
 	close(results)
 	summary := <-printerDone
 	timings.Print = time.Since(startPrint)
+	close(memorySamplerStop)
+	<-memorySamplerDone
+	memoryPeaks := memory.Finish()
 	timings.Total = time.Since(startTotal)
 	tracef(cfg, stderr, "phase print finished in %s", timings.Print)
 	<-monitorDone
 
-	if walkErr != nil && !errors.Is(walkErr, context.Canceled) {
-		fmt.Fprintln(stderr, walkErr)
-		return exitCodeUsageError
+	exitCode = exitCodeNoMatches
+	if summary.MatchCount > 0 || summary.FilenameCount > 0 {
+		exitCode = exitCodeMatchFound
+	}
+	if violation := output.ThresholdViolation(cfg, summary.MatchCount); violation != "" {
+		fmt.Fprintln(stderr, violation)
+		exitCode = exitCodeThreshold
+	}
+	if summary.BaselineErr != nil {
+		fmt.Fprintln(stderr, summary.BaselineErr)
+		exitCode = exitCodeUsageError
+	}
+	if summary.TemplateErr != nil {
+		fmt.Fprintln(stderr, summary.TemplateErr)
+		exitCode = exitCodeUsageError
+	}
+	if summary.WriteErr != nil {
+		// A closed pipe ends the run early on purpose: counts are partial,
+		// so thresholds are not judged on them.
+		if output.IsBrokenPipe(summary.WriteErr) {
+			exitCode = exitCodeNoMatches
+			if summary.MatchCount > 0 || summary.FilenameCount > 0 {
+				exitCode = exitCodeMatchFound
+			}
+		} else {
+			fmt.Fprintln(stderr, "write error:", summary.WriteErr)
+			exitCode = exitCodeUsageError
+		}
 	}
 
-	if cfg.Metrics {
+	if failedOnFileErrors(cfg, metrics, summary) {
+		fmt.Fprintln(stderr, metrics.FileErrors.Summary(cfg.ErrorsExit))
+		exitCode = exitCodeUsageError
+	}
+
+	if walkErr != nil && !errors.Is(walkErr, context.Canceled) {
+		fmt.Fprintln(stderr, walkErr)
+		exitCode = exitCodeUsageError
+	} else if cfg.Metrics {
 		output.PrintMetrics(stderr, metrics)
 		output.PrintPhaseTimings(stderr, timings)
+		output.PrintPhaseMemory(stderr, memoryPeaks)
+	}
+	if warning := memLimitWarning(cfg, memoryPeaks); warning != "" {
+		fmt.Fprintln(stderr, warning)
+	}
+	if cfg.WhyEmpty && summary.MatchCount == 0 && summary.FilenameCount == 0 {
+		explainEmpty(cfg, strategy, metrics, stderr)
+	}
+	if cfg.Stats {
+		output.PrintStats(stderr, output.Numbers{Plain: cfg.PlainNumbers}, metrics, summary, timings.Total, search.StopCauseOf(ctx))
 	}
 
-	if summary.MatchCount > 0 {
-		return exitCodeMatchFound
+	// An interrupted or failed run leaves an existing -output file as it was.
+	if outputFile != nil {
+		if summary.WriteErr != nil || signalCtx.Err() != nil {
+			outputFile.Discard()
+		} else if err := outputFile.Commit(); err != nil {
+			fmt.Fprintln(stderr, err)
+			exitCode = exitCodeUsageError
+		}
+	}
+	if splitOutput != nil {
+		if summary.WriteErr != nil || signalCtx.Err() != nil {
+			splitOutput.Discard()
+		} else if err := splitOutput.Commit(); err != nil {
+			fmt.Fprintln(stderr, err)
+			exitCode = exitCodeUsageError
+		}
+	}
+
+	if recorder != nil {
+		if err := recorder.Write(cfg.ReproPath); err != nil {
+			fmt.Fprintln(stderr, err)
+			exitCode = exitCodeUsageError
+		}
+	}
+
+	// -compare-last keeps its history in the -stats-file when there is one.
+	// A run that stopped early or failed is recorded but not compared.
+	statsPath := cfg.StatsFile
+	if cfg.CompareLast && statsPath == "" {
+		if statsPath, err = output.CompareHistoryPath(); err != nil {
+			fmt.Fprintln(stderr, err)
+		}
+	}
+	var statsKey []byte
+	if statsPath != "" {
+		if statsKey, err = output.StatsKey(); err != nil {
+			fmt.Fprintln(stderr, err)
+			statsPath = ""
+		}
+	}
+	recorded = true
+	stopped := search.StopCauseOf(ctx)
+	if cfg.CompareLast && statsPath != "" && stopped == nil && exitCode != exitCodeUsageError {
+		if previous, found := output.LastRun(statsPath, output.CompareKey(cfg, statsKey)); found {
+			current := output.RunSummary{Matches: summary.MatchCount, FilesScanned: metrics.FilesScanned.Load(), TotalMs: float64(timings.Total) / float64(time.Millisecond)}
+			output.PrintComparison(stderr, output.Numbers{Plain: cfg.PlainNumbers}, previous, current)
+		}
+	}
+	if statsPath != "" {
+		if err := output.AppendStatsRecord(statsPath, statsKey, cfg, metrics, timings, memoryPeaks, exitCode, summary.MatchCount, stopped); err != nil {
+			fmt.Fprintln(stderr, err)
+		}
+		if statsPath != cfg.StatsFile {
+			if err := output.TrimCompareHistory(statsPath); err != nil {
+				fmt.Fprintln(stderr, err)
+			}
+		}
+	}
+	return exitCode
+}
+
+// recordUsageError appends the -stats-file record of a run that ended with a
+// usage error before searching, so failed CI invocations are counted too.
+func recordUsageError(statsPath string, cfg config.Config, startTotal time.Time, stderr io.Writer) {
+	key, err := output.StatsKey()
+	if err == nil {
+		timings := search.PhaseTimings{Total: time.Since(startTotal)}
+		err = output.AppendStatsRecord(statsPath, key, cfg, &search.Metrics{}, timings, search.PhaseMemory{}, exitCodeUsageError, 0, nil)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+	}
+}
+
+// failedOnFileErrors reports whether a per-file error in a category selected
+// by -errors-exit occurred. As with grep -q, -format grep -quiet ignores
+// errors once a match is found.
+func failedOnFileErrors(cfg config.Config, metrics *search.Metrics, summary output.PrintSummary) bool {
+	if cfg.OutputFormat == "grep" && cfg.Quiet && summary.MatchCount > 0 {
+		return false
+	}
+	for category := range cfg.ErrorsExit {
+		if metrics.FileErrors.Count(category) > 0 {
+			return true
+		}
 	}
-	return exitCodeNoMatches
+	return false
+}
+
+// replayRepro walks the tree recorded in a -repro bundle again and prints
+// every path decided differently. It exits 0 when the walks agree.
+func replayRepro(path string, stdout io.Writer, stderr io.Writer) int {
+	bundle, err := repro.Load(path)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitCodeUsageError
+	}
+	differences, entries := repro.Replay(bundle)
+	describe := func(entry repro.Entry) string {
+		if entry.Decision == "" {
+			return "not seen"
+		}
+		if entry.Rule != "" {
+			return entry.Decision + " (" + entry.Rule + ")"
+		}
+		return entry.Decision
+	}
+	for _, difference := range differences {
+		fmt.Fprintf(stdout, "%s: recorded %s, replayed %s\n", difference.Path, describe(difference.Recorded), describe(difference.Replayed))
+	}
+	if len(differences) > 0 {
+		fmt.Fprintf(stdout, "%d of %d decisions differ\n", len(differences), entries)
+		return exitCodeNoMatches
+	}
+	fmt.Fprintf(stdout, "all %d decisions reproduced\n", entries)
+	return exitCodeMatchFound
 }
 
 func setupProfiling(cfg config.Config) (func(), error) {
@@ -199,19 +687,80 @@ func setupProfiling(cfg config.Config) (func(), error) {
 
 func monitorGoroutines(ctx context.Context, cfg config.Config, stderr io.Writer, done chan<- struct{}) {
 	defer close(done)
-	ticker := time.NewTicker(cfg.MonitorInterval)
+	ticker := cfg.Clock.NewTicker(cfg.MonitorInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 			fmt.Fprintf(stderr, "goroutines count=%d\n", runtime.NumGoroutine())
 		}
 	}
 }
 
+// checkReplacement reports a group the -replace text refers to that one of
+// the -regex patterns lacks, once, before any line is read.
+func checkReplacement(cfg config.Config) error {
+	engine := regexEngine(cfg)
+	for _, pattern := range cfg.Patterns {
+		names, err := engine.GroupNames(pattern)
+		if err != nil {
+			return err
+		}
+		if err := output.CheckReplacement(cfg.Replacement, pattern, names); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// regexEngine returns the engine -engine selects for -regex patterns. JSON
+// records carry what named groups matched, unless -redact hides the text,
+// -replace may refer to any group, and -color gives each group a color.
+func regexEngine(cfg config.Config) search.RegexEngine {
+	captures := (cfg.OutputFormat == "json" && !cfg.Redact) || cfg.Replace || cfg.Color
+	return search.RegexEngine{PCRE: cfg.Engine == "pcre", Timeout: cfg.PCRETimeout, Captures: captures}
+}
+
+// explainEmpty prints the -why-empty diagnosis of a run with no matches.
+func explainEmpty(cfg config.Config, strategy search.MatchStrategy, metrics *search.Metrics, stderr io.Writer) {
+	var relaxed search.MatchStrategy
+	if len(cfg.HexPattern) == 0 && (!cfg.IgnoreCase || cfg.WholeWord) {
+		relaxed, _ = search.BuildStrategies(cfg.Patterns, cfg.Regex, regexEngine(cfg), true, false, cfg.MatchAll)
+	}
+	for _, finding := range metrics.EmptyRun.Explain(cfg, strategy, relaxed, metrics) {
+		fmt.Fprintln(stderr, "why-empty:", finding)
+	}
+}
+
+// sampleMemory samples memory for tracker until stop is closed.
+func sampleMemory(cfg config.Config, tracker *search.MemoryTracker, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := cfg.Clock.NewTicker(search.MemSampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C():
+			tracker.Sample()
+		}
+	}
+}
+
+// memLimitWarning returns a warning when peak memory obtained from the OS
+// came within 10% of -mem-limit, or "".
+func memLimitWarning(cfg config.Config, memory search.PhaseMemory) string {
+	limit := uint64(cfg.MemLimitBytes)
+	if limit == 0 || memory.Total.Sys < limit-limit/10 {
+		return ""
+	}
+	return fmt.Sprintf("warning: peak memory %d bytes is %d%% of -mem-limit %d bytes; lower -workers or -backpressure", memory.Total.Sys, memory.Total.Sys*100/limit, limit)
+}
+
 func tracef(cfg config.Config, stderr io.Writer, format string, args ...any) {
 	if !cfg.Trace && !cfg.Debug {
 		return